@@ -16,18 +16,14 @@ func AdminAuthMiddleware(next http.Handler) http.Handler {
             return
         }
 
-        tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-        token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-            return []byte("ADMIN_SECRET_KEY"), nil
-        })
-
+        token, err := lireJetonAdmin(authHeader)
         if err != nil || !token.Valid {
             http.Error(w, "Invalid token", http.StatusUnauthorized)
             return
         }
 
-        claims, ok := token.Claims.(jwt.MapClaims)
-        if !ok || !claims["is_admin"].(bool) {
+        claims, ok := claimsAdmin(token)
+        if !ok {
             http.Error(w, "Unauthorized: admin access required", http.StatusForbidden)
             return
         }
@@ -35,4 +31,51 @@ func AdminAuthMiddleware(next http.Handler) http.Handler {
         ctx := context.WithValue(r.Context(), "admin_claims", claims)
         next.ServeHTTP(w, r.WithContext(ctx))
     })
-}
\ No newline at end of file
+}
+
+// AdminOptionnelMiddleware identifie l'administrateur si un jeton valide est fourni,
+// sans rien refuser : les routes publiques peuvent ainsi montrer davantage aux administrateurs.
+func AdminOptionnelMiddleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if authHeader := r.Header.Get("Authorization"); authHeader != "" {
+            if token, err := lireJetonAdmin(authHeader); err == nil && token.Valid {
+                if claims, ok := claimsAdmin(token); ok {
+                    r = r.WithContext(context.WithValue(r.Context(), "admin_claims", claims))
+                }
+            }
+        }
+        next.ServeHTTP(w, r)
+    })
+}
+
+func lireJetonAdmin(authHeader string) (*jwt.Token, error) {
+    tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+    return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+        return []byte("ADMIN_SECRET_KEY"), nil
+    })
+}
+
+func claimsAdmin(token *jwt.Token) (jwt.MapClaims, bool) {
+    claims, ok := token.Claims.(jwt.MapClaims)
+    if !ok {
+        return nil, false
+    }
+    isAdmin, _ := claims["is_admin"].(bool)
+    return claims, isAdmin
+}
+
+// EstAdmin indique si la requête émane d'un administrateur authentifié.
+func EstAdmin(r *http.Request) bool {
+    _, ok := r.Context().Value("admin_claims").(jwt.MapClaims)
+    return ok
+}
+
+// AdminEmail retourne l'email de l'administrateur authentifié par AdminAuthMiddleware.
+func AdminEmail(r *http.Request) string {
+    claims, ok := r.Context().Value("admin_claims").(jwt.MapClaims)
+    if !ok {
+        return ""
+    }
+    email, _ := claims["email"].(string)
+    return email
+}
@@ -3,6 +3,7 @@ package admin
 
 import (
     "database/sql"
+    "fmt"
     "time"
     "ecommerce-api/models"
     "golang.org/x/crypto/bcrypt"
@@ -68,4 +69,13 @@ func (r *AdminRepository) LoginAdmin(email, password string) (*models.User, erro
     }
     
     return &admin, nil
-}
\ No newline at end of file
+}
+// ListerEmailsAdmins retourne l'adresse email de chaque administrateur actif.
+func (r *AdminRepository) ListerEmailsAdmins() ([]string, error) {
+    var emails []string
+    err := r.db.Select(&emails, `SELECT email FROM users WHERE is_admin = true AND status = 'active' ORDER BY email`)
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors de la récupération des administrateurs : %v", err)
+    }
+    return emails, nil
+}
@@ -0,0 +1,350 @@
+package categories
+
+import (
+	"database/sql"
+	"ecommerce-api/models"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrAttributIntrouvable  = errors.New("attribut introuvable")
+	ErrAttributInvalide     = errors.New("attribut invalide")
+	ErrValeursAttributs     = errors.New("valeurs d'attributs invalides")
+	ErrAttributIncompatible = errors.New("modification incompatible avec les valeurs déjà saisies")
+)
+
+var codeAttribut = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+const selectAttributs = `
+	SELECT a.id, a.categorie_id, a.code, a.libelle, a.type, COALESCE(a.unite, '') AS unite,
+	       a.valeurs, a.obligatoire, a.ordre, a.created_at, a.updated_at
+	FROM categorie_attributs a`
+
+func scannerAttributs(rows *sql.Rows) ([]models.AttributCategorie, error) {
+	attributs := []models.AttributCategorie{}
+	for rows.Next() {
+		var a models.AttributCategorie
+		err := rows.Scan(&a.ID, &a.CategorieID, &a.Code, &a.Libelle, &a.Type, &a.Unite,
+			pq.Array(&a.Valeurs), &a.Obligatoire, &a.Ordre, &a.CreatedAt, &a.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("erreur lors du scan des attributs : %v", err)
+		}
+		attributs = append(attributs, a)
+	}
+	return attributs, rows.Err()
+}
+
+// AttributsApplicables retourne le schéma d'attributs d'une catégorie : ses attributs
+// et ceux de ses catégories parentes. Pour un même code, la définition la plus proche l'emporte.
+func AttributsApplicables(db sqlx.Queryer, categorieID string) ([]models.AttributCategorie, error) {
+	rows, err := db.Query(`
+		WITH RECURSIVE ancetres AS (
+			SELECT id, parent_id, 0 AS profondeur FROM categories WHERE id = $1
+			UNION ALL
+			SELECT c.id, c.parent_id, a.profondeur + 1
+			FROM categories c JOIN ancetres a ON c.id = a.parent_id
+		)
+		SELECT id, categorie_id, code, libelle, type, unite, valeurs, obligatoire, ordre, created_at, updated_at
+		FROM (
+			SELECT DISTINCT ON (a.code) a.id, a.categorie_id, a.code, a.libelle, a.type,
+			       COALESCE(a.unite, '') AS unite, a.valeurs, a.obligatoire, a.ordre, a.created_at, a.updated_at
+			FROM categorie_attributs a
+			JOIN ancetres an ON an.id = a.categorie_id
+			ORDER BY a.code, an.profondeur
+		) schema
+		ORDER BY ordre, libelle`, categorieID)
+	if err != nil {
+		return nil, fmt.Errorf("erreur lors de la récupération des attributs : %v", err)
+	}
+	defer rows.Close()
+	return scannerAttributs(rows)
+}
+
+// ValiderAttributs contrôle les valeurs d'un produit au regard du schéma de sa catégorie
+// et retourne les valeurs normalisées. Tous les problèmes sont rapportés dans une seule erreur.
+func ValiderAttributs(schema []models.AttributCategorie, valeurs map[string]interface{}) (map[string]interface{}, error) {
+	parCode := make(map[string]models.AttributCategorie, len(schema))
+	for _, a := range schema {
+		parCode[a.Code] = a
+	}
+
+	var problemes []string
+	normalisees := make(map[string]interface{}, len(valeurs))
+
+	codes := make([]string, 0, len(valeurs))
+	for code := range valeurs {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	for _, code := range codes {
+		valeur := valeurs[code]
+		attribut, ok := parCode[code]
+		if !ok {
+			problemes = append(problemes, fmt.Sprintf("%s : attribut inconnu pour cette catégorie", code))
+			continue
+		}
+		if valeur == nil {
+			continue // null retire la valeur
+		}
+
+		switch attribut.Type {
+		case models.AttributEnum:
+			texte, ok := valeur.(string)
+			if !ok || !contient(attribut.Valeurs, texte) {
+				problemes = append(problemes, fmt.Sprintf("%s : valeur attendue parmi %s", code, strings.Join(attribut.Valeurs, ", ")))
+				continue
+			}
+		case models.AttributNombre:
+			if _, ok := valeur.(float64); !ok {
+				problemes = append(problemes, fmt.Sprintf("%s : nombre attendu", code))
+				continue
+			}
+		case models.AttributBooleen:
+			if _, ok := valeur.(bool); !ok {
+				problemes = append(problemes, fmt.Sprintf("%s : booléen attendu", code))
+				continue
+			}
+		}
+		normalisees[code] = valeur
+	}
+
+	for _, a := range schema {
+		if _, ok := normalisees[a.Code]; a.Obligatoire && !ok {
+			problemes = append(problemes, fmt.Sprintf("%s : attribut obligatoire", a.Code))
+		}
+	}
+
+	if len(problemes) > 0 {
+		return nil, fmt.Errorf("%w : %s", ErrValeursAttributs, strings.Join(problemes, " ; "))
+	}
+	return normalisees, nil
+}
+
+func contient(valeurs []string, valeur string) bool {
+	for _, v := range valeurs {
+		if v == valeur {
+			return true
+		}
+	}
+	return false
+}
+
+func validerAttribut(attribut *models.AttributCategorie) error {
+	attribut.Code = strings.TrimSpace(attribut.Code)
+	attribut.Libelle = strings.TrimSpace(attribut.Libelle)
+	if !codeAttribut.MatchString(attribut.Code) {
+		return fmt.Errorf("%w : le code ne doit contenir que des minuscules, chiffres et _", ErrAttributInvalide)
+	}
+	if attribut.Libelle == "" {
+		return fmt.Errorf("%w : le libellé est obligatoire", ErrAttributInvalide)
+	}
+
+	switch attribut.Type {
+	case models.AttributEnum:
+		if len(attribut.Valeurs) == 0 {
+			return fmt.Errorf("%w : un enum doit lister ses valeurs", ErrAttributInvalide)
+		}
+		attribut.Unite = ""
+	case models.AttributNombre:
+		attribut.Valeurs = []string{}
+	case models.AttributBooleen:
+		attribut.Valeurs = []string{}
+		attribut.Unite = ""
+	default:
+		return fmt.Errorf("%w : type %q inconnu (enum, nombre ou booleen)", ErrAttributInvalide, attribut.Type)
+	}
+	return nil
+}
+
+// ListerAttributs retourne le schéma d'attributs applicable à la catégorie, parents compris.
+func (r *CategoryRepository) ListerAttributs(categorieID string) ([]models.AttributCategorie, error) {
+	return AttributsApplicables(r.db, categorieID)
+}
+
+// CreerAttribut ajoute un attribut à la catégorie.
+func (r *CategoryRepository) CreerAttribut(categorieID string, attribut models.AttributCategorie) (*models.AttributCategorie, error) {
+	if err := validerAttribut(&attribut); err != nil {
+		return nil, err
+	}
+
+	if err := verifierCompatibilite(r.db, categorieID, nil, attribut); err != nil {
+		return nil, err
+	}
+
+	var id string
+	err := r.db.QueryRow(`
+		INSERT INTO categorie_attributs (categorie_id, code, libelle, type, unite, valeurs, obligatoire, ordre)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8)
+		RETURNING id`,
+		categorieID, attribut.Code, attribut.Libelle, attribut.Type, attribut.Unite,
+		pq.Array(attribut.Valeurs), attribut.Obligatoire, attribut.Ordre).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("erreur lors de la création de l'attribut : %v", err)
+	}
+	return r.GetAttribut(id)
+}
+
+// GetAttribut retourne un attribut par son ID.
+func (r *CategoryRepository) GetAttribut(id string) (*models.AttributCategorie, error) {
+	rows, err := r.db.Query(selectAttributs+" WHERE a.id = $1", id)
+	if err != nil {
+		return nil, fmt.Errorf("erreur lors de la récupération de l'attribut : %v", err)
+	}
+	defer rows.Close()
+
+	attributs, err := scannerAttributs(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(attributs) == 0 {
+		return nil, ErrAttributIntrouvable
+	}
+	return &attributs[0], nil
+}
+
+// ModifierAttribut met à jour la définition d'un attribut. Le code, clé des valeurs
+// déjà enregistrées sur les produits, ne peut pas changer.
+func (r *CategoryRepository) ModifierAttribut(id string, attribut models.AttributCategorie) (*models.AttributCategorie, error) {
+	existant, err := r.GetAttribut(id)
+	if err != nil {
+		return nil, err
+	}
+	attribut.Code = existant.Code
+	if err := validerAttribut(&attribut); err != nil {
+		return nil, err
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("erreur lors du début de la transaction : %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT 1 FROM categorie_attributs WHERE id = $1 FOR UPDATE`, id); err != nil {
+		return nil, fmt.Errorf("erreur lors du verrouillage de l'attribut : %v", err)
+	}
+	if err := verifierCompatibilite(tx, existant.CategorieID, existant, attribut); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE categorie_attributs
+		SET libelle = $1, type = $2, unite = NULLIF($3, ''), valeurs = $4, obligatoire = $5, ordre = $6, updated_at = NOW()
+		WHERE id = $7`,
+		attribut.Libelle, attribut.Type, attribut.Unite, pq.Array(attribut.Valeurs),
+		attribut.Obligatoire, attribut.Ordre, id)
+	if err != nil {
+		return nil, fmt.Errorf("erreur lors de la mise à jour de l'attribut : %v", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("erreur lors de la validation de la transaction : %v", err)
+	}
+	return r.GetAttribut(id)
+}
+
+// verifierCompatibilite refuse une définition que les produits de la catégorie et de ses sous-catégories
+// ne respecteraient plus : changement de type alors que des valeurs existent, valeur d'enum retirée
+// mais encore utilisée, ou attribut rendu obligatoire alors que des produits n'ont pas de valeur.
+// ancien vaut nil pour un nouvel attribut.
+func verifierCompatibilite(q sqlx.Queryer, categorieID string, ancien *models.AttributCategorie, attribut models.AttributCategorie) error {
+	const produitsSousArbre = `
+		WITH RECURSIVE descendantes AS (
+			SELECT id FROM categories WHERE id = $1
+			UNION
+			SELECT c.id FROM categories c JOIN descendantes d ON c.parent_id = d.id
+		)
+		SELECT COUNT(*) FROM produits p
+		WHERE p.categorie_id IN (SELECT id FROM descendantes) AND `
+
+	compter := func(condition string, args ...interface{}) (int, error) {
+		var n int
+		err := q.QueryRowx(produitsSousArbre+condition, append([]interface{}{categorieID, attribut.Code}, args...)...).Scan(&n)
+		if err != nil {
+			return 0, fmt.Errorf("erreur lors du contrôle des valeurs de l'attribut : %v", err)
+		}
+		return n, nil
+	}
+
+	if ancien != nil && ancien.Type != attribut.Type {
+		n, err := compter(`p.attributs ? $2`)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return fmt.Errorf("%w : %d produit(s) ont une valeur de type %s pour %s", ErrAttributIncompatible, n, ancien.Type, attribut.Code)
+		}
+	} else if attribut.Type == models.AttributEnum {
+		n, err := compter(`p.attributs ? $2 AND NOT (p.attributs->>$2::text = ANY($3))`, pq.Array(attribut.Valeurs))
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return fmt.Errorf("%w : %d produit(s) utilisent une valeur de %s absente de la liste", ErrAttributIncompatible, n, attribut.Code)
+		}
+	}
+
+	if attribut.Obligatoire && (ancien == nil || !ancien.Obligatoire) {
+		n, err := compter(`NOT p.attributs ? $2`)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return fmt.Errorf("%w : %d produit(s) n'ont pas de valeur pour %s, qui ne peut pas devenir obligatoire", ErrAttributIncompatible, n, attribut.Code)
+		}
+	}
+	return nil
+}
+
+// SupprimerAttribut supprime la définition ; les valeurs déjà saisies sur les produits sont retirées.
+func (r *CategoryRepository) SupprimerAttribut(id string) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("erreur lors du début de la transaction : %v", err)
+	}
+	defer tx.Rollback()
+
+	var categorieID, code string
+	err = tx.QueryRow(`DELETE FROM categorie_attributs WHERE id = $1 RETURNING categorie_id, code`, id).Scan(&categorieID, &code)
+	if err == sql.ErrNoRows {
+		return ErrAttributIntrouvable
+	}
+	if err != nil {
+		return fmt.Errorf("erreur lors de la suppression de l'attribut : %v", err)
+	}
+
+	// Retirer la valeur des produits de la catégorie et de ses sous-catégories,
+	// sauf si un autre attribut de même code reste applicable
+	_, err = tx.Exec(`
+		WITH RECURSIVE descendantes AS (
+			SELECT id FROM categories WHERE id = $1
+			UNION
+			SELECT c.id FROM categories c JOIN descendantes d ON c.parent_id = d.id
+		)
+		UPDATE produits p SET attributs = p.attributs - $2, version = p.version + 1
+		WHERE p.categorie_id IN (SELECT id FROM descendantes)
+		  AND p.attributs ? $2
+		  AND NOT EXISTS (
+			WITH RECURSIVE ancetres AS (
+				SELECT id, parent_id FROM categories WHERE id = p.categorie_id
+				UNION
+				SELECT c.id, c.parent_id FROM categories c JOIN ancetres a ON c.id = a.parent_id
+			)
+			SELECT 1 FROM categorie_attributs a JOIN ancetres an ON an.id = a.categorie_id WHERE a.code = $2
+		  )`, categorieID, code)
+	if err != nil {
+		return fmt.Errorf("erreur lors du retrait des valeurs de l'attribut : %v", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("erreur lors de la validation de la transaction : %v", err)
+	}
+	return nil
+}
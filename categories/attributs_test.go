@@ -0,0 +1,99 @@
+package categories
+
+import (
+	"ecommerce-api/models"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var schemaTelephone = []models.AttributCategorie{
+	{Code: "couleur", Type: models.AttributEnum, Valeurs: []string{"noir", "blanc"}, Obligatoire: true},
+	{Code: "stockage", Type: models.AttributNombre, Unite: "Go"},
+	{Code: "double_sim", Type: models.AttributBooleen},
+}
+
+func TestValiderAttributs(t *testing.T) {
+	cas := []struct {
+		nom     string
+		valeurs map[string]interface{}
+		attendu map[string]interface{}
+		erreur  bool
+	}{
+		{
+			nom:     "valeurs valides",
+			valeurs: map[string]interface{}{"couleur": "noir", "stockage": 128.0, "double_sim": true},
+			attendu: map[string]interface{}{"couleur": "noir", "stockage": 128.0, "double_sim": true},
+		},
+		{
+			nom:     "facultatifs absents",
+			valeurs: map[string]interface{}{"couleur": "blanc"},
+			attendu: map[string]interface{}{"couleur": "blanc"},
+		},
+		{
+			nom:     "null retire la valeur",
+			valeurs: map[string]interface{}{"couleur": "noir", "stockage": nil},
+			attendu: map[string]interface{}{"couleur": "noir"},
+		},
+		{nom: "obligatoire manquant", valeurs: map[string]interface{}{"stockage": 64.0}, erreur: true},
+		{nom: "obligatoire à null", valeurs: map[string]interface{}{"couleur": nil}, erreur: true},
+		{nom: "valeur hors enum", valeurs: map[string]interface{}{"couleur": "rouge"}, erreur: true},
+		{nom: "enum non texte", valeurs: map[string]interface{}{"couleur": 1.0}, erreur: true},
+		{nom: "nombre en texte", valeurs: map[string]interface{}{"couleur": "noir", "stockage": "128"}, erreur: true},
+		{nom: "booléen en texte", valeurs: map[string]interface{}{"couleur": "noir", "double_sim": "oui"}, erreur: true},
+		{nom: "attribut inconnu", valeurs: map[string]interface{}{"couleur": "noir", "poids": 180.0}, erreur: true},
+	}
+	for _, c := range cas {
+		t.Run(c.nom, func(t *testing.T) {
+			normalisees, err := ValiderAttributs(schemaTelephone, c.valeurs)
+			if c.erreur {
+				if !errors.Is(err, ErrValeursAttributs) {
+					t.Fatalf("erreur %v, attendu ErrValeursAttributs", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("erreur inattendue : %v", err)
+			}
+			if !reflect.DeepEqual(normalisees, c.attendu) {
+				t.Errorf("valeurs %v, attendu %v", normalisees, c.attendu)
+			}
+		})
+	}
+}
+
+func TestValiderAttributsRegroupeLesProblemes(t *testing.T) {
+	_, err := ValiderAttributs(schemaTelephone, map[string]interface{}{"stockage": "x", "poids": 1.0})
+	attendu := "valeurs d'attributs invalides : poids : attribut inconnu pour cette catégorie ; " +
+		"stockage : nombre attendu ; couleur : attribut obligatoire"
+	if err == nil || err.Error() != attendu {
+		t.Errorf("erreur %q, attendu %q", err, attendu)
+	}
+}
+
+func TestValiderAttribut(t *testing.T) {
+	cas := []struct {
+		nom      string
+		attribut models.AttributCategorie
+		valide   bool
+	}{
+		{"enum", models.AttributCategorie{Code: "couleur", Libelle: "Couleur", Type: models.AttributEnum, Valeurs: []string{"noir"}}, true},
+		{"nombre", models.AttributCategorie{Code: "ecran_2", Libelle: " Écran ", Type: models.AttributNombre, Unite: "pouces"}, true},
+		{"booléen", models.AttributCategorie{Code: "5g", Libelle: "5G", Type: models.AttributBooleen}, true},
+		{"enum sans valeurs", models.AttributCategorie{Code: "couleur", Libelle: "Couleur", Type: models.AttributEnum}, false},
+		{"code en majuscules", models.AttributCategorie{Code: "Couleur", Libelle: "Couleur", Type: models.AttributBooleen}, false},
+		{"libellé vide", models.AttributCategorie{Code: "couleur", Libelle: "  ", Type: models.AttributBooleen}, false},
+		{"type inconnu", models.AttributCategorie{Code: "couleur", Libelle: "Couleur", Type: "texte"}, false},
+	}
+	for _, c := range cas {
+		t.Run(c.nom, func(t *testing.T) {
+			err := validerAttribut(&c.attribut)
+			if c.valide && err != nil {
+				t.Fatalf("erreur inattendue : %v", err)
+			}
+			if !c.valide && !errors.Is(err, ErrAttributInvalide) {
+				t.Fatalf("erreur %v, attendu ErrAttributInvalide", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package categories
+
+import (
+	"ecommerce-api/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrMemeCategorie        = errors.New("les catégories source et cible doivent être différentes")
+	ErrCategorieIntrouvable = errors.New("catégorie source ou cible introuvable")
+	ErrAttributsCible       = errors.New("des produits ne respectent pas le schéma d'attributs de la catégorie cible")
+)
+
+// ErreurDeplacement liste les produits qui empêchent le déplacement ; elle enveloppe ErrAttributsCible.
+type ErreurDeplacement struct {
+	Produits []models.ProduitRejete
+}
+
+func (e *ErreurDeplacement) Error() string {
+	return fmt.Sprintf("%v (%d produit(s))", ErrAttributsCible, len(e.Produits))
+}
+
+func (e *ErreurDeplacement) Unwrap() error { return ErrAttributsCible }
+
+// produitDeplace est un produit déplacé avec ses valeurs d'attributs.
+type produitDeplace struct {
+	id        string
+	nom       string
+	attributs map[string]interface{}
+}
+
+// controlerAttributsDeplaces retire les valeurs hors du schéma de la cible, puis valide le reste
+// avec ValiderAttributs. Retourne les valeurs à enregistrer pour les produits qui ont perdu
+// des valeurs, et les produits rejetés (valeur invalide ou attribut obligatoire manquant).
+func controlerAttributsDeplaces(schema []models.AttributCategorie, produits []produitDeplace) (map[string]map[string]interface{}, []models.ProduitRejete) {
+	codes := make(map[string]bool, len(schema))
+	for _, a := range schema {
+		codes[a.Code] = true
+	}
+
+	nettoyes := make(map[string]map[string]interface{})
+	var rejets []models.ProduitRejete
+	for _, p := range produits {
+		valeurs := make(map[string]interface{}, len(p.attributs))
+		for code, v := range p.attributs {
+			if codes[code] {
+				valeurs[code] = v
+			}
+		}
+		normalisees, err := ValiderAttributs(schema, valeurs)
+		if err != nil {
+			rejets = append(rejets, models.ProduitRejete{ID: p.id, Nom: p.nom, Message: err.Error()})
+			continue
+		}
+		if len(normalisees) != len(p.attributs) {
+			nettoyes[p.id] = normalisees
+		}
+	}
+	return nettoyes, rejets
+}
+
+// DeplacerProduits rattache tous les produits de la catégorie source à la catégorie cible,
+// en une seule transaction. Avec fusionner, les sous-catégories et les attributs propres à
+// la source sont repris par la cible, puis la source est supprimée.
+// Les valeurs d'attributs qui ne relèvent pas du schéma de la cible sont retirées des produits déplacés ;
+// si une valeur restante est invalide ou qu'un attribut obligatoire manque, rien n'est déplacé
+// et une *ErreurDeplacement liste les produits concernés.
+func (r *CategoryRepository) DeplacerProduits(sourceID, cibleID string, fusionner bool) (*models.ResultatDeplacement, error) {
+	if sourceID == cibleID {
+		return nil, ErrMemeCategorie
+	}
+	resultat := &models.ResultatDeplacement{SourceID: sourceID, CibleID: cibleID}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("erreur lors du début de la transaction : %v", err)
+	}
+	defer tx.Rollback()
+
+	// Verrouiller les deux catégories pendant le déplacement
+	var verrouillees int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FROM (SELECT id FROM categories WHERE id IN ($1, $2) ORDER BY id FOR UPDATE) c`,
+		sourceID, cibleID).Scan(&verrouillees)
+	if err != nil {
+		return nil, fmt.Errorf("erreur lors du verrouillage des catégories : %v", err)
+	}
+	if verrouillees != 2 {
+		return nil, ErrCategorieIntrouvable
+	}
+
+	if fusionner {
+		// La cible ne peut pas être une sous-catégorie de la source, qui va disparaître
+		var descendante bool
+		err = tx.QueryRow(`
+			WITH RECURSIVE ancetres AS (
+				SELECT id, parent_id FROM categories WHERE id = $1
+				UNION
+				SELECT c.id, c.parent_id FROM categories c JOIN ancetres a ON c.id = a.parent_id
+			)
+			SELECT EXISTS (SELECT 1 FROM ancetres WHERE id = $2)`, cibleID, sourceID).Scan(&descendante)
+		if err != nil {
+			return nil, fmt.Errorf("erreur lors de la vérification de la hiérarchie : %v", err)
+		}
+		if descendante {
+			return nil, ErrCycleCategorie
+		}
+
+		// Les attributs de la source absents du schéma de la cible passent à la cible
+		result, err := tx.Exec(`
+			UPDATE categorie_attributs SET categorie_id = $2, updated_at = NOW()
+			WHERE categorie_id = $1
+			  AND code NOT IN (
+				WITH RECURSIVE ancetres AS (
+					SELECT id, parent_id FROM categories WHERE id = $2
+					UNION
+					SELECT c.id, c.parent_id FROM categories c JOIN ancetres a ON c.id = a.parent_id
+				)
+				SELECT a.code FROM categorie_attributs a JOIN ancetres an ON an.id = a.categorie_id
+			  )`, sourceID, cibleID)
+		if err != nil {
+			return nil, fmt.Errorf("erreur lors de la reprise des attributs : %v", err)
+		}
+		resultat.AttributsDeplaces, _ = result.RowsAffected()
+	}
+
+	rows, err := tx.Query(`
+		UPDATE produits SET categorie_id = $2, updated_at = NOW(), version = version + 1
+		WHERE categorie_id = $1
+		RETURNING id, nom, attributs`, sourceID, cibleID)
+	if err != nil {
+		return nil, fmt.Errorf("erreur lors du déplacement des produits : %v", err)
+	}
+	var deplaces []produitDeplace
+	for rows.Next() {
+		var p produitDeplace
+		var attributs []byte
+		if err := rows.Scan(&p.id, &p.nom, &attributs); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("erreur lors du déplacement des produits : %v", err)
+		}
+		if err := json.Unmarshal(attributs, &p.attributs); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("attributs invalides pour le produit %s : %v", p.id, err)
+		}
+		deplaces = append(deplaces, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("erreur lors du déplacement des produits : %v", err)
+	}
+	resultat.ProduitsDeplaces = int64(len(deplaces))
+
+	if fusionner {
+		result, err := tx.Exec(`
+			UPDATE categories SET parent_id = $2, updated_at = NOW(), version = version + 1
+			WHERE parent_id = $1`, sourceID, cibleID)
+		if err != nil {
+			return nil, fmt.Errorf("erreur lors du rattachement des sous-catégories : %v", err)
+		}
+		resultat.SousCategoriesDeplacees, _ = result.RowsAffected()
+
+		if _, err := tx.Exec(`DELETE FROM categories WHERE id = $1`, sourceID); err != nil {
+			return nil, fmt.Errorf("échec de la suppression de la catégorie : %v", err)
+		}
+		resultat.SourceSupprimee = true
+	}
+
+	// Revalider les produits déplacés selon le schéma de la cible (fusion comprise)
+	if len(deplaces) > 0 {
+		schema, err := AttributsApplicables(tx, cibleID)
+		if err != nil {
+			return nil, err
+		}
+		nettoyes, rejets := controlerAttributsDeplaces(schema, deplaces)
+		if len(rejets) > 0 {
+			return nil, &ErreurDeplacement{Produits: rejets}
+		}
+
+		for id, valeurs := range nettoyes {
+			attributs, err := json.Marshal(valeurs)
+			if err != nil {
+				return nil, fmt.Errorf("erreur lors du nettoyage des attributs : %v", err)
+			}
+			_, err = tx.Exec(`UPDATE produits SET attributs = $1, version = version + 1 WHERE id = $2`, attributs, id)
+			if err != nil {
+				return nil, fmt.Errorf("erreur lors du nettoyage des attributs : %v", err)
+			}
+		}
+		resultat.ProduitsAttributsRetires = int64(len(nettoyes))
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("erreur lors de la validation de la transaction : %v", err)
+	}
+	return resultat, nil
+}
@@ -0,0 +1,78 @@
+package categories
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestControlerAttributsDeplaces(t *testing.T) {
+	produits := []produitDeplace{
+		// Conforme à la cible : rien à enregistrer
+		{id: "conforme", nom: "A", attributs: map[string]interface{}{"couleur": "noir", "stockage": 64.0}},
+		// Valeur hors schéma de la cible : retirée
+		{id: "nettoye", nom: "B", attributs: map[string]interface{}{"couleur": "blanc", "taille": "M"}},
+		// Attribut obligatoire de la cible manquant
+		{id: "sans_couleur", nom: "C", attributs: map[string]interface{}{"stockage": 128.0}},
+		// Code commun mais valeur hors de l'enum de la cible
+		{id: "enum", nom: "D", attributs: map[string]interface{}{"couleur": "rouge"}},
+		// Code commun mais type différent dans la cible
+		{id: "type", nom: "E", attributs: map[string]interface{}{"couleur": "noir", "double_sim": "oui"}},
+		// Un attribut hors schéma ne masque pas l'obligatoire manquant
+		{id: "vide", nom: "F", attributs: map[string]interface{}{"taille": "L"}},
+	}
+
+	nettoyes, rejets := controlerAttributsDeplaces(schemaTelephone, produits)
+
+	attendus := map[string]map[string]interface{}{"nettoye": {"couleur": "blanc"}}
+	if !reflect.DeepEqual(nettoyes, attendus) {
+		t.Errorf("valeurs nettoyées %v, attendu %v", nettoyes, attendus)
+	}
+
+	var ids []string
+	for _, r := range rejets {
+		ids = append(ids, r.ID)
+		if r.Message == "" || r.Nom == "" {
+			t.Errorf("rejet incomplet : %+v", r)
+		}
+	}
+	if attendu := []string{"sans_couleur", "enum", "type", "vide"}; !reflect.DeepEqual(ids, attendu) {
+		t.Errorf("produits rejetés %v, attendu %v", ids, attendu)
+	}
+}
+
+func TestErreurDeplacement(t *testing.T) {
+	var err error = &ErreurDeplacement{}
+	if !errors.Is(err, ErrAttributsCible) {
+		t.Error("ErreurDeplacement doit envelopper ErrAttributsCible")
+	}
+}
+
+// Les demandes invalides sont rejetées avant tout accès à la base.
+func TestHandleDeplacerProduitsDemandeInvalide(t *testing.T) {
+	h := NewCategoryHandler(NewCategoryRepository(nil))
+	r := chi.NewRouter()
+	r.Post("/categories/{id}/deplacer", h.HandleDeplacerProduits)
+
+	const id = "6b8e2f0a-1c3d-4e5f-8a9b-0c1d2e3f4a5b"
+	cas := []struct {
+		nom, chemin, corps string
+	}{
+		{"source invalide", "/categories/abc/deplacer", `{"cible_id": "` + id + `"}`},
+		{"cible invalide", "/categories/" + id + "/deplacer", `{"cible_id": "abc"}`},
+		{"corps illisible", "/categories/" + id + "/deplacer", `{`},
+		{"même catégorie", "/categories/" + id + "/deplacer", `{"cible_id": "` + id + `", "fusionner": true}`},
+	}
+	for _, c := range cas {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, c.chemin, strings.NewReader(c.corps)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s : statut %d, attendu 400 (%s)", c.nom, rec.Code, rec.Body.String())
+		}
+	}
+}
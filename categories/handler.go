@@ -2,9 +2,13 @@ package categories
 
 import (
     "encoding/json"
+    "errors"
     "fmt"
+    "io"
     "net/http"
+    "ecommerce-api/admin"
     "ecommerce-api/models"
+    "ecommerce-api/pkg/utils"
     "github.com/go-chi/chi/v5"
     "github.com/google/uuid"
 )
@@ -25,7 +29,16 @@ func (h *CategoryHandler) HandleCreateCategory(w http.ResponseWriter, r *http.Re
         return
     }
     
-    if err := h.repo.CreateCategory(category); err != nil {
+    if category.ParentID != nil && *category.ParentID == "" {
+        category.ParentID = nil
+    }
+
+    err := h.repo.CreateCategory(category)
+    if errors.Is(err, ErrParentIntrouvable) || errors.Is(err, ErrCategorieInvalide) {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    if err != nil {
         http.Error(w, err.Error(), http.StatusInternalServerError)
         return
     }
@@ -37,9 +50,9 @@ func (h *CategoryHandler) HandleCreateCategory(w http.ResponseWriter, r *http.Re
     })
 }
 
-// HandleGetAllCategories - Liste toutes les catégories
+// HandleGetAllCategories - Liste les catégories visibles (toutes pour un administrateur)
 func (h *CategoryHandler) HandleGetAllCategories(w http.ResponseWriter, r *http.Request) {
-    categories, err := h.repo.GetAllCategories()
+    categories, err := h.repo.GetAllCategories(admin.EstAdmin(r))
     if err != nil {
         http.Error(w, fmt.Sprintf("Échec de la récupération des catégories : %v", err), http.StatusInternalServerError)
         return
@@ -49,6 +62,18 @@ func (h *CategoryHandler) HandleGetAllCategories(w http.ResponseWriter, r *http.
     json.NewEncoder(w).Encode(categories)
 }
 
+// HandleGetArbre - Retourne l'arborescence des catégories visibles (complète pour un administrateur)
+func (h *CategoryHandler) HandleGetArbre(w http.ResponseWriter, r *http.Request) {
+    arbre, err := h.repo.GetArbre(admin.EstAdmin(r))
+    if err != nil {
+        http.Error(w, fmt.Sprintf("Échec de la récupération des catégories : %v", err), http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(arbre)
+}
+
 // HandleGetCategoryByID - Récupère une catégorie par ID
 func (h *CategoryHandler) HandleGetCategoryByID(w http.ResponseWriter, r *http.Request) {
     // Extraction de l'ID
@@ -75,12 +100,17 @@ func (h *CategoryHandler) HandleGetCategoryByID(w http.ResponseWriter, r *http.R
         http.Error(w, fmt.Sprintf("Catégorie non trouvée : %v", err), http.StatusNotFound)
         return
     }
+    if !category.Visible && !admin.EstAdmin(r) {
+        http.Error(w, "Catégorie non trouvée", http.StatusNotFound)
+        return
+    }
     
+    w.Header().Set("ETag", utils.ETag(category.Version))
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(category)
 }
 
-// HandleUpdateCategory - Met à jour une catégorie
+// HandleUpdateCategory - Met à jour une catégorie (écriture conditionnelle via If-Match)
 func (h *CategoryHandler) HandleUpdateCategory(w http.ResponseWriter, r *http.Request) {
     // Extraction de l'ID
     id := chi.URLParam(r, "id")
@@ -112,10 +142,22 @@ func (h *CategoryHandler) HandleUpdateCategory(w http.ResponseWriter, r *http.Re
         http.Error(w, "Catégorie non trouvée", http.StatusNotFound)
         return
     }
+
+    versionAttendue, ok := utils.VersionAttendue(w, r)
+    if !ok {
+        return
+    }
     
-    // Décodage du corps de la requête
+    // Décodage du corps de la requête ; les clés présentes sont relevées pour distinguer
+    // une date d'activation absente (inchangée) d'une date mise à null (supprimée)
+    corps, err := io.ReadAll(r.Body)
+    if err != nil {
+        http.Error(w, "Requête invalide", http.StatusBadRequest)
+        return
+    }
     var updatedCategory models.Category
-    if err := json.NewDecoder(r.Body).Decode(&updatedCategory); err != nil {
+    var champs map[string]json.RawMessage
+    if json.Unmarshal(corps, &updatedCategory) != nil || json.Unmarshal(corps, &champs) != nil {
         http.Error(w, "Requête invalide", http.StatusBadRequest)
         return
     }
@@ -127,19 +169,38 @@ func (h *CategoryHandler) HandleUpdateCategory(w http.ResponseWriter, r *http.Re
     if updatedCategory.Nom == "" {
         updatedCategory.Nom = existingCategory.Nom
     }
-    if updatedCategory.NombreProduits == 0 {
-        updatedCategory.NombreProduits = existingCategory.NombreProduits
-    }
     if updatedCategory.Statut == "" {
         updatedCategory.Statut = existingCategory.Statut
     }
+    if _, ok := champs["active_du"]; !ok {
+        updatedCategory.ActiveDu = existingCategory.ActiveDu
+    }
+    if _, ok := champs["active_jusqu_au"]; !ok {
+        updatedCategory.ActiveJusquAu = existingCategory.ActiveJusquAu
+    }
+    // parent_id absent : parent inchangé ; parent_id vide : la catégorie devient racine
+    if updatedCategory.ParentID == nil {
+        updatedCategory.ParentID = existingCategory.ParentID
+    } else if *updatedCategory.ParentID == "" {
+        updatedCategory.ParentID = nil
+    }
     
     // Exécution de la mise à jour
-    if err := h.repo.UpdateCategory(updatedCategory); err != nil {
+    version, err := h.repo.UpdateCategory(updatedCategory, versionAttendue)
+    if errors.Is(err, utils.ErrVersionPerimee) {
+        http.Error(w, err.Error(), http.StatusPreconditionFailed)
+        return
+    }
+    if errors.Is(err, ErrParentIntrouvable) || errors.Is(err, ErrCycleCategorie) || errors.Is(err, ErrCategorieInvalide) {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    if err != nil {
         http.Error(w, fmt.Sprintf("Échec de la mise à jour : %v", err), http.StatusInternalServerError)
         return
     }
     
+    w.Header().Set("ETag", utils.ETag(version))
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(map[string]string{
         "message": "Catégorie mise à jour avec succès",
@@ -147,6 +208,72 @@ func (h *CategoryHandler) HandleUpdateCategory(w http.ResponseWriter, r *http.Re
     })
 }
 
+// HandleRecompter - Recalcule les compteurs de produits de toutes les catégories
+func (h *CategoryHandler) HandleRecompter(w http.ResponseWriter, r *http.Request) {
+    corrigees, err := h.repo.Recompter()
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "status": "success",
+        "data":   map[string]int64{"categories_corrigees": corrigees},
+    })
+}
+
+// HandleDeplacerProduits - Déplace les produits d'une catégorie vers une autre, avec fusion optionnelle
+func (h *CategoryHandler) HandleDeplacerProduits(w http.ResponseWriter, r *http.Request) {
+    id := chi.URLParam(r, "id")
+    if _, err := uuid.Parse(id); err != nil {
+        http.Error(w, "Format d'ID invalide", http.StatusBadRequest)
+        return
+    }
+
+    var demande struct {
+        CibleID   string `json:"cible_id"`
+        Fusionner bool   `json:"fusionner"` // Reprend sous-catégories et attributs puis supprime la source
+    }
+    if err := json.NewDecoder(r.Body).Decode(&demande); err != nil {
+        http.Error(w, "Requête invalide", http.StatusBadRequest)
+        return
+    }
+    if _, err := uuid.Parse(demande.CibleID); err != nil {
+        http.Error(w, "cible_id invalide", http.StatusBadRequest)
+        return
+    }
+
+    resultat, err := h.repo.DeplacerProduits(id, demande.CibleID, demande.Fusionner)
+    var rejet *ErreurDeplacement
+    switch {
+    case errors.As(err, &rejet):
+        w.Header().Set("Content-Type", "application/json")
+        w.WriteHeader(http.StatusConflict)
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "status":  "error",
+            "message": ErrAttributsCible.Error(),
+            "data":    rejet.Produits,
+        })
+        return
+    case errors.Is(err, ErrCategorieIntrouvable):
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    case errors.Is(err, ErrMemeCategorie), errors.Is(err, ErrCycleCategorie):
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    case err != nil:
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "status": "success",
+        "data":   resultat,
+    })
+}
+
 // HandleDeleteCategory - Supprime une catégorie
 func (h *CategoryHandler) HandleDeleteCategory(w http.ResponseWriter, r *http.Request) {
     // Extraction de l'ID
@@ -168,7 +295,12 @@ func (h *CategoryHandler) HandleDeleteCategory(w http.ResponseWriter, r *http.Re
         return
     }
     
-    if err := h.repo.DeleteCategory(id); err != nil {
+    err = h.repo.DeleteCategory(id)
+    if errors.Is(err, ErrCategorieNonVide) || errors.Is(err, ErrCategorieAvecProduits) {
+        http.Error(w, err.Error(), http.StatusConflict)
+        return
+    }
+    if err != nil {
         http.Error(w, fmt.Sprintf("Échec de la suppression : %v", err), http.StatusInternalServerError)
         return
     }
@@ -178,4 +310,126 @@ func (h *CategoryHandler) HandleDeleteCategory(w http.ResponseWriter, r *http.Re
         "message": "Catégorie supprimée avec succès",
         "status":  "success",
     })
-}
\ No newline at end of file
+}
+// HandleListerAttributs - Retourne le schéma d'attributs de la catégorie, attributs hérités compris
+func (h *CategoryHandler) HandleListerAttributs(w http.ResponseWriter, r *http.Request) {
+    id := chi.URLParam(r, "id")
+    if _, err := uuid.Parse(id); err != nil {
+        http.Error(w, "Format d'ID invalide", http.StatusBadRequest)
+        return
+    }
+
+    attributs, err := h.repo.ListerAttributs(id)
+    if err != nil {
+        http.Error(w, fmt.Sprintf("Échec de la récupération des attributs : %v", err), http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(attributs)
+}
+
+// HandleCreerAttribut - Ajoute un attribut au schéma de la catégorie
+func (h *CategoryHandler) HandleCreerAttribut(w http.ResponseWriter, r *http.Request) {
+    id := chi.URLParam(r, "id")
+    if _, err := uuid.Parse(id); err != nil {
+        http.Error(w, "Format d'ID invalide", http.StatusBadRequest)
+        return
+    }
+
+    var attribut models.AttributCategorie
+    if err := json.NewDecoder(r.Body).Decode(&attribut); err != nil {
+        http.Error(w, "Requête invalide", http.StatusBadRequest)
+        return
+    }
+
+    if _, err := h.repo.GetCategoryByID(id); err != nil {
+        http.Error(w, fmt.Sprintf("Catégorie non trouvée : %v", err), http.StatusNotFound)
+        return
+    }
+
+    cree, err := h.repo.CreerAttribut(id, attribut)
+    if errors.Is(err, ErrAttributInvalide) {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    if errors.Is(err, ErrAttributIncompatible) {
+        http.Error(w, err.Error(), http.StatusConflict)
+        return
+    }
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "status": "success",
+        "data":   cree,
+    })
+}
+
+// HandleModifierAttribut - Met à jour la définition d'un attribut
+func (h *CategoryHandler) HandleModifierAttribut(w http.ResponseWriter, r *http.Request) {
+    id := chi.URLParam(r, "attributID")
+    if _, err := uuid.Parse(id); err != nil {
+        http.Error(w, "Format d'ID invalide", http.StatusBadRequest)
+        return
+    }
+
+    var attribut models.AttributCategorie
+    if err := json.NewDecoder(r.Body).Decode(&attribut); err != nil {
+        http.Error(w, "Requête invalide", http.StatusBadRequest)
+        return
+    }
+
+    modifie, err := h.repo.ModifierAttribut(id, attribut)
+    if errors.Is(err, ErrAttributIntrouvable) {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if errors.Is(err, ErrAttributInvalide) {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    if errors.Is(err, ErrAttributIncompatible) {
+        http.Error(w, err.Error(), http.StatusConflict)
+        return
+    }
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "status": "success",
+        "data":   modifie,
+    })
+}
+
+// HandleSupprimerAttribut - Supprime un attribut et les valeurs saisies sur les produits
+func (h *CategoryHandler) HandleSupprimerAttribut(w http.ResponseWriter, r *http.Request) {
+    id := chi.URLParam(r, "attributID")
+    if _, err := uuid.Parse(id); err != nil {
+        http.Error(w, "Format d'ID invalide", http.StatusBadRequest)
+        return
+    }
+
+    err := h.repo.SupprimerAttribut(id)
+    if errors.Is(err, ErrAttributIntrouvable) {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]string{
+        "message": "Attribut supprimé avec succès",
+        "status":  "success",
+    })
+}
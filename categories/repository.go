@@ -2,7 +2,9 @@ package categories
 
 import (
 	"database/sql"
+	"errors"
 	"ecommerce-api/models"
+	"ecommerce-api/pkg/utils"
 	"fmt"
 	"time"
 
@@ -10,6 +12,28 @@ import (
 	"github.com/jmoiron/sqlx"
 )
 
+var (
+	ErrParentIntrouvable     = errors.New("catégorie parente introuvable")
+	ErrCycleCategorie        = errors.New("une catégorie ne peut pas être rangée sous elle-même ou sous une de ses sous-catégories")
+	ErrCategorieNonVide      = errors.New("la catégorie contient des sous-catégories")
+	ErrCategorieAvecProduits = errors.New("la catégorie contient encore des produits, déplacez-les d'abord")
+	ErrCategorieInvalide     = errors.New("catégorie invalide")
+)
+
+// validerCategorie contrôle le statut et la période d'activation ; un statut vide vaut « actif ».
+func validerCategorie(category *models.Category) error {
+	if category.Statut == "" {
+		category.Statut = models.CategorieActive
+	}
+	if category.Statut != models.CategorieActive && category.Statut != models.CategorieInactive {
+		return fmt.Errorf("%w : statut %q inconnu (actif ou inactif)", ErrCategorieInvalide, category.Statut)
+	}
+	if category.ActiveDu != nil && category.ActiveJusquAu != nil && !category.ActiveJusquAu.After(*category.ActiveDu) {
+		return fmt.Errorf("%w : active_jusqu_au doit suivre active_du", ErrCategorieInvalide)
+	}
+	return nil
+}
+
 type CategoryRepository struct {
 	db *sqlx.DB
 }
@@ -19,18 +43,70 @@ func NewCategoryRepository(db *sqlx.DB) *CategoryRepository {
 }
 
 func (r *CategoryRepository) CreateCategory(category models.Category) error {
+	if err := validerCategorie(&category); err != nil {
+		return err
+	}
+	if err := r.verifierParent("", category.ParentID); err != nil {
+		return err
+	}
+
 	// Utilisation du UUID pour générer un ID unique
-	query := `INSERT INTO categories (nom, nombre_produits, statut, created_at, updated_at) 
-		      VALUES ($1, $2, $3, $4, $5) RETURNING id`
-	err := r.db.QueryRow(query, category.Nom, category.NombreProduits, category.Statut, time.Now(), time.Now()).Scan(&category.ID)
+	// Les compteurs de produits partent de 0 et sont tenus à jour par trigger
+	query := `INSERT INTO categories (nom, statut, parent_id, active_du, active_jusqu_au, created_at, updated_at) 
+		      VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+	err := r.db.QueryRow(query, category.Nom, category.Statut, category.ParentID, category.ActiveDu, category.ActiveJusquAu, time.Now(), time.Now()).Scan(&category.ID)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (r *CategoryRepository) GetAllCategories() ([]models.Category, error) {
-	query := `SELECT id, nom, nombre_produits, statut, created_at, updated_at FROM categories`
+// verifierParent s'assure que le parent existe et n'est ni la catégorie id ni l'une de ses descendantes.
+// Le trigger categories_cycle applique la même règle en base.
+func (r *CategoryRepository) verifierParent(id string, parentID *string) error {
+	if parentID == nil {
+		return nil
+	}
+	if _, err := uuid.Parse(*parentID); err != nil {
+		return ErrParentIntrouvable
+	}
+
+	var existe, cycle bool
+	err := r.db.QueryRow(`
+		WITH RECURSIVE ancetres AS (
+			SELECT id, parent_id FROM categories WHERE id = $1
+			UNION
+			SELECT c.id, c.parent_id FROM categories c JOIN ancetres a ON c.id = a.parent_id
+		)
+		SELECT EXISTS (SELECT 1 FROM categories WHERE id = $1),
+		       $2 <> '' AND EXISTS (SELECT 1 FROM ancetres WHERE id::text = $2)`,
+		*parentID, id).Scan(&existe, &cycle)
+	if err != nil {
+		return fmt.Errorf("erreur lors de la vérification de la catégorie parente : %v", err)
+	}
+	if !existe {
+		return ErrParentIntrouvable
+	}
+	if cycle {
+		return ErrCycleCategorie
+	}
+	return nil
+}
+
+// selectCategories calcule la visibilité publique de chaque catégorie à partir de la vue categories_visibles.
+const selectCategories = `
+	SELECT id, nom, parent_id, nombre_produits, nombre_produits_disponibles, statut,
+	       active_du, active_jusqu_au, id IN (SELECT id FROM categories_visibles) AS visible,
+	       created_at, updated_at, version
+	FROM categories`
+
+// GetAllCategories liste les catégories ; les catégories non visibles ne sont retournées que si inclureInactives.
+func (r *CategoryRepository) GetAllCategories(inclureInactives bool) ([]models.Category, error) {
+	query := selectCategories
+	if !inclureInactives {
+		query += ` WHERE id IN (SELECT id FROM categories_visibles)`
+	}
+	query += ` ORDER BY nom`
 	categories := []models.Category{}
 	err := r.db.Select(&categories, query)
 	if err != nil {
@@ -42,13 +118,19 @@ func (r *CategoryRepository) GetAllCategories() ([]models.Category, error) {
 func (repo *CategoryRepository) GetCategoryByID(id string) (*models.Category, error) {
 	// Exemple de requête pour récupérer la catégorie par son ID
 	var category models.Category
-	err := repo.db.QueryRow("SELECT id, nom, nombre_produits, statut, created_at, updated_at FROM categories WHERE id = $1", id).Scan(
+	err := repo.db.QueryRow(selectCategories+" WHERE id = $1", id).Scan(
 		&category.ID,
 		&category.Nom,
+		&category.ParentID,
 		&category.NombreProduits,
+		&category.NombreProduitsDisponibles,
 		&category.Statut,
+		&category.ActiveDu,
+		&category.ActiveJusquAu,
+		&category.Visible,
 		&category.CreatedAt,
 		&category.UpdatedAt,
+		&category.Version,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -60,25 +142,39 @@ func (repo *CategoryRepository) GetCategoryByID(id string) (*models.Category, er
 }
 
 
-func (r *CategoryRepository) UpdateCategory(category models.Category) error {
+// UpdateCategory met à jour la catégorie si sa version vaut versionAttendue (0 : sans vérification),
+// et retourne la nouvelle version ; sinon utils.ErrVersionPerimee.
+func (r *CategoryRepository) UpdateCategory(category models.Category, versionAttendue int) (int, error) {
 	// Validation du format UUID
 	_, err := uuid.Parse(category.ID)
 	if err != nil {
-		return fmt.Errorf("ID invalide : %v", err)
+		return 0, fmt.Errorf("ID invalide : %v", err)
+	}
+	if err := validerCategorie(&category); err != nil {
+		return 0, err
+	}
+	if err := r.verifierParent(category.ID, category.ParentID); err != nil {
+		return 0, err
 	}
 
 	query := `
         UPDATE categories 
-        SET nom = $1, nombre_produits = $2, 
-            statut = $3, updated_at = $4
-        WHERE id = $5`
+        SET nom = $1, statut = $2, parent_id = $3, active_du = $4, active_jusqu_au = $5,
+            updated_at = $6, version = version + 1
+        WHERE id = $7 AND ($8 = 0 OR version = $8)
+        RETURNING version`
     
-	_, err = r.db.Exec(query, category.Nom, category.NombreProduits, category.Statut, time.Now(), category.ID)
+	var version int
+	err = r.db.QueryRow(query, category.Nom, category.Statut, category.ParentID, category.ActiveDu, category.ActiveJusquAu,
+		time.Now(), category.ID, versionAttendue).Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, utils.ErrVersionPerimee
+	}
 	if err != nil {
-		return fmt.Errorf("échec de la mise à jour de la catégorie : %v", err)
+		return 0, fmt.Errorf("échec de la mise à jour de la catégorie : %v", err)
 	}
 
-	return nil
+	return version, nil
 }
 
 func (r *CategoryRepository) DeleteCategory(id string) error {
@@ -88,6 +184,22 @@ func (r *CategoryRepository) DeleteCategory(id string) error {
 		return fmt.Errorf("ID invalide : %v", err)
 	}
 
+	var enfants bool
+	if err := r.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM categories WHERE parent_id = $1)`, id).Scan(&enfants); err != nil {
+		return fmt.Errorf("échec de la suppression de la catégorie : %v", err)
+	}
+	if enfants {
+		return ErrCategorieNonVide
+	}
+
+	var produits bool
+	if err := r.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM produits WHERE categorie_id = $1)`, id).Scan(&produits); err != nil {
+		return fmt.Errorf("échec de la suppression de la catégorie : %v", err)
+	}
+	if produits {
+		return ErrCategorieAvecProduits
+	}
+
 	query := `DELETE FROM categories WHERE id = $1`
 
 	_, err = r.db.Exec(query, id)
@@ -97,3 +209,58 @@ func (r *CategoryRepository) DeleteCategory(id string) error {
 
 	return nil
 }
+
+// GetArbre retourne les catégories racines avec leurs sous-catégories imbriquées.
+func (r *CategoryRepository) GetArbre(inclureInactives bool) ([]models.Category, error) {
+	categories, err := r.GetAllCategories(inclureInactives)
+	if err != nil {
+		return nil, err
+	}
+
+	enfants := make(map[string][]models.Category)
+	for _, c := range categories {
+		parent := ""
+		if c.ParentID != nil {
+			parent = *c.ParentID
+		}
+		enfants[parent] = append(enfants[parent], c)
+	}
+
+	var construire func(parent string) []models.Category
+	construire = func(parent string) []models.Category {
+		noeuds := enfants[parent]
+		for i := range noeuds {
+			noeuds[i].Enfants = construire(noeuds[i].ID)
+		}
+		return noeuds
+	}
+
+	arbre := construire("")
+	if arbre == nil {
+		arbre = []models.Category{}
+	}
+	return arbre, nil
+}
+
+// Recompter recalcule les compteurs de produits de toutes les catégories, pour corriger
+// une dérive éventuelle, et retourne le nombre de catégories corrigées.
+func (r *CategoryRepository) Recompter() (int64, error) {
+	result, err := r.db.Exec(`
+		WITH comptes AS (
+			SELECT c.id,
+			       COUNT(p.id) AS total,
+			       COUNT(p.id) FILTER (WHERE p.disponible) AS disponibles
+			FROM categories c
+			LEFT JOIN produits p ON p.categorie_id = c.id
+			GROUP BY c.id
+		)
+		UPDATE categories c
+		SET nombre_produits = comptes.total, nombre_produits_disponibles = comptes.disponibles
+		FROM comptes
+		WHERE c.id = comptes.id
+		  AND (c.nombre_produits <> comptes.total OR c.nombre_produits_disponibles <> comptes.disponibles)`)
+	if err != nil {
+		return 0, fmt.Errorf("échec du recomptage des produits : %v", err)
+	}
+	return result.RowsAffected()
+}
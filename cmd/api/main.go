@@ -9,10 +9,14 @@ import (
 	"ecommerce-api/events"
 	events_category "ecommerce-api/events_categories"
 	"ecommerce-api/googleauth"
+	"ecommerce-api/inventaire"
+	"ecommerce-api/media"
 	middlewares "ecommerce-api/middleware"
 	"ecommerce-api/panier"
 	"ecommerce-api/products"
 	"ecommerce-api/repository"
+	"ecommerce-api/search"
+	"ecommerce-api/souhaits"
 	"log"
 	"net"
 	"net/http"
@@ -63,8 +67,8 @@ func main() {
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"https://*", "http://*"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-Session-ID", "If-Match"},
+		ExposedHeaders:   []string{"Link", "ETag"},
 		AllowCredentials: false,
 		MaxAge:           300,
 	}))
@@ -87,6 +91,7 @@ func main() {
 	googleAuthMiddleware := middlewares.GoogleAuthMiddleware
 	authMiddleware := middlewares.AuthMiddleware
 	AdminMiddleware := admin.AdminAuthMiddleware
+	adminOptionnelMiddleware := admin.AdminOptionnelMiddleware // Les administrateurs voient aussi les catégories inactives
 	userRepo := repository.NewUserRepository(config.DB)
 	authHandler := googleauth.NewGoogleAuthHandler(userRepo)
 	adminRepo := admin.NewAdminRepository(config.DB)
@@ -94,18 +99,32 @@ func main() {
 	categoryRepo := categories.NewCategoryRepository(config.DB)
 	categoryHandler := categories.NewCategoryHandler(categoryRepo)
 	productRepo := products.NewProductRepository(config.DB)
-	productHandler := products.NewProductHandler(productRepo)
+	viewTracker := products.NewViewTracker(config.DB, 30*time.Minute)
+	viewTracker.Demarrer(time.Minute)
+	mediaRepo := media.NewRepository(config.DB, media.NewLocalStorage(staticDir+"/uploads", "/static/uploads"))
+	mediaHandler := media.NewHandler(mediaRepo)
+	productHandler := products.NewProductHandler(productRepo, viewTracker, mediaRepo)
+	searchEngine := search.NewSearchEngine(config.DB.DB)
+	searchHandler := search.NewSearchHandler(searchEngine)
 	eventCategoriesRepo :=events_category.NewEventCategoryRepository(config.DB)
 	eventCategoriesHandler:=events_category.NewEventCategoryHandler(eventCategoriesRepo)
 	eventRepo:= events.NewEventRepository(config.DB)
 	eventHanlder := events.NewEventHandler(eventRepo)
-	panierRepo := panier.NewRepository(config.DB)
-    panierHandler := panier.NewPanierHandler(panierRepo)
-
 	emailService:=email.NewEmailService(emailConfig)
 	commandeRepo:= order.NewRepository(config.DB)
 	CommandeHandler :=order.NewHandler(commandeRepo ,emailService)
 
+	inventaireRepo := inventaire.NewRepository(config.DB)
+	inventaireHandler := inventaire.NewHandler(inventaireRepo)
+	inventaire.DemarrerNettoyageReservations(inventaireRepo, time.Minute)
+	inventaire.DemarrerRecapStockBas(inventaireRepo, adminRepo, emailService, 8)
+
+	panierRepo := panier.NewRepository(config.DB)
+    panierHandler := panier.NewPanierHandler(panierRepo, commandeRepo, inventaireRepo, emailService)
+	souhaitsRepo := souhaits.NewRepository(config.DB)
+	souhaitsHandler := souhaits.NewHandler(souhaitsRepo)
+	souhaits.DemarrerSurveillance(souhaitsRepo, emailService, 30*time.Minute)
+
 
 
 
@@ -132,27 +151,27 @@ func main() {
 	})
 
 	r.Route("/categories", func(r chi.Router) {
+		r.Use(adminOptionnelMiddleware)
 		r.Get("/", categoryHandler.HandleGetAllCategories)    // Obtenir toutes les catégories
+		r.Get("/arbre", categoryHandler.HandleGetArbre)       // Obtenir l'arborescence des catégories
 		r.Get("/{id}", categoryHandler.HandleGetCategoryByID) // Obtenir une catégorie par ID
+		r.Get("/{id}/attributs", categoryHandler.HandleListerAttributs) // Schéma d'attributs, hérités compris
 
 		r.With(AdminMiddleware).Route("/", func(r chi.Router) {
 			r.Post("/", categoryHandler.HandleCreateCategory)       // Créer une catégorie
+			r.Post("/recompter", categoryHandler.HandleRecompter)   // Recalculer les compteurs de produits
+			r.Post("/{id}/deplacer", categoryHandler.HandleDeplacerProduits) // Déplacer les produits, fusion optionnelle
+			r.Post("/{id}/attributs", categoryHandler.HandleCreerAttribut)
+			r.Put("/attributs/{attributID}", categoryHandler.HandleModifierAttribut)
+			r.Delete("/attributs/{attributID}", categoryHandler.HandleSupprimerAttribut)
 			r.Put("/{id}", categoryHandler.HandleUpdateCategory)    // Mettre à jour une catégorie
 			r.Delete("/{id}", categoryHandler.HandleDeleteCategory) // Supprimer une catégorie
 		})
 	})
-	r.Route("/products", func(r chi.Router) {
-		r.With(AdminMiddleware).Route("/", func(r chi.Router) {
-			r.Post("/", productHandler.HandleCreateProduct)
-			r.Delete("/{id}", productHandler.HandleDeleteProduct)
-			r.Put("/{id}", productHandler.HandleUpdateProduct)
-		})
-		r.Get("/{id}", productHandler.HandleGetProductByID)
-		r.Get("/", productHandler.HandleGetAllProducts)
-		r.Get("/by-category/{categoryID}", productHandler.HandleGetProductsByCategory)
-		r.Get("/filter", productHandler.HandleFilterProducts)
-		r.Get("/search", productHandler.HandleSearchProducts)
-	})
+	r.Route("/products", routesProduits(productHandler, mediaHandler, AdminMiddleware, adminOptionnelMiddleware))
+	r.With(adminOptionnelMiddleware).Get("/search", searchHandler.HandleSearch)
+	r.Get("/search/suggest", searchHandler.HandleSuggest)
+
 	r.Route("/event-categories", func(r chi.Router) {
 		r.With(AdminMiddleware).Route("/", func(r chi.Router) {
 			r.Post("/", eventCategoriesHandler.HandleCreateEventCategory)
@@ -171,6 +190,13 @@ func main() {
 		r.Get("/", eventHanlder.HandleGetAllEvents)
 		r.Get("/{id}", eventHanlder.HandleGetEventByID)
 		r.Get("/category/{id}", eventHanlder.HandleGetEventsByCategoryID)
+		r.With(authMiddleware).Post("/{id}/tickets", eventHanlder.HandleAcheterTickets)
+	})
+
+	r.Route("/tickets", func(r chi.Router) {
+		r.Use(authMiddleware)
+		r.Get("/", eventHanlder.HandleListerTickets)
+		r.Post("/{id}/annuler", eventHanlder.HandleAnnulerTicket)
 	})
 
 	r.Route("/panier", func(r chi.Router) {
@@ -178,17 +204,48 @@ func main() {
 		r.Get("/", panierHandler.HandleAfficherPanier)
 		r.Post("/ajouter", panierHandler.HandleAjouterProduit)
 		r.Delete("/enlever", panierHandler.HandleEnleverDuPanier)
+		r.Put("/quantite", panierHandler.HandleModifierQuantite)
+		r.Post("/checkout/demarrer", panierHandler.HandleDemarrerCheckout)
+		r.Delete("/checkout/reservations", panierHandler.HandleAbandonnerCheckout)
+		r.Post("/checkout", panierHandler.HandleCheckout)
+	})
+
+	r.Route("/souhaits", func(r chi.Router) {
+		r.Use(authMiddleware)
+		r.Get("/", souhaitsHandler.HandleListerSouhaits)
+		r.Post("/ajouter", souhaitsHandler.HandleAjouterSouhait)
+		r.Delete("/enlever", souhaitsHandler.HandleEnleverSouhait)
+		r.Post("/deplacer-panier", souhaitsHandler.HandleDeplacerVersPanier)
 	})
 
 	r.Route("/commandes", func(r chi.Router) {
 		r.Use(authMiddleware)
 		r.Get("/", CommandeHandler.HandleListerCommandes)
 		r.Post("/", CommandeHandler.HandleCreerCommande)
+		r.Get("/{id}/historique", CommandeHandler.HandleHistoriqueCommande)
+		r.Post("/{id}/annuler", CommandeHandler.HandleAnnulerCommande)
 	})
 
 	r.Route("/ordres", func(r chi.Router) {
 		r.Use(AdminMiddleware)
 		r.Get("/all", CommandeHandler.HandleListerToutesCommandes)
+		r.Put("/{id}/status", CommandeHandler.HandleChangerStatut)
+		r.Post("/{id}/annuler", CommandeHandler.HandleAnnulerCommandeAdmin)
+		r.Get("/{id}/historique", CommandeHandler.HandleHistoriqueCommandeAdmin)
+	})
+
+	r.Route("/inventaire", func(r chi.Router) {
+		r.Use(AdminMiddleware)
+		r.Post("/ajustements", inventaireHandler.HandleAjustement)
+		r.Get("/mouvements", inventaireHandler.HandleListerMouvements)
+		r.Get("/ecarts", inventaireHandler.HandleListerEcarts)
+		r.Get("/stock-bas", inventaireHandler.HandleListerStockBas)
+		r.Post("/transferts", inventaireHandler.HandleTransfert)
+		r.Get("/emplacements", inventaireHandler.HandleListerEmplacements)
+		r.Post("/emplacements", inventaireHandler.HandleCreerEmplacement)
+		r.Put("/emplacements/{id}", inventaireHandler.HandleModifierEmplacement)
+		r.Delete("/emplacements/{id}", inventaireHandler.HandleSupprimerEmplacement)
+		r.Get("/emplacements/{id}/stock", inventaireHandler.HandleStockEmplacement)
 	})
 
 	
@@ -206,3 +263,33 @@ func main() {
 		log.Fatal("Error starting server: ", err)
 	}
 }
+
+// routesProduits déclare les routes /products. Les routes statiques réservées aux administrateurs
+// en GET (comme /export) doivent être déclarées sur ce routeur : dans le sous-routeur admin,
+// elles seraient masquées par la route publique /{id}.
+func routesProduits(productHandler *products.ProductHandler, mediaHandler *media.Handler, adminMiddleware, adminOptionnelMiddleware func(http.Handler) http.Handler) func(chi.Router) {
+	return func(r chi.Router) {
+		r.Use(adminOptionnelMiddleware)
+		r.With(adminMiddleware).Route("/", func(r chi.Router) {
+			r.Post("/", productHandler.HandleCreateProduct)
+			r.Post("/import", productHandler.HandleImportProducts)
+			r.Post("/images", mediaHandler.HandleTeleverser)
+			r.Delete("/{id}", productHandler.HandleDeleteProduct)
+			r.Put("/{id}", productHandler.HandleUpdateProduct)
+			r.Patch("/{id}", productHandler.HandleUpdateProduct)
+			r.Post("/{id}/variantes", productHandler.HandleCreerVariante)
+			r.Put("/variantes/{varianteID}", productHandler.HandleModifierVariante)
+			r.Delete("/variantes/{varianteID}", productHandler.HandleSupprimerVariante)
+		})
+		r.With(adminMiddleware).Get("/export", productHandler.HandleExportProducts)
+		r.Get("/plus-vus", productHandler.HandleGetPlusVus)
+		r.Get("/tendances", productHandler.HandleGetTendances)
+		r.Get("/{id}", productHandler.HandleGetProductByID)
+		r.Get("/{id}/variantes", productHandler.HandleListerVariantes)
+		r.Get("/{id}/disponibilites", productHandler.HandleDisponibilites)
+		r.Get("/", productHandler.HandleGetAllProducts)
+		r.Get("/by-category/{categoryID}", productHandler.HandleGetProductsByCategory)
+		r.Get("/filter", productHandler.HandleFilterProducts)
+		r.Get("/search", productHandler.HandleSearchProducts)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"ecommerce-api/media"
+	"ecommerce-api/products"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// adminRefuse remplace le middleware admin : une réponse 403 prouve que la requête
+// a atteint une route protégée plutôt qu'une route publique.
+func adminRefuse(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "admin requis", http.StatusForbidden)
+	})
+}
+
+func sansEffet(next http.Handler) http.Handler { return next }
+
+func TestRoutesProduitsAdmin(t *testing.T) {
+	r := chi.NewRouter()
+	r.Route("/products", routesProduits(products.NewProductHandler(nil, nil, nil), media.NewHandler(nil), adminRefuse, sansEffet))
+
+	cas := []struct {
+		methode, chemin string
+		attendu         int
+	}{
+		{http.MethodGet, "/products/export", http.StatusForbidden},
+		{http.MethodPost, "/products/import", http.StatusForbidden},
+		{http.MethodPost, "/products/images", http.StatusForbidden},
+		{http.MethodPost, "/products/", http.StatusForbidden},
+		{http.MethodPut, "/products/00000000-0000-0000-0000-000000000001", http.StatusForbidden},
+		{http.MethodPatch, "/products/00000000-0000-0000-0000-000000000001", http.StatusForbidden},
+		{http.MethodDelete, "/products/00000000-0000-0000-0000-000000000001", http.StatusForbidden},
+		// Route publique : l'ID est rejeté avant tout accès à la base
+		{http.MethodGet, "/products/pas-un-uuid", http.StatusBadRequest},
+	}
+	for _, c := range cas {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(c.methode, c.chemin, nil))
+		if rec.Code != c.attendu {
+			t.Errorf("%s %s : statut %d, attendu %d", c.methode, c.chemin, rec.Code, c.attendu)
+		}
+	}
+}
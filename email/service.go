@@ -3,9 +3,11 @@ package email
 import (
     "bytes"
     "ecommerce-api/models"
+    "errors"
     "fmt"
     "html/template"
     "net/smtp"
+    "time"
 )
 
 type Config struct {
@@ -47,11 +49,58 @@ func (s *Service) EnvoyerEmailConfirmationCommande(commande *models.Commande, em
         return fmt.Errorf("erreur lors du rendu du template: %v", err)
     }
 
+    return s.envoyer(email, fmt.Sprintf("Confirmation de votre commande %s", commande.NumeroCommande), htmlBody)
+}
+
+// EnvoyerEmailAlerteSouhait prévient un utilisateur qu'un produit de sa liste de souhaits
+// a baissé de prix ou est de nouveau en stock.
+func (s *Service) EnvoyerEmailAlerteSouhait(alerte models.AlerteSouhait) error {
+    htmlBody, err := s.renderTemplateWithFuncs(emailAlerteSouhaitTemplate, template.FuncMap{}, map[string]interface{}{
+        "Nom":           alerte.NomProduit,
+        "Prix":          fmt.Sprintf("%.2f €", alerte.Prix),
+        "AncienPrix":    fmt.Sprintf("%.2f €", alerte.AncienPrix),
+        "BaissePrix":    alerte.BaissePrix,
+        "RetourEnStock": alerte.RetourEnStock,
+    })
+    if err != nil {
+        return fmt.Errorf("erreur lors du rendu du template: %v", err)
+    }
+
+    sujet := fmt.Sprintf("%s est de nouveau disponible", alerte.NomProduit)
+    if alerte.BaissePrix {
+        sujet = fmt.Sprintf("Baisse de prix sur %s", alerte.NomProduit)
+    }
+    return s.envoyer(alerte.Email, sujet, htmlBody)
+}
+
+// EnvoyerEmailStockBas envoie aux administrateurs le récapitulatif des produits en stock bas.
+// Un échec n'empêche pas l'envoi aux destinataires suivants ; les erreurs sont retournées ensemble.
+func (s *Service) EnvoyerEmailStockBas(destinataires []string, produits []models.ProduitStockBas) error {
+    htmlBody, err := s.renderTemplateWithFuncs(emailStockBasTemplate, template.FuncMap{}, map[string]interface{}{
+        "Date":     time.Now().Format("02/01/2006"),
+        "Produits": produits,
+    })
+    if err != nil {
+        return fmt.Errorf("erreur lors du rendu du template: %v", err)
+    }
+
+    sujet := fmt.Sprintf("Stock bas : %d produit(s) à réapprovisionner", len(produits))
+    var erreurs []error
+    for _, destinataire := range destinataires {
+        if err := s.envoyer(destinataire, sujet, htmlBody); err != nil {
+            erreurs = append(erreurs, fmt.Errorf("%s : %w", destinataire, err))
+        }
+    }
+    return errors.Join(erreurs...)
+}
+
+// envoyer construit le message HTML et l'envoie via le serveur SMTP configuré.
+func (s *Service) envoyer(destinataire, sujet, htmlBody string) error {
     // Configurer les en-têtes de l'email
     headers := make(map[string]string)
     headers["From"] = fmt.Sprintf("%s <%s>", s.config.FromName, s.config.FromEmail)
-    headers["To"] = email
-    headers["Subject"] = fmt.Sprintf("Confirmation de votre commande %s", commande.NumeroCommande)
+    headers["To"] = destinataire
+    headers["Subject"] = sujet
     headers["MIME-Version"] = "1.0"
     headers["Content-Type"] = "text/html; charset=UTF-8"
 
@@ -71,11 +120,11 @@ func (s *Service) EnvoyerEmailConfirmationCommande(commande *models.Commande, em
     )
 
     // Envoyer l'email
-    err = smtp.SendMail(
+    err := smtp.SendMail(
         fmt.Sprintf("%s:%s", s.config.Host, s.config.Port),
         auth,
         s.config.FromEmail,
-        []string{email},
+        []string{destinataire},
         []byte(message),
     )
     if err != nil {
@@ -202,4 +251,74 @@ const emailConfirmationTemplate = `
         <p>© 2024 Votre E-commerce. Tous droits réservés.</p>
     </div>
 </body>
-</html>`
\ No newline at end of file
+</html>`
+
+// Template HTML pour les alertes de la liste de souhaits
+const emailAlerteSouhaitTemplate = `
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>Alerte liste de souhaits</title>
+</head>
+<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333; max-width: 600px; margin: 0 auto; padding: 20px;">
+    <div style="background-color: #4CAF50; color: white; padding: 20px; text-align: center; border-radius: 5px;">
+        <h1>Bonne nouvelle !</h1>
+    </div>
+
+    <div style="padding: 20px; background-color: #f9f9f9; border-radius: 5px; margin-top: 20px;">
+        {{if .BaissePrix}}
+        <p>Le prix de <strong>{{.Nom}}</strong>, présent dans votre liste de souhaits, est passé de {{.AncienPrix}} à <strong>{{.Prix}}</strong>.</p>
+        {{end}}
+        {{if .RetourEnStock}}
+        <p><strong>{{.Nom}}</strong>, présent dans votre liste de souhaits, est de nouveau en stock au prix de {{.Prix}}.</p>
+        {{end}}
+    </div>
+
+    <div style="text-align: center; margin-top: 20px; padding: 20px; font-size: 12px; color: #666;">
+        <p>Cet email a été envoyé automatiquement, merci de ne pas y répondre.</p>
+    </div>
+</body>
+</html>`
+
+// Template HTML pour le récapitulatif quotidien des stocks bas
+const emailStockBasTemplate = `
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>Produits en stock bas</title>
+</head>
+<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333; max-width: 600px; margin: 0 auto; padding: 20px;">
+    <div style="background-color: #E67E22; color: white; padding: 20px; text-align: center; border-radius: 5px;">
+        <h1>Stock bas au {{.Date}}</h1>
+    </div>
+
+    <div style="padding: 20px; background-color: #f9f9f9; border-radius: 5px; margin-top: 20px;">
+        <table style="width: 100%; border-collapse: collapse;">
+            <thead>
+                <tr>
+                    <th style="border: 1px solid #ddd; padding: 8px; text-align: left; background-color: #f2f2f2;">Produit</th>
+                    <th style="border: 1px solid #ddd; padding: 8px; text-align: left; background-color: #f2f2f2;">Stock</th>
+                    <th style="border: 1px solid #ddd; padding: 8px; text-align: left; background-color: #f2f2f2;">Seuil</th>
+                    <th style="border: 1px solid #ddd; padding: 8px; text-align: left; background-color: #f2f2f2;">Disponible</th>
+                </tr>
+            </thead>
+            <tbody>
+                {{range .Produits}}
+                <tr>
+                    <td style="border: 1px solid #ddd; padding: 8px;">{{.Nom}}{{if .Marque}} ({{.Marque}}){{end}}</td>
+                    <td style="border: 1px solid #ddd; padding: 8px;">{{.Stock}}</td>
+                    <td style="border: 1px solid #ddd; padding: 8px;">{{.SeuilStockBas}}</td>
+                    <td style="border: 1px solid #ddd; padding: 8px;">{{if .Disponible}}Oui{{else}}Non{{end}}</td>
+                </tr>
+                {{end}}
+            </tbody>
+        </table>
+    </div>
+
+    <div style="text-align: center; margin-top: 20px; padding: 20px; font-size: 12px; color: #666;">
+        <p>Cet email a été envoyé automatiquement, merci de ne pas y répondre.</p>
+    </div>
+</body>
+</html>`
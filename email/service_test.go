@@ -0,0 +1,23 @@
+package email
+
+import (
+    "ecommerce-api/models"
+    "strings"
+    "testing"
+)
+
+// Aucun serveur n'écoute sur le port 1 : chaque envoi échoue immédiatement.
+func TestEnvoyerEmailStockBasPrevientChaqueDestinataire(t *testing.T) {
+    s := NewEmailService(Config{Host: "127.0.0.1", Port: "1", FromEmail: "boutique@exemple.com"})
+    destinataires := []string{"admin1@exemple.com", "admin2@exemple.com", "admin3@exemple.com"}
+
+    err := s.EnvoyerEmailStockBas(destinataires, []models.ProduitStockBas{})
+    if err == nil {
+        t.Fatal("erreur attendue sans serveur SMTP")
+    }
+    for _, destinataire := range destinataires {
+        if !strings.Contains(err.Error(), destinataire) {
+            t.Errorf("l'erreur ne mentionne pas %s : %v", destinataire, err)
+        }
+    }
+}
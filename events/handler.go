@@ -3,8 +3,12 @@ package events
 
 import (
     "encoding/json"
+    "errors"
+    "fmt"
     "net/http"
+    "ecommerce-api/googleauth"
     "ecommerce-api/models"  // Ajustez le chemin selon votre projet
+    "ecommerce-api/pkg/utils"
     "github.com/go-chi/chi/v5"
 )
 
@@ -54,6 +58,7 @@ func (h *EventHandler) HandleGetEventByID(w http.ResponseWriter, r *http.Request
         return
     }
     
+    w.Header().Set("ETag", utils.ETag(event.Version))
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(event)
 }
@@ -75,8 +80,14 @@ func (h *EventHandler) HandleGetEventsByCategoryID(w http.ResponseWriter, r *htt
 }
 
 
+// HandleUpdateEvent remplace l'événement ; l'en-tête If-Match doit reprendre l'ETag lu.
 func (h *EventHandler) HandleUpdateEvent(w http.ResponseWriter, r *http.Request) {
     id := chi.URLParam(r, "id")
+    versionAttendue, ok := utils.VersionAttendue(w, r)
+    if !ok {
+        return
+    }
+
     var event models.Event
     if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
         http.Error(w, "Requête invalide", http.StatusBadRequest)
@@ -84,11 +95,17 @@ func (h *EventHandler) HandleUpdateEvent(w http.ResponseWriter, r *http.Request)
     }
     
     event.ID = id
-    if err := h.repo.UpdateEvent(event); err != nil {
+    version, err := h.repo.UpdateEvent(event, versionAttendue)
+    if errors.Is(err, utils.ErrVersionPerimee) {
+        http.Error(w, err.Error(), http.StatusPreconditionFailed)
+        return
+    }
+    if err != nil {
         http.Error(w, err.Error(), http.StatusInternalServerError)
         return
     }
     
+    w.Header().Set("ETag", utils.ETag(version))
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(map[string]string{
         "message": "Événement mis à jour avec succès",
@@ -108,4 +125,80 @@ func (h *EventHandler) HandleDeleteEvent(w http.ResponseWriter, r *http.Request)
         "message": "Événement supprimé avec succès",
         "status": "success",
     })
-}
\ No newline at end of file
+}
+
+// HandleAcheterTickets gère l'achat de places pour un événement par l'utilisateur connecté.
+func (h *EventHandler) HandleAcheterTickets(w http.ResponseWriter, r *http.Request) {
+    googleID, _, err := googleauth.ExtraireUtilisateur(r)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+
+    var req struct {
+        Quantity int `json:"quantity"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Requête invalide", http.StatusBadRequest)
+        return
+    }
+    if req.Quantity <= 0 {
+        http.Error(w, "La quantité doit être supérieure à 0", http.StatusBadRequest)
+        return
+    }
+
+    ticket, err := h.repo.AcheterTickets(googleID, chi.URLParam(r, "id"), req.Quantity)
+    if err != nil {
+        http.Error(w, fmt.Sprintf("Erreur lors de l'achat des tickets : %v", err), http.StatusConflict)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "status":  "success",
+        "message": "Tickets achetés avec succès",
+        "data":    ticket,
+    })
+}
+
+// HandleListerTickets retourne les tickets de l'utilisateur connecté.
+func (h *EventHandler) HandleListerTickets(w http.ResponseWriter, r *http.Request) {
+    googleID, _, err := googleauth.ExtraireUtilisateur(r)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+
+    tickets, err := h.repo.ListerTicketsParUtilisateur(googleID)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "status": "success",
+        "data":   tickets,
+    })
+}
+
+// HandleAnnulerTicket annule un ticket de l'utilisateur connecté.
+func (h *EventHandler) HandleAnnulerTicket(w http.ResponseWriter, r *http.Request) {
+    googleID, _, err := googleauth.ExtraireUtilisateur(r)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+
+    if err := h.repo.AnnulerTicket(googleID, chi.URLParam(r, "id")); err != nil {
+        http.Error(w, fmt.Sprintf("Échec de l'annulation : %v", err), http.StatusBadRequest)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]string{
+        "message": "Ticket annulé avec succès",
+        "status":  "success",
+    })
+}
@@ -5,6 +5,7 @@ import (
     "fmt"
     "time"
     "ecommerce-api/models"  // Ajustez le chemin selon votre projet
+    "ecommerce-api/pkg/utils"
     "github.com/google/uuid"
     "github.com/jmoiron/sqlx"
 )
@@ -82,7 +83,9 @@ func (r *EventRepository) GetEventsByCategoryID(categoryID string) ([]models.Eve
 }
 
 
-func (r *EventRepository) UpdateEvent(event models.Event) error {
+// UpdateEvent met à jour l'événement si sa version vaut versionAttendue (0 : sans vérification),
+// et retourne la nouvelle version ; sinon utils.ErrVersionPerimee.
+func (r *EventRepository) UpdateEvent(event models.Event, versionAttendue int) (int, error) {
     query := `
         UPDATE events SET 
             title = $1,
@@ -96,29 +99,34 @@ func (r *EventRepository) UpdateEvent(event models.Event) error {
             image_url = $9,
             latitude = $10,
             longitude = $11,
-            updated_at = $12
-        WHERE id = $13`
+            updated_at = $12,
+            version = version + 1
+        WHERE id = $13 AND ($14 = 0 OR version = $14)
+        RETURNING version`
     
-    result, err := r.db.Exec(
+    var version int
+    err := r.db.QueryRow(
         query,
         event.Title, event.Description, event.StartDate,
         event.EndDate, event.StartTime, event.Price,
         event.EventTypeID, event.AvailableSeats, event.ImageURL,
-        event.Latitude, event.Longitude, time.Now(), event.ID,
-    )
-    
-    if err != nil {
-        return fmt.Errorf("erreur lors de la mise à jour: %v", err)
+        event.Latitude, event.Longitude, time.Now(), event.ID, versionAttendue,
+    ).Scan(&version)
+    if err == sql.ErrNoRows {
+        // Distinguer un événement absent d'une version périmée
+        var existe bool
+        if err := r.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM events WHERE id = $1)`, event.ID).Scan(&existe); err != nil {
+            return 0, fmt.Errorf("erreur lors de la vérification de la mise à jour: %v", err)
+        }
+        if existe {
+            return 0, utils.ErrVersionPerimee
+        }
+        return 0, fmt.Errorf("aucun événement trouvé avec l'ID %s", event.ID)
     }
-    
-    rowsAffected, err := result.RowsAffected()
     if err != nil {
-        return fmt.Errorf("erreur lors de la vérification de la mise à jour: %v", err)
-    }
-    if rowsAffected == 0 {
-        return fmt.Errorf("aucun événement trouvé avec l'ID %s", event.ID)
+        return 0, fmt.Errorf("erreur lors de la mise à jour: %v", err)
     }
-    return nil
+    return version, nil
 }
 
 func (r *EventRepository) DeleteEvent(id string) error {
@@ -137,4 +145,166 @@ func (r *EventRepository) DeleteEvent(id string) error {
         return fmt.Errorf("aucun événement trouvé avec l'ID %s", id)
     }
     return nil
-}
\ No newline at end of file
+}
+
+// AcheterTickets réserve `quantity` places pour un événement et crée le ticket correspondant.
+// Les places sont décrémentées dans la même transaction, avec verrouillage de la ligne de l'événement.
+func (r *EventRepository) AcheterTickets(userID, eventID string, quantity int) (*models.Ticket, error) {
+    if userID == "" {
+        return nil, fmt.Errorf("userID ne peut pas être vide")
+    }
+    if quantity <= 0 {
+        return nil, fmt.Errorf("la quantité doit être supérieure à 0")
+    }
+    if _, err := uuid.Parse(eventID); err != nil {
+        return nil, fmt.Errorf("ID d'événement invalide : %v", err)
+    }
+
+    tx, err := r.db.Beginx()
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors du début de la transaction: %v", err)
+    }
+    defer tx.Rollback()
+
+    var (
+        title          string
+        price          sql.NullFloat64
+        availableSeats int
+        startDate      sql.NullString
+        startTime      sql.NullString
+    )
+    err = tx.QueryRow(`
+        SELECT title, price, COALESCE(available_seats, 0), start_date, start_time
+        FROM events
+        WHERE id = $1
+        FOR UPDATE`, eventID).Scan(&title, &price, &availableSeats, &startDate, &startTime)
+    if err == sql.ErrNoRows {
+        return nil, fmt.Errorf("événement non trouvé")
+    } else if err != nil {
+        return nil, fmt.Errorf("erreur lors de la lecture de l'événement: %v", err)
+    }
+
+    if availableSeats < quantity {
+        return nil, fmt.Errorf("places insuffisantes pour l'événement %s (demandé: %d, disponible: %d)",
+            title, quantity, availableSeats)
+    }
+
+    now := time.Now()
+    ticket := &models.Ticket{
+        ID:           uuid.New().String(),
+        NumeroTicket: fmt.Sprintf("TCK-%s-%s", now.Format("20060102"), uuid.New().String()[:8]),
+        EventID:      eventID,
+        UserID:       userID,
+        Quantity:     quantity,
+        PriceTotal:   price.Float64 * float64(quantity),
+        Status:       models.TicketStatusValide,
+        StartDate:    startDate.String,
+        StartTime:    startTime.String,
+        EventTitle:   title,
+        CreatedAt:    now,
+        UpdatedAt:    now,
+    }
+
+    _, err = tx.NamedExec(`
+        INSERT INTO tickets (id, numero_ticket, user_id, event_id, quantity, price_total, status,
+                             start_date, start_time, created_at, updated_at)
+        VALUES (:id, :numero_ticket, :user_id, :event_id, :quantity, :price_total, :status,
+                :start_date, :start_time, :created_at, :updated_at)`,
+        ticket)
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors de l'insertion du ticket: %v", err)
+    }
+
+    _, err = tx.Exec(`
+        UPDATE events
+        SET available_seats = available_seats - $1,
+            updated_at = NOW(),
+            version = version + 1 -- Invalide les ETag : UpdateEvent réécrit available_seats
+        WHERE id = $2`,
+        quantity, eventID)
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors de la mise à jour des places: %v", err)
+    }
+
+    if err = tx.Commit(); err != nil {
+        return nil, fmt.Errorf("erreur lors de la validation de la transaction: %v", err)
+    }
+
+    return ticket, nil
+}
+
+// ListerTicketsParUtilisateur récupère les tickets d'un utilisateur, du plus récent au plus ancien.
+func (r *EventRepository) ListerTicketsParUtilisateur(userID string) ([]models.Ticket, error) {
+    tickets := []models.Ticket{}
+    query := `
+        SELECT t.id, t.numero_ticket, t.event_id, t.user_id, t.quantity, t.price_total, t.status,
+               COALESCE(t.start_date, '') AS start_date, COALESCE(t.start_time, '') AS start_time,
+               e.title AS event_title, t.created_at, t.updated_at
+        FROM tickets t
+        JOIN events e ON e.id = t.event_id
+        WHERE t.user_id = $1
+        ORDER BY t.created_at DESC`
+
+    if err := r.db.Select(&tickets, query, userID); err != nil {
+        return nil, fmt.Errorf("erreur lors de la récupération des tickets: %v", err)
+    }
+    return tickets, nil
+}
+
+// AnnulerTicket annule un ticket de l'utilisateur et remet ses places en vente.
+func (r *EventRepository) AnnulerTicket(userID, ticketID string) error {
+    if _, err := uuid.Parse(ticketID); err != nil {
+        return fmt.Errorf("ID de ticket invalide : %v", err)
+    }
+
+    tx, err := r.db.Beginx()
+    if err != nil {
+        return fmt.Errorf("erreur lors du début de la transaction: %v", err)
+    }
+    defer tx.Rollback()
+
+    var (
+        eventID  string
+        quantity int
+        status   string
+    )
+    err = tx.QueryRow(`
+        SELECT event_id, quantity, status
+        FROM tickets
+        WHERE id = $1 AND user_id = $2
+        FOR UPDATE`, ticketID, userID).Scan(&eventID, &quantity, &status)
+    if err == sql.ErrNoRows {
+        return fmt.Errorf("ticket non trouvé")
+    } else if err != nil {
+        return fmt.Errorf("erreur lors de la lecture du ticket: %v", err)
+    }
+
+    if status == models.TicketStatusAnnule {
+        return fmt.Errorf("le ticket est déjà annulé")
+    }
+
+    _, err = tx.Exec(`
+        UPDATE tickets
+        SET status = $1, updated_at = NOW()
+        WHERE id = $2`,
+        models.TicketStatusAnnule, ticketID)
+    if err != nil {
+        return fmt.Errorf("erreur lors de l'annulation du ticket: %v", err)
+    }
+
+    _, err = tx.Exec(`
+        UPDATE events
+        SET available_seats = COALESCE(available_seats, 0) + $1,
+            updated_at = NOW(),
+            version = version + 1 -- Invalide les ETag : UpdateEvent réécrit available_seats
+        WHERE id = $2`,
+        quantity, eventID)
+    if err != nil {
+        return fmt.Errorf("erreur lors de la remise en vente des places: %v", err)
+    }
+
+    if err = tx.Commit(); err != nil {
+        return fmt.Errorf("erreur lors de la validation de la transaction: %v", err)
+    }
+    return nil
+}
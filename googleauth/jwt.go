@@ -2,6 +2,8 @@ package googleauth
 
 import (
 	"fmt"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
@@ -64,3 +66,24 @@ func ValidateJWTToken(tokenString string, secretKey string) (jwt.MapClaims, erro
 	}
 	return nil, fmt.Errorf("invalid token")
 }
+
+// ExtraireUtilisateur valide le token Bearer de la requête et retourne le google ID et l'email de l'utilisateur
+func ExtraireUtilisateur(r *http.Request) (string, string, error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return "", "", fmt.Errorf("Authorization header is missing")
+	}
+
+	claims, err := ValidateJWTToken(strings.TrimPrefix(authHeader, "Bearer "), string(jwtKey))
+	if err != nil {
+		return "", "", fmt.Errorf("Token JWT invalide : %v", err)
+	}
+
+	googleID, ok := claims["user_id"].(string)
+	if !ok || googleID == "" {
+		return "", "", fmt.Errorf("L'ID utilisateur est manquant dans le token")
+	}
+
+	email, _ := claims["email"].(string)
+	return googleID, email, nil
+}
@@ -0,0 +1,69 @@
+package inventaire
+
+import (
+    "ecommerce-api/admin"
+    "ecommerce-api/models"
+    "fmt"
+    "log"
+    "time"
+)
+
+// ListerStockBas retourne les produits dont le stock est inférieur ou égal à leur seuil d'alerte,
+// les plus critiques d'abord.
+func (r *Repository) ListerStockBas() ([]models.ProduitStockBas, error) {
+    produits := []models.ProduitStockBas{}
+    err := r.db.Select(&produits, `
+        SELECT id, nom, COALESCE(marque, '') AS marque, stock, seuil_stock_bas, disponible, indisponible_auto
+        FROM produits
+        WHERE stock <= seuil_stock_bas
+        ORDER BY stock, nom`)
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors de la récupération des produits en stock bas: %v", err)
+    }
+    return produits, nil
+}
+
+// DemarrerRecapStockBas envoie chaque jour à l'heure indiquée (0-23, heure locale du serveur)
+// le récapitulatif des produits en stock bas à tous les administrateurs actifs.
+func DemarrerRecapStockBas(repo *Repository, adminRepo *admin.AdminRepository, emailService models.StockBasEmailService, heure int) {
+    go func() {
+        for {
+            time.Sleep(time.Until(prochaineExecution(time.Now(), heure)))
+            envoyerRecapStockBas(repo, adminRepo, emailService)
+        }
+    }()
+}
+
+// prochaineExecution retourne la prochaine occurrence de l'heure indiquée après maintenant.
+func prochaineExecution(maintenant time.Time, heure int) time.Time {
+    prochaine := time.Date(maintenant.Year(), maintenant.Month(), maintenant.Day(), heure, 0, 0, 0, maintenant.Location())
+    if !prochaine.After(maintenant) {
+        prochaine = prochaine.AddDate(0, 0, 1)
+    }
+    return prochaine
+}
+
+func envoyerRecapStockBas(repo *Repository, adminRepo *admin.AdminRepository, emailService models.StockBasEmailService) {
+    produits, err := repo.ListerStockBas()
+    if err != nil {
+        log.Printf("Récapitulatif stock bas : %v", err)
+        return
+    }
+    if len(produits) == 0 {
+        return
+    }
+
+    destinataires, err := adminRepo.ListerEmailsAdmins()
+    if err != nil {
+        log.Printf("Récapitulatif stock bas : %v", err)
+        return
+    }
+    if len(destinataires) == 0 {
+        log.Printf("Récapitulatif stock bas : aucun administrateur actif à prévenir")
+        return
+    }
+
+    if err := emailService.EnvoyerEmailStockBas(destinataires, produits); err != nil {
+        log.Printf("Erreur lors de l'envoi du récapitulatif stock bas: %v", err)
+    }
+}
@@ -0,0 +1,367 @@
+package inventaire
+
+import (
+    "database/sql"
+    "ecommerce-api/models"
+    "errors"
+    "fmt"
+
+    "github.com/jmoiron/sqlx"
+)
+
+var (
+    ErrEmplacementIntrouvable = errors.New("emplacement introuvable")
+    ErrEmplacementNonVide     = errors.New("l'emplacement contient encore du stock")
+    ErrEmplacementInactif     = errors.New("l'emplacement est désactivé")
+)
+
+// expressionDistance calcule en SQL la distance en km (formule de haversine) entre l'emplacement e
+// et la position passée dans les paramètres $lat et $lng. NULL si l'emplacement n'a pas de coordonnées.
+func expressionDistance(lat, lng int) string {
+    return fmt.Sprintf(`6371 * 2 * asin(sqrt(
+        power(sin(radians(e.latitude - $%[1]d) / 2), 2) +
+        cos(radians($%[1]d)) * cos(radians(e.latitude)) * power(sin(radians(e.longitude - $%[2]d) / 2), 2)))`, lat, lng)
+}
+
+// stockLocalise retourne la quantité d'un article répartie dans les emplacements.
+func stockLocalise(tx *sqlx.Tx, produitID, varianteID string) (int, error) {
+    var quantite int
+    err := tx.QueryRow(`
+        SELECT COALESCE(SUM(quantite), 0)
+        FROM stock_emplacements
+        WHERE produit_id = $1 AND variante_id IS NOT DISTINCT FROM NULLIF($2, '')::uuid`,
+        produitID, varianteID).Scan(&quantite)
+    if err != nil {
+        return 0, fmt.Errorf("erreur lors de la lecture du stock par emplacement: %v", err)
+    }
+    return quantite, nil
+}
+
+// verifierStockNonAffecte s'assure que la part du stock hors emplacements couvre la quantité demandée.
+func verifierStockNonAffecte(tx *sqlx.Tx, produitID, varianteID string, stock, quantite int) error {
+    localise, err := stockLocalise(tx, produitID, varianteID)
+    if err != nil {
+        return err
+    }
+    if stock-localise < quantite {
+        return fmt.Errorf("%w hors emplacement (demandé: %d, disponible: %d)", ErrStockInsuffisant, quantite, stock-localise)
+    }
+    return nil
+}
+
+// modifierStockEmplacement ajoute delta (signé) à la quantité de l'article dans l'emplacement.
+// L'article doit déjà être verrouillé par l'appelant.
+func modifierStockEmplacement(tx *sqlx.Tx, emplacementID, produitID, varianteID string, delta int) error {
+    var actif bool
+    err := tx.QueryRow(`SELECT actif FROM emplacements WHERE id = $1`, emplacementID).Scan(&actif)
+    if err == sql.ErrNoRows {
+        return ErrEmplacementIntrouvable
+    } else if err != nil {
+        return fmt.Errorf("erreur lors de la lecture de l'emplacement: %v", err)
+    }
+    if !actif {
+        return ErrEmplacementInactif
+    }
+
+    var quantite int
+    err = tx.QueryRow(`
+        SELECT quantite FROM stock_emplacements
+        WHERE emplacement_id = $1 AND produit_id = $2 AND variante_id IS NOT DISTINCT FROM NULLIF($3, '')::uuid
+        FOR UPDATE`,
+        emplacementID, produitID, varianteID).Scan(&quantite)
+    if err != nil && err != sql.ErrNoRows {
+        return fmt.Errorf("erreur lors de la lecture du stock de l'emplacement: %v", err)
+    }
+    if quantite+delta < 0 {
+        return fmt.Errorf("%w dans l'emplacement (demandé: %d, disponible: %d)", ErrStockInsuffisant, -delta, quantite)
+    }
+
+    if err == sql.ErrNoRows {
+        _, err = tx.Exec(`
+            INSERT INTO stock_emplacements (emplacement_id, produit_id, variante_id, quantite)
+            VALUES ($1, $2, NULLIF($3, '')::uuid, $4)`,
+            emplacementID, produitID, varianteID, delta)
+    } else {
+        _, err = tx.Exec(`
+            UPDATE stock_emplacements
+            SET quantite = quantite + $4, updated_at = NOW()
+            WHERE emplacement_id = $1 AND produit_id = $2 AND variante_id IS NOT DISTINCT FROM NULLIF($3, '')::uuid`,
+            emplacementID, produitID, varianteID, delta)
+    }
+    if err != nil {
+        return fmt.Errorf("erreur lors de la mise à jour du stock de l'emplacement: %v", err)
+    }
+    return nil
+}
+
+// Prelevement est la quantité d'un article à sortir d'un emplacement ("" : stock non affecté).
+type Prelevement struct {
+    EmplacementID string `db:"emplacement_id"`
+    Quantite      int    `db:"quantite"`
+}
+
+// AllouerEmplacements répartit la quantité demandée entre les emplacements d'où elle sortira.
+// L'emplacement choisi par le client est retenu s'il est actif. Sinon, les emplacements actifs sont
+// classés du plus proche de origine au plus éloigné (ou du mieux fourni au moins fourni, sans position)
+// et la répartition suit repartirPrelevements.
+func AllouerEmplacements(tx *sqlx.Tx, produitID, varianteID string, quantite int, choisi string, origine *models.Position) ([]Prelevement, error) {
+    if choisi != "" {
+        var actif bool
+        err := tx.QueryRow(`SELECT actif FROM emplacements WHERE id = $1`, choisi).Scan(&actif)
+        if err == sql.ErrNoRows || (err == nil && !actif) {
+            return nil, ErrEmplacementIntrouvable
+        } else if err != nil {
+            return nil, fmt.Errorf("erreur lors de la lecture de l'emplacement: %v", err)
+        }
+        return []Prelevement{{EmplacementID: choisi, Quantite: quantite}}, nil
+    }
+
+    stock, err := verrouillerArticle(tx, produitID, varianteID)
+    if err != nil {
+        return nil, err
+    }
+    localise, err := stockLocalise(tx, produitID, varianteID)
+    if err != nil {
+        return nil, err
+    }
+
+    query := `
+        SELECT se.emplacement_id, se.quantite
+        FROM stock_emplacements se
+        JOIN emplacements e ON e.id = se.emplacement_id AND e.actif
+        WHERE se.produit_id = $1
+          AND se.variante_id IS NOT DISTINCT FROM NULLIF($2, '')::uuid
+          AND se.quantite > 0`
+    args := []interface{}{produitID, varianteID}
+    if origine != nil {
+        query += " ORDER BY " + expressionDistance(3, 4) + " NULLS LAST, se.quantite DESC"
+        args = append(args, origine.Latitude, origine.Longitude)
+    } else {
+        query += " ORDER BY se.quantite DESC"
+    }
+
+    disponibles := []Prelevement{}
+    if err := tx.Select(&disponibles, query, args...); err != nil {
+        return nil, fmt.Errorf("erreur lors de l'allocation de l'emplacement: %v", err)
+    }
+    return repartirPrelevements(disponibles, stock-localise, quantite), nil
+}
+
+// repartirPrelevements répartit quantite entre les emplacements disponibles, déjà classés par préférence,
+// et le stock non affecté. Dans l'ordre : le premier emplacement qui dispose de toute la quantité ;
+// sinon le stock non affecté s'il suffit ; sinon les emplacements dans l'ordre, puis le stock non affecté
+// pour le reste. Si le stock ne suffit pas, le reste est quand même prélevé hors emplacement et le
+// mouvement échouera avec ErrStockInsuffisant.
+func repartirPrelevements(disponibles []Prelevement, nonAffecte, quantite int) []Prelevement {
+    for _, d := range disponibles {
+        if d.Quantite >= quantite {
+            return []Prelevement{{EmplacementID: d.EmplacementID, Quantite: quantite}}
+        }
+    }
+    if nonAffecte >= quantite {
+        return []Prelevement{{Quantite: quantite}}
+    }
+
+    prelevements := []Prelevement{}
+    reste := quantite
+    for _, d := range disponibles {
+        if reste == 0 {
+            break
+        }
+        preleve := min(d.Quantite, reste)
+        prelevements = append(prelevements, Prelevement{EmplacementID: d.EmplacementID, Quantite: preleve})
+        reste -= preleve
+    }
+    if reste > 0 {
+        prelevements = append(prelevements, Prelevement{Quantite: reste})
+    }
+    return prelevements
+}
+
+// ListerDisponibilites retourne, pour un produit, la quantité disponible dans chaque emplacement actif,
+// du plus proche au plus éloigné si origine est fournie.
+func ListerDisponibilites(db sqlx.Queryer, produitID string, origine *models.Position) ([]models.StockEmplacement, error) {
+    distance := "NULL::float8"
+    args := []interface{}{produitID}
+    if origine != nil {
+        distance = expressionDistance(2, 3)
+        args = append(args, origine.Latitude, origine.Longitude)
+    }
+
+    disponibilites := []models.StockEmplacement{}
+    err := sqlx.Select(db, &disponibilites, `
+        SELECT se.emplacement_id, e.nom, e.type, e.localisation, se.produit_id,
+               COALESCE(se.variante_id::text, '') AS variante_id, se.quantite,
+               `+distance+` AS distance_km
+        FROM stock_emplacements se
+        JOIN emplacements e ON e.id = se.emplacement_id AND e.actif
+        WHERE se.produit_id = $1 AND se.quantite > 0
+        ORDER BY distance_km NULLS LAST, e.nom`, args...)
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors de la récupération des disponibilités: %v", err)
+    }
+    return disponibilites, nil
+}
+
+// Transferer déplace une quantité d'un emplacement à un autre sans modifier le stock total.
+// Une source ou une destination vide désigne le stock non affecté. Le transfert est inscrit
+// au journal sous forme de deux mouvements opposés.
+func (r *Repository) Transferer(m models.MouvementStock, destinationID string) ([]models.MouvementStock, error) {
+    if m.Quantite <= 0 {
+        return nil, fmt.Errorf("la quantité transférée doit être supérieure à 0")
+    }
+    if m.EmplacementID == destinationID {
+        return nil, fmt.Errorf("la source et la destination doivent être différentes")
+    }
+
+    tx, err := r.db.Beginx()
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors du début de la transaction: %v", err)
+    }
+    defer tx.Rollback()
+
+    stock, err := verrouillerArticle(tx, m.ProduitID, m.VarianteID)
+    if err != nil {
+        return nil, err
+    }
+
+    if m.EmplacementID == "" {
+        err = verifierStockNonAffecte(tx, m.ProduitID, m.VarianteID, stock, m.Quantite)
+    } else {
+        err = modifierStockEmplacement(tx, m.EmplacementID, m.ProduitID, m.VarianteID, -m.Quantite)
+    }
+    if err != nil {
+        return nil, err
+    }
+    if destinationID != "" {
+        if err := modifierStockEmplacement(tx, destinationID, m.ProduitID, m.VarianteID, m.Quantite); err != nil {
+            return nil, err
+        }
+    }
+
+    sortie := m
+    sortie.Quantite = -m.Quantite
+    sortie.StockApres = stock
+    sortie.Raison = models.RaisonTransfert
+    entree := sortie
+    entree.Quantite = m.Quantite
+    entree.EmplacementID = destinationID
+
+    if err := inscrireMouvement(tx, &sortie); err != nil {
+        return nil, err
+    }
+    if err := inscrireMouvement(tx, &entree); err != nil {
+        return nil, err
+    }
+
+    if err = tx.Commit(); err != nil {
+        return nil, fmt.Errorf("erreur lors de la validation de la transaction: %v", err)
+    }
+    return []models.MouvementStock{sortie, entree}, nil
+}
+
+const selectEmplacements = `
+        SELECT id, nom, type, COALESCE(adresse, '') AS adresse, localisation, latitude, longitude,
+               actif, created_at, updated_at
+        FROM emplacements`
+
+// ListerEmplacements retourne tous les emplacements, actifs ou non.
+func (r *Repository) ListerEmplacements() ([]models.Emplacement, error) {
+    emplacements := []models.Emplacement{}
+    if err := r.db.Select(&emplacements, selectEmplacements+" ORDER BY nom"); err != nil {
+        return nil, fmt.Errorf("erreur lors de la récupération des emplacements: %v", err)
+    }
+    return emplacements, nil
+}
+
+func validerEmplacement(e models.Emplacement) error {
+    if e.Nom == "" || e.Localisation == "" {
+        return fmt.Errorf("le nom et la localisation sont obligatoires")
+    }
+    if e.Type != models.EmplacementEntrepot && e.Type != models.EmplacementBoutique {
+        return fmt.Errorf("type d'emplacement invalide %q (valeurs possibles : entrepot, boutique)", e.Type)
+    }
+    if (e.Latitude == nil) != (e.Longitude == nil) {
+        return fmt.Errorf("la latitude et la longitude doivent être fournies ensemble")
+    }
+    return nil
+}
+
+// CreerEmplacement enregistre un nouvel emplacement.
+func (r *Repository) CreerEmplacement(e models.Emplacement) (*models.Emplacement, error) {
+    if err := validerEmplacement(e); err != nil {
+        return nil, err
+    }
+
+    var cree models.Emplacement
+    err := r.db.Get(&cree, `
+        INSERT INTO emplacements (nom, type, adresse, localisation, latitude, longitude, actif)
+        VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7)
+        RETURNING id, nom, type, COALESCE(adresse, '') AS adresse, localisation, latitude, longitude,
+                  actif, created_at, updated_at`,
+        e.Nom, e.Type, e.Adresse, e.Localisation, e.Latitude, e.Longitude, e.Actif)
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors de la création de l'emplacement: %v", err)
+    }
+    return &cree, nil
+}
+
+// ModifierEmplacement remplace les informations d'un emplacement.
+func (r *Repository) ModifierEmplacement(id string, e models.Emplacement) (*models.Emplacement, error) {
+    if err := validerEmplacement(e); err != nil {
+        return nil, err
+    }
+
+    var modifie models.Emplacement
+    err := r.db.Get(&modifie, `
+        UPDATE emplacements
+        SET nom = $1, type = $2, adresse = NULLIF($3, ''), localisation = $4,
+            latitude = $5, longitude = $6, actif = $7, updated_at = NOW()
+        WHERE id = $8
+        RETURNING id, nom, type, COALESCE(adresse, '') AS adresse, localisation, latitude, longitude,
+                  actif, created_at, updated_at`,
+        e.Nom, e.Type, e.Adresse, e.Localisation, e.Latitude, e.Longitude, e.Actif, id)
+    if err == sql.ErrNoRows {
+        return nil, ErrEmplacementIntrouvable
+    } else if err != nil {
+        return nil, fmt.Errorf("erreur lors de la mise à jour de l'emplacement: %v", err)
+    }
+    return &modifie, nil
+}
+
+// SupprimerEmplacement supprime un emplacement vide ; s'il détient du stock, il faut d'abord le transférer.
+func (r *Repository) SupprimerEmplacement(id string) error {
+    var quantite int
+    err := r.db.QueryRow(`SELECT COALESCE(SUM(quantite), 0) FROM stock_emplacements WHERE emplacement_id = $1`, id).Scan(&quantite)
+    if err != nil {
+        return fmt.Errorf("erreur lors de la lecture du stock de l'emplacement: %v", err)
+    }
+    if quantite > 0 {
+        return fmt.Errorf("%w (%d unités)", ErrEmplacementNonVide, quantite)
+    }
+
+    result, err := r.db.Exec(`DELETE FROM emplacements WHERE id = $1`, id)
+    if err != nil {
+        return fmt.Errorf("erreur lors de la suppression de l'emplacement: %v", err)
+    }
+    if n, err := result.RowsAffected(); err == nil && n == 0 {
+        return ErrEmplacementIntrouvable
+    }
+    return nil
+}
+
+// ListerStockEmplacement retourne les articles présents dans un emplacement.
+func (r *Repository) ListerStockEmplacement(id string) ([]models.StockEmplacement, error) {
+    stock := []models.StockEmplacement{}
+    err := r.db.Select(&stock, `
+        SELECT se.emplacement_id, e.nom, e.type, e.localisation, se.produit_id,
+               COALESCE(se.variante_id::text, '') AS variante_id, se.quantite, NULL::float8 AS distance_km
+        FROM stock_emplacements se
+        JOIN emplacements e ON e.id = se.emplacement_id
+        WHERE se.emplacement_id = $1 AND se.quantite > 0
+        ORDER BY se.produit_id`, id)
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors de la récupération du stock de l'emplacement: %v", err)
+    }
+    return stock, nil
+}
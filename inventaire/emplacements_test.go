@@ -0,0 +1,43 @@
+package inventaire
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestRepartirPrelevements(t *testing.T) {
+    // Emplacements déjà classés du plus proche au plus éloigné
+    disponibles := []Prelevement{
+        {EmplacementID: "lyon", Quantite: 2},
+        {EmplacementID: "paris", Quantite: 5},
+        {EmplacementID: "lille", Quantite: 3},
+    }
+
+    cas := []struct {
+        nom         string
+        disponibles []Prelevement
+        nonAffecte  int
+        quantite    int
+        attendu     []Prelevement
+    }{
+        {"le plus proche suffit", disponibles, 0, 2,
+            []Prelevement{{EmplacementID: "lyon", Quantite: 2}}},
+        {"premier emplacement qui dispose de tout", disponibles, 10, 4,
+            []Prelevement{{EmplacementID: "paris", Quantite: 4}}},
+        {"stock non affecté avant de répartir", disponibles, 6, 6,
+            []Prelevement{{Quantite: 6}}},
+        {"répartition entre emplacements", disponibles, 0, 9,
+            []Prelevement{{EmplacementID: "lyon", Quantite: 2}, {EmplacementID: "paris", Quantite: 5}, {EmplacementID: "lille", Quantite: 2}}},
+        {"reste sur le stock non affecté", disponibles, 2, 12,
+            []Prelevement{{EmplacementID: "lyon", Quantite: 2}, {EmplacementID: "paris", Quantite: 5}, {EmplacementID: "lille", Quantite: 3}, {Quantite: 2}}},
+        {"stock insuffisant", disponibles, 0, 11,
+            []Prelevement{{EmplacementID: "lyon", Quantite: 2}, {EmplacementID: "paris", Quantite: 5}, {EmplacementID: "lille", Quantite: 3}, {Quantite: 1}}},
+        {"aucun emplacement", nil, 4, 3,
+            []Prelevement{{Quantite: 3}}},
+    }
+    for _, c := range cas {
+        if obtenu := repartirPrelevements(c.disponibles, c.nonAffecte, c.quantite); !reflect.DeepEqual(obtenu, c.attendu) {
+            t.Errorf("%s : %+v, attendu %+v", c.nom, obtenu, c.attendu)
+        }
+    }
+}
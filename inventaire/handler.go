@@ -0,0 +1,331 @@
+package inventaire
+
+import (
+    "ecommerce-api/admin"
+    "ecommerce-api/models"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "strconv"
+
+    "github.com/go-chi/chi/v5"
+    "github.com/google/uuid"
+)
+
+type Handler struct {
+    repo *Repository
+}
+
+func NewHandler(repo *Repository) *Handler {
+    return &Handler{repo: repo}
+}
+
+// HandleAjustement enregistre un ajustement manuel ou un retour ; quantite est signée.
+func (h *Handler) HandleAjustement(w http.ResponseWriter, r *http.Request) {
+    var req struct {
+        ProduitID     string `json:"produit_id"`
+        VarianteID    string `json:"variante_id"`
+        EmplacementID string `json:"emplacement_id"`
+        Quantite      int    `json:"quantite"`
+        Raison        string `json:"raison"`
+        Reference     string `json:"reference"`
+        Commentaire   string `json:"commentaire"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Requête invalide", http.StatusBadRequest)
+        return
+    }
+    if _, err := uuid.Parse(req.ProduitID); err != nil {
+        http.Error(w, "produit_id invalide", http.StatusBadRequest)
+        return
+    }
+    if !idsValides(req.VarianteID, req.EmplacementID) {
+        http.Error(w, "variante_id ou emplacement_id invalide", http.StatusBadRequest)
+        return
+    }
+    if req.Quantite == 0 {
+        http.Error(w, "La quantité doit être non nulle", http.StatusBadRequest)
+        return
+    }
+    if req.Commentaire == "" {
+        http.Error(w, "Un commentaire est requis pour justifier le mouvement", http.StatusBadRequest)
+        return
+    }
+    if req.Raison == "" {
+        req.Raison = models.RaisonAjustement
+    }
+
+    mouvement, err := h.repo.Ajuster(models.MouvementStock{
+        ProduitID:     req.ProduitID,
+        VarianteID:    req.VarianteID,
+        EmplacementID: req.EmplacementID,
+        Quantite:      req.Quantite,
+        Raison:        req.Raison,
+        Reference:     req.Reference,
+        Commentaire:   req.Commentaire,
+        CreePar:       admin.AdminEmail(r),
+    })
+    if err != nil {
+        ecrireErreurInventaire(w, err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "status": "success",
+        "data":   mouvement,
+    })
+}
+
+// HandleListerMouvements retourne le journal, filtrable par produit_id et variante_id.
+func (h *Handler) HandleListerMouvements(w http.ResponseWriter, r *http.Request) {
+    query := r.URL.Query()
+    produitID := query.Get("produit_id")
+    varianteID := query.Get("variante_id")
+    if !idsValides(produitID, varianteID) {
+        http.Error(w, "Format d'ID invalide", http.StatusBadRequest)
+        return
+    }
+
+    limite, err := strconv.Atoi(query.Get("limit"))
+    if err != nil || limite <= 0 || limite > 500 {
+        limite = 100
+    }
+
+    mouvements, err := h.repo.ListerMouvements(produitID, varianteID, limite)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "status": "success",
+        "data":   mouvements,
+    })
+}
+
+// HandleListerEcarts retourne les articles dont le stock diffère de la somme du journal.
+func (h *Handler) HandleListerEcarts(w http.ResponseWriter, r *http.Request) {
+    ecarts, err := h.repo.ListerEcarts()
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "status": "success",
+        "data":   ecarts,
+    })
+}
+
+// HandleListerStockBas retourne les produits dont le stock a atteint leur seuil d'alerte.
+func (h *Handler) HandleListerStockBas(w http.ResponseWriter, r *http.Request) {
+    produits, err := h.repo.ListerStockBas()
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "status": "success",
+        "data":   produits,
+    })
+}
+
+// HandleTransfert déplace du stock entre deux emplacements ; une source ou une destination vide
+// désigne le stock non affecté.
+func (h *Handler) HandleTransfert(w http.ResponseWriter, r *http.Request) {
+    var req struct {
+        ProduitID     string `json:"produit_id"`
+        VarianteID    string `json:"variante_id"`
+        SourceID      string `json:"source_id"`
+        DestinationID string `json:"destination_id"`
+        Quantite      int    `json:"quantite"`
+        Commentaire   string `json:"commentaire"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Requête invalide", http.StatusBadRequest)
+        return
+    }
+    if _, err := uuid.Parse(req.ProduitID); err != nil || !idsValides(req.VarianteID, req.SourceID, req.DestinationID) {
+        http.Error(w, "Format d'ID invalide", http.StatusBadRequest)
+        return
+    }
+
+    mouvements, err := h.repo.Transferer(models.MouvementStock{
+        ProduitID:     req.ProduitID,
+        VarianteID:    req.VarianteID,
+        EmplacementID: req.SourceID,
+        Quantite:      req.Quantite,
+        Commentaire:   req.Commentaire,
+        CreePar:       admin.AdminEmail(r),
+    }, req.DestinationID)
+    if err != nil {
+        ecrireErreurInventaire(w, err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "status": "success",
+        "data":   mouvements,
+    })
+}
+
+// HandleListerEmplacements retourne tous les emplacements de stock.
+func (h *Handler) HandleListerEmplacements(w http.ResponseWriter, r *http.Request) {
+    emplacements, err := h.repo.ListerEmplacements()
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "status": "success",
+        "data":   emplacements,
+    })
+}
+
+// emplacementDepuisRequete décode un emplacement ; il est actif sauf mention contraire.
+func emplacementDepuisRequete(r *http.Request) (models.Emplacement, error) {
+    var req struct {
+        models.Emplacement
+        Actif *bool `json:"actif"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        return models.Emplacement{}, err
+    }
+    emplacement := req.Emplacement
+    emplacement.Actif = req.Actif == nil || *req.Actif
+    if emplacement.Type == "" {
+        emplacement.Type = models.EmplacementEntrepot
+    }
+    return emplacement, nil
+}
+
+// HandleCreerEmplacement crée un entrepôt ou une boutique.
+func (h *Handler) HandleCreerEmplacement(w http.ResponseWriter, r *http.Request) {
+    emplacement, err := emplacementDepuisRequete(r)
+    if err != nil {
+        http.Error(w, "Requête invalide", http.StatusBadRequest)
+        return
+    }
+
+    cree, err := h.repo.CreerEmplacement(emplacement)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "status": "success",
+        "data":   cree,
+    })
+}
+
+// HandleModifierEmplacement met à jour un emplacement.
+func (h *Handler) HandleModifierEmplacement(w http.ResponseWriter, r *http.Request) {
+    id := chi.URLParam(r, "id")
+    if _, err := uuid.Parse(id); err != nil {
+        http.Error(w, "Format d'ID invalide", http.StatusBadRequest)
+        return
+    }
+
+    emplacement, err := emplacementDepuisRequete(r)
+    if err != nil {
+        http.Error(w, "Requête invalide", http.StatusBadRequest)
+        return
+    }
+
+    modifie, err := h.repo.ModifierEmplacement(id, emplacement)
+    if errors.Is(err, ErrEmplacementIntrouvable) {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "status": "success",
+        "data":   modifie,
+    })
+}
+
+// HandleSupprimerEmplacement supprime un emplacement vide.
+func (h *Handler) HandleSupprimerEmplacement(w http.ResponseWriter, r *http.Request) {
+    id := chi.URLParam(r, "id")
+    if _, err := uuid.Parse(id); err != nil {
+        http.Error(w, "Format d'ID invalide", http.StatusBadRequest)
+        return
+    }
+
+    if err := h.repo.SupprimerEmplacement(id); err != nil {
+        ecrireErreurInventaire(w, err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]string{
+        "message": "Emplacement supprimé avec succès",
+        "status":  "success",
+    })
+}
+
+// HandleStockEmplacement retourne les articles présents dans un emplacement.
+func (h *Handler) HandleStockEmplacement(w http.ResponseWriter, r *http.Request) {
+    id := chi.URLParam(r, "id")
+    if _, err := uuid.Parse(id); err != nil {
+        http.Error(w, "Format d'ID invalide", http.StatusBadRequest)
+        return
+    }
+
+    stock, err := h.repo.ListerStockEmplacement(id)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "status": "success",
+        "data":   stock,
+    })
+}
+
+// idsValides vérifie que chaque identifiant fourni est un UUID ; les valeurs vides sont acceptées.
+func idsValides(ids ...string) bool {
+    for _, id := range ids {
+        if id == "" {
+            continue
+        }
+        if _, err := uuid.Parse(id); err != nil {
+            return false
+        }
+    }
+    return true
+}
+
+func ecrireErreurInventaire(w http.ResponseWriter, err error) {
+    switch {
+    case errors.Is(err, ErrArticleIntrouvable), errors.Is(err, ErrEmplacementIntrouvable):
+        http.Error(w, err.Error(), http.StatusNotFound)
+    case errors.Is(err, ErrStockInsuffisant), errors.Is(err, ErrEmplacementNonVide), errors.Is(err, ErrEmplacementInactif):
+        http.Error(w, err.Error(), http.StatusConflict)
+    case errors.Is(err, ErrRaisonInvalide), errors.Is(err, ErrVarianteRequise):
+        http.Error(w, err.Error(), http.StatusBadRequest)
+    default:
+        http.Error(w, fmt.Sprintf("Erreur lors du mouvement de stock : %v", err), http.StatusInternalServerError)
+    }
+}
@@ -0,0 +1,208 @@
+package inventaire
+
+import (
+    "database/sql"
+    "ecommerce-api/models"
+    "errors"
+    "fmt"
+
+    "github.com/jmoiron/sqlx"
+)
+
+var (
+    ErrArticleIntrouvable = errors.New("produit ou variante introuvable")
+    ErrStockInsuffisant   = errors.New("stock insuffisant")
+    ErrRaisonInvalide     = errors.New("raison de mouvement invalide")
+    ErrVarianteRequise    = errors.New("ce produit a des variantes : le mouvement doit porter sur une variante")
+)
+
+var raisonsValides = map[string]bool{
+    models.RaisonVente:      true,
+    models.RaisonAnnulation: true,
+    models.RaisonAjustement: true,
+    models.RaisonRetour:     true,
+    models.RaisonImport:     true,
+}
+
+type Repository struct {
+    db *sqlx.DB
+}
+
+func NewRepository(db *sqlx.DB) *Repository {
+    return &Repository{db: db}
+}
+
+// verrouillerArticle verrouille le produit (ou la variante) et retourne son stock total.
+func verrouillerArticle(tx *sqlx.Tx, produitID, varianteID string) (int, error) {
+    var stock int
+    if varianteID == "" {
+        var aVariantes bool
+        err := tx.QueryRow(`
+            SELECT stock, EXISTS (SELECT 1 FROM produit_variantes WHERE produit_id = produits.id)
+            FROM produits WHERE id = $1 FOR UPDATE`, produitID).Scan(&stock, &aVariantes)
+        if err == sql.ErrNoRows {
+            return 0, ErrArticleIntrouvable
+        } else if err != nil {
+            return 0, fmt.Errorf("erreur lors de la lecture du stock: %v", err)
+        }
+        if aVariantes {
+            return 0, ErrVarianteRequise
+        }
+        return stock, nil
+    }
+
+    err := tx.QueryRow(`
+        SELECT stock FROM produit_variantes WHERE id = $1 AND produit_id = $2 FOR UPDATE`,
+        varianteID, produitID).Scan(&stock)
+    if err == sql.ErrNoRows {
+        return 0, ErrArticleIntrouvable
+    } else if err != nil {
+        return 0, fmt.Errorf("erreur lors de la lecture du stock: %v", err)
+    }
+    return stock, nil
+}
+
+// AppliquerMouvement modifie le stock du produit (ou de la variante) et inscrit le mouvement au journal,
+// dans la transaction de l'appelant. C'est le seul chemin par lequel le stock doit évoluer.
+// Si m.EmplacementID est renseigné, la quantité de cet emplacement évolue aussi ; sinon le mouvement
+// porte sur le stock non affecté. m.StockApres, m.ID et m.CreatedAt sont renseignés en retour.
+func AppliquerMouvement(tx *sqlx.Tx, m *models.MouvementStock) error {
+    if !raisonsValides[m.Raison] {
+        return fmt.Errorf("%w : %q", ErrRaisonInvalide, m.Raison)
+    }
+    if m.Quantite == 0 {
+        return fmt.Errorf("la quantité d'un mouvement ne peut pas être nulle")
+    }
+    if m.CreePar == "" {
+        m.CreePar = "système"
+    }
+
+    stock, err := verrouillerArticle(tx, m.ProduitID, m.VarianteID)
+    if err != nil {
+        return err
+    }
+
+    if stock+m.Quantite < 0 {
+        return fmt.Errorf("%w (demandé: %d, disponible: %d)", ErrStockInsuffisant, -m.Quantite, stock)
+    }
+    m.StockApres = stock + m.Quantite
+
+    if m.EmplacementID != "" {
+        if err := modifierStockEmplacement(tx, m.EmplacementID, m.ProduitID, m.VarianteID, m.Quantite); err != nil {
+            return err
+        }
+    } else if m.Quantite < 0 {
+        if err := verifierStockNonAffecte(tx, m.ProduitID, m.VarianteID, stock, -m.Quantite); err != nil {
+            return err
+        }
+    }
+
+    if m.VarianteID == "" {
+        _, err = tx.Exec(`UPDATE produits SET stock = $1, updated_at = NOW(), version = version + 1 WHERE id = $2`, m.StockApres, m.ProduitID)
+    } else {
+        // Le stock du produit suit par le trigger produit_variantes_stock
+        _, err = tx.Exec(`UPDATE produit_variantes SET stock = $1, updated_at = NOW() WHERE id = $2`, m.StockApres, m.VarianteID)
+    }
+    if err != nil {
+        return fmt.Errorf("erreur lors de la mise à jour du stock: %v", err)
+    }
+
+    return inscrireMouvement(tx, m)
+}
+
+func inscrireMouvement(tx *sqlx.Tx, m *models.MouvementStock) error {
+    // Le nom et le SKU sont recopiés pour que le mouvement reste lisible après suppression de l'article
+    err := tx.QueryRow(`
+        INSERT INTO inventory_movements (produit_id, variante_id, emplacement_id, quantite, stock_apres, raison, reference, commentaire, cree_par,
+                                         produit_nom, sku, sur_variante)
+        SELECT p.id, v.id, NULLIF($3, '')::uuid, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), $9,
+               p.nom, COALESCE(v.sku, p.sku), v.id IS NOT NULL
+        FROM produits p
+        LEFT JOIN produit_variantes v ON v.id = NULLIF($2, '')::uuid
+        WHERE p.id = $1
+        RETURNING id, COALESCE(produit_nom, ''), COALESCE(sku, ''), created_at`,
+        m.ProduitID, m.VarianteID, m.EmplacementID, m.Quantite, m.StockApres, m.Raison, m.Reference, m.Commentaire, m.CreePar,
+    ).Scan(&m.ID, &m.ProduitNom, &m.SKU, &m.CreatedAt)
+    if err != nil {
+        return fmt.Errorf("erreur lors de l'enregistrement du mouvement de stock: %v", err)
+    }
+    return nil
+}
+
+// Ajuster enregistre un mouvement manuel (ajustement ou retour) saisi par un administrateur.
+func (r *Repository) Ajuster(m models.MouvementStock) (*models.MouvementStock, error) {
+    if m.Raison != models.RaisonAjustement && m.Raison != models.RaisonRetour {
+        return nil, fmt.Errorf("%w : seules les raisons %q et %q peuvent être saisies manuellement",
+            ErrRaisonInvalide, models.RaisonAjustement, models.RaisonRetour)
+    }
+
+    tx, err := r.db.Beginx()
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors du début de la transaction: %v", err)
+    }
+    defer tx.Rollback()
+
+    if err := AppliquerMouvement(tx, &m); err != nil {
+        return nil, err
+    }
+
+    if err = tx.Commit(); err != nil {
+        return nil, fmt.Errorf("erreur lors de la validation de la transaction: %v", err)
+    }
+    return &m, nil
+}
+
+// ListerMouvements retourne le journal d'un produit, ou d'une variante si varianteID est renseigné,
+// du plus récent au plus ancien.
+func (r *Repository) ListerMouvements(produitID, varianteID string, limite int) ([]models.MouvementStock, error) {
+    mouvements := []models.MouvementStock{}
+    err := r.db.Select(&mouvements, `
+        SELECT id, COALESCE(produit_id::text, '') AS produit_id, COALESCE(variante_id::text, '') AS variante_id,
+               COALESCE(produit_nom, '') AS produit_nom, COALESCE(sku, '') AS sku,
+               COALESCE(emplacement_id::text, '') AS emplacement_id, quantite, stock_apres,
+               raison, COALESCE(reference, '') AS reference, COALESCE(commentaire, '') AS commentaire,
+               cree_par, created_at
+        FROM inventory_movements
+        WHERE ($1 = '' OR produit_id = NULLIF($1, '')::uuid)
+          AND ($2 = '' OR variante_id = NULLIF($2, '')::uuid)
+        ORDER BY created_at DESC
+        LIMIT $3`,
+        produitID, varianteID, limite)
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors de la récupération des mouvements de stock: %v", err)
+    }
+    return mouvements, nil
+}
+
+// ListerEcarts compare le stock de chaque produit sans variante et de chaque variante
+// à la somme de ses mouvements, et retourne ceux qui ne concordent pas.
+// Le stock d'un produit à variantes, dérivé par trigger, n'est pas journalisé ni contrôlé.
+func (r *Repository) ListerEcarts() ([]models.EcartStock, error) {
+    ecarts := []models.EcartStock{}
+    err := r.db.Select(&ecarts, `
+        SELECT p.id AS produit_id, '' AS variante_id, p.nom, '' AS sku, p.stock,
+               COALESCE(SUM(m.quantite), 0) AS stock_journal,
+               p.stock - COALESCE(SUM(m.quantite), 0) AS ecart
+        FROM produits p
+        LEFT JOIN inventory_movements m ON m.produit_id = p.id AND NOT m.sur_variante
+        WHERE NOT EXISTS (SELECT 1 FROM produit_variantes v WHERE v.produit_id = p.id)
+        GROUP BY p.id
+        HAVING p.stock <> COALESCE(SUM(m.quantite), 0)
+
+        UNION ALL
+
+        SELECT v.produit_id, v.id::text, p.nom, v.sku, v.stock,
+               COALESCE(SUM(m.quantite), 0),
+               v.stock - COALESCE(SUM(m.quantite), 0)
+        FROM produit_variantes v
+        JOIN produits p ON p.id = v.produit_id
+        LEFT JOIN inventory_movements m ON m.variante_id = v.id
+        GROUP BY v.id, p.nom
+        HAVING v.stock <> COALESCE(SUM(m.quantite), 0)
+
+        ORDER BY nom, sku`)
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors du contrôle des écarts de stock: %v", err)
+    }
+    return ecarts, nil
+}
@@ -0,0 +1,160 @@
+package inventaire
+
+import (
+    "ecommerce-api/models"
+    "errors"
+    "fmt"
+    "log"
+    "time"
+
+    "github.com/jmoiron/sqlx"
+)
+
+// ErrPanierVide est retournée quand il n'y a aucun produit à réserver.
+var ErrPanierVide = errors.New("le panier est vide : aucun produit à réserver")
+
+// DureeReservation est la durée pendant laquelle le stock reste bloqué après le début du checkout.
+const DureeReservation = 15 * time.Minute
+
+// ConditionReservationActive filtre les réservations qui bloquent encore du stock (alias rs).
+// Une réservation échue ne compte plus, même avant le passage du nettoyage.
+const ConditionReservationActive = "rs.statut = 'active' AND rs.expire_le > NOW()"
+
+// StockReserve retourne la quantité d'un article réservée par les autres utilisateurs.
+func StockReserve(tx *sqlx.Tx, produitID, varianteID, userID string) (int, error) {
+    var quantite int
+    err := tx.QueryRow(`
+        SELECT COALESCE(SUM(rs.quantite), 0)
+        FROM reservations_stock rs
+        WHERE rs.produit_id = $1
+          AND rs.variante_id IS NOT DISTINCT FROM NULLIF($2, '')::uuid
+          AND rs.user_id <> $3
+          AND `+ConditionReservationActive,
+        produitID, varianteID, userID).Scan(&quantite)
+    if err != nil {
+        return 0, fmt.Errorf("erreur lors de la lecture des réservations: %v", err)
+    }
+    return quantite, nil
+}
+
+// Reserver remplace les réservations actives de l'utilisateur par celles des lignes fournies,
+// valables pour la durée indiquée. Échoue si le stock non réservé par d'autres ne suffit pas.
+func (r *Repository) Reserver(userID string, lignes []models.CommandeProduit, duree time.Duration) ([]models.Reservation, error) {
+    if len(lignes) == 0 {
+        return nil, ErrPanierVide
+    }
+
+    tx, err := r.db.Beginx()
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors du début de la transaction: %v", err)
+    }
+    defer tx.Rollback()
+
+    if err := libererReservations(tx, userID); err != nil {
+        return nil, err
+    }
+
+    expireLe := time.Now().Add(duree)
+    reservations := []models.Reservation{}
+    for _, ligne := range lignes {
+        // Le verrou sur l'article sérialise les réservations concurrentes du même produit
+        stock, err := verrouillerArticle(tx, ligne.ProduitID, ligne.VarianteID)
+        if err != nil {
+            return nil, err
+        }
+        reserve, err := StockReserve(tx, ligne.ProduitID, ligne.VarianteID, userID)
+        if err != nil {
+            return nil, err
+        }
+        if stock-reserve < ligne.Quantite {
+            return nil, fmt.Errorf("%w pour le produit %s (demandé: %d, disponible: %d)",
+                ErrStockInsuffisant, ligne.ProduitID, ligne.Quantite, stock-reserve)
+        }
+
+        var reservation models.Reservation
+        err = tx.Get(&reservation, `
+            INSERT INTO reservations_stock (user_id, produit_id, variante_id, quantite, expire_le)
+            VALUES ($1, $2, NULLIF($3, '')::uuid, $4, $5)
+            RETURNING id, user_id, produit_id, COALESCE(variante_id::text, '') AS variante_id,
+                      quantite, statut, expire_le, '' AS commande_id, created_at`,
+            userID, ligne.ProduitID, ligne.VarianteID, ligne.Quantite, expireLe)
+        if err != nil {
+            return nil, fmt.Errorf("erreur lors de la création de la réservation: %v", err)
+        }
+        reservations = append(reservations, reservation)
+    }
+
+    if err = tx.Commit(); err != nil {
+        return nil, fmt.Errorf("erreur lors de la validation de la transaction: %v", err)
+    }
+    return reservations, nil
+}
+
+func libererReservations(tx *sqlx.Tx, userID string) error {
+    _, err := tx.Exec(`
+        UPDATE reservations_stock
+        SET statut = 'liberee', updated_at = NOW()
+        WHERE user_id = $1 AND statut = 'active'`, userID)
+    if err != nil {
+        return fmt.Errorf("erreur lors de la libération des réservations: %v", err)
+    }
+    return nil
+}
+
+// LibererReservations rend le stock réservé par l'utilisateur (checkout abandonné).
+func (r *Repository) LibererReservations(userID string) error {
+    tx, err := r.db.Beginx()
+    if err != nil {
+        return fmt.Errorf("erreur lors du début de la transaction: %v", err)
+    }
+    defer tx.Rollback()
+
+    if err := libererReservations(tx, userID); err != nil {
+        return err
+    }
+    return tx.Commit()
+}
+
+// ConvertirReservations rattache les réservations actives de l'utilisateur à la commande créée,
+// dans la transaction de la commande. Les réservations échues sont laissées au nettoyage.
+func ConvertirReservations(tx *sqlx.Tx, userID, commandeID string) error {
+    _, err := tx.Exec(`
+        UPDATE reservations_stock rs
+        SET statut = 'convertie', commande_id = $2, updated_at = NOW()
+        WHERE rs.user_id = $1 AND `+ConditionReservationActive, userID, commandeID)
+    if err != nil {
+        return fmt.Errorf("erreur lors de la conversion des réservations: %v", err)
+    }
+    return nil
+}
+
+// ExpirerReservations marque comme expirées les réservations échues et retourne leur nombre.
+func (r *Repository) ExpirerReservations() (int64, error) {
+    result, err := r.db.Exec(`
+        UPDATE reservations_stock
+        SET statut = 'expiree', updated_at = NOW()
+        WHERE statut = 'active' AND expire_le <= NOW()`)
+    if err != nil {
+        return 0, fmt.Errorf("erreur lors de l'expiration des réservations: %v", err)
+    }
+    return result.RowsAffected()
+}
+
+// DemarrerNettoyageReservations expire périodiquement les réservations échues.
+func DemarrerNettoyageReservations(repo *Repository, intervalle time.Duration) {
+    go func() {
+        ticker := time.NewTicker(intervalle)
+        defer ticker.Stop()
+
+        for range ticker.C {
+            n, err := repo.ExpirerReservations()
+            if err != nil {
+                log.Printf("Réservations de stock : %v", err)
+                continue
+            }
+            if n > 0 {
+                log.Printf("Réservations de stock : %d réservation(s) expirée(s)", n)
+            }
+        }
+    }()
+}
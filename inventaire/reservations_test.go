@@ -0,0 +1,14 @@
+package inventaire
+
+import (
+    "errors"
+    "testing"
+)
+
+// Un panier vide est refusé avant toute requête : le dépôt n'a pas besoin de base.
+func TestReserverPanierVide(t *testing.T) {
+    _, err := NewRepository(nil).Reserver("utilisateur", nil, DureeReservation)
+    if !errors.Is(err, ErrPanierVide) {
+        t.Fatalf("erreur %v, attendu ErrPanierVide", err)
+    }
+}
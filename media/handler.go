@@ -0,0 +1,63 @@
+package media
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+)
+
+type Handler struct {
+    repo *Repository
+}
+
+func NewHandler(repo *Repository) *Handler {
+    return &Handler{repo: repo}
+}
+
+// HandleTeleverser reçoit une image dans le champ multipart « image » et retourne
+// les URLs de ses déclinaisons, à ajouter aux photos d'un produit.
+func (h *Handler) HandleTeleverser(w http.ResponseWriter, r *http.Request) {
+    // Marge pour les en-têtes multipart en plus de l'image
+    r.Body = http.MaxBytesReader(w, r.Body, TailleMaxImage+1<<20)
+
+    fichier, _, err := r.FormFile("image")
+    if err != nil {
+        var tropGrand *http.MaxBytesError
+        if errors.As(err, &tropGrand) {
+            http.Error(w, fmt.Sprintf("Image trop volumineuse (maximum %d Mo)", TailleMaxImage>>20), http.StatusRequestEntityTooLarge)
+            return
+        }
+        http.Error(w, "Image manquante (champ « image »)", http.StatusBadRequest)
+        return
+    }
+    defer fichier.Close()
+
+    donnees, err := io.ReadAll(io.LimitReader(fichier, TailleMaxImage+1))
+    if err != nil {
+        http.Error(w, "Lecture de l'image impossible", http.StatusBadRequest)
+        return
+    }
+    if len(donnees) > TailleMaxImage {
+        http.Error(w, fmt.Sprintf("Image trop volumineuse (maximum %d Mo)", TailleMaxImage>>20), http.StatusRequestEntityTooLarge)
+        return
+    }
+
+    media, err := h.repo.Televerser(donnees)
+    if errors.Is(err, ErrImageInvalide) {
+        http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+        return
+    }
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "status": "success",
+        "data":   media,
+    })
+}
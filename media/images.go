@@ -0,0 +1,277 @@
+package media
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "image"
+    "image/draw"
+    "image/gif"
+    "image/jpeg"
+    "image/png"
+    "net/http"
+)
+
+// Limites appliquées aux images téléversées
+const (
+    TailleMaxImage   = 8 << 20    // 8 Mo
+    PixelsMaxImage   = 40_000_000 // Protège contre les images piégées de très grandes dimensions
+    CoteMedium       = 800
+    CoteMiniature    = 200
+    qualiteJPEG      = 85
+)
+
+// typesAcceptes associe les types MIME détectés à l'extension des fichiers produits.
+var typesAcceptes = map[string]string{
+    "image/jpeg": "jpg",
+    "image/png":  "png",
+    "image/gif":  "jpg", // Seule la première image d'un GIF animé est conservée
+}
+
+var ErrImageInvalide = errors.New("image invalide")
+
+// declinaison est une version encodée de l'image, prête à être stockée.
+type declinaison struct {
+    nom     string
+    contenu []byte
+}
+
+// traiterImage valide l'image puis produit l'original réencodé (ce qui supprime les
+// métadonnées EXIF), une version moyenne et une miniature. Retourne aussi l'extension des fichiers.
+func traiterImage(donnees []byte) ([]declinaison, string, error) {
+    typeMIME := http.DetectContentType(donnees)
+    extension, ok := typesAcceptes[typeMIME]
+    if !ok {
+        return nil, "", fmt.Errorf("%w : type %s non accepté (JPEG, PNG ou GIF)", ErrImageInvalide, typeMIME)
+    }
+
+    config, _, err := image.DecodeConfig(bytes.NewReader(donnees))
+    if err != nil {
+        return nil, "", fmt.Errorf("%w : %v", ErrImageInvalide, err)
+    }
+    if config.Width*config.Height > PixelsMaxImage {
+        return nil, "", fmt.Errorf("%w : dimensions trop grandes (%dx%d)", ErrImageInvalide, config.Width, config.Height)
+    }
+
+    var img image.Image
+    switch typeMIME {
+    case "image/jpeg":
+        img, err = jpeg.Decode(bytes.NewReader(donnees))
+    case "image/png":
+        img, err = png.Decode(bytes.NewReader(donnees))
+    case "image/gif":
+        img, err = gif.Decode(bytes.NewReader(donnees))
+    }
+    if err != nil {
+        return nil, "", fmt.Errorf("%w : %v", ErrImageInvalide, err)
+    }
+
+    source := versNRGBA(img)
+    if typeMIME == "image/jpeg" {
+        // L'orientation EXIF disparaît au réencodage : on l'applique aux pixels
+        source = orienter(source, orientationEXIF(donnees))
+    }
+
+    tailles := []struct {
+        nom  string
+        cote int
+    }{
+        {"original", 0},
+        {"medium", CoteMedium},
+        {"miniature", CoteMiniature},
+    }
+
+    declinaisons := make([]declinaison, 0, len(tailles))
+    for _, taille := range tailles {
+        rendu := source
+        if taille.cote > 0 {
+            rendu = redimensionner(source, taille.cote)
+        }
+        contenu, err := encoder(rendu, extension)
+        if err != nil {
+            return nil, "", fmt.Errorf("erreur lors de l'encodage de l'image : %v", err)
+        }
+        declinaisons = append(declinaisons, declinaison{nom: taille.nom, contenu: contenu})
+    }
+    return declinaisons, extension, nil
+}
+
+func encoder(img *image.NRGBA, extension string) ([]byte, error) {
+    var tampon bytes.Buffer
+    var err error
+    if extension == "png" {
+        err = png.Encode(&tampon, img)
+    } else {
+        err = jpeg.Encode(&tampon, aplatir(img), &jpeg.Options{Quality: qualiteJPEG})
+    }
+    return tampon.Bytes(), err
+}
+
+func versNRGBA(img image.Image) *image.NRGBA {
+    b := img.Bounds()
+    dst := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+    draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+    return dst
+}
+
+// aplatir pose l'image sur un fond blanc, le JPEG ne gérant pas la transparence.
+func aplatir(img *image.NRGBA) *image.RGBA {
+    dst := image.NewRGBA(img.Bounds())
+    draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+    draw.Draw(dst, dst.Bounds(), img, image.Point{}, draw.Over)
+    return dst
+}
+
+// redimensionner réduit l'image pour que son plus grand côté mesure au plus `cote` pixels,
+// en moyennant les pixels source couverts par chaque pixel de destination. Aucun agrandissement.
+func redimensionner(src *image.NRGBA, cote int) *image.NRGBA {
+    largeur, hauteur := src.Bounds().Dx(), src.Bounds().Dy()
+    if largeur <= cote && hauteur <= cote {
+        return src
+    }
+
+    nl, nh := cote, hauteur*cote/largeur
+    if hauteur > largeur {
+        nl, nh = largeur*cote/hauteur, cote
+    }
+    if nl < 1 {
+        nl = 1
+    }
+    if nh < 1 {
+        nh = 1
+    }
+
+    dst := image.NewNRGBA(image.Rect(0, 0, nl, nh))
+    for y := 0; y < nh; y++ {
+        y0, y1 := y*hauteur/nh, (y+1)*hauteur/nh
+        if y1 == y0 {
+            y1 = y0 + 1
+        }
+        for x := 0; x < nl; x++ {
+            x0, x1 := x*largeur/nl, (x+1)*largeur/nl
+            if x1 == x0 {
+                x1 = x0 + 1
+            }
+
+            // Moyenne pondérée par l'alpha pour ne pas assombrir les bords transparents
+            var r, g, b, a, n uint64
+            for sy := y0; sy < y1; sy++ {
+                i := src.PixOffset(x0, sy)
+                for sx := x0; sx < x1; sx++ {
+                    pa := uint64(src.Pix[i+3])
+                    r += uint64(src.Pix[i]) * pa
+                    g += uint64(src.Pix[i+1]) * pa
+                    b += uint64(src.Pix[i+2]) * pa
+                    a += pa
+                    n++
+                    i += 4
+                }
+            }
+
+            j := dst.PixOffset(x, y)
+            if a > 0 {
+                dst.Pix[j] = uint8(r / a)
+                dst.Pix[j+1] = uint8(g / a)
+                dst.Pix[j+2] = uint8(b / a)
+            }
+            dst.Pix[j+3] = uint8(a / n)
+        }
+    }
+    return dst
+}
+
+// orientationEXIF lit l'étiquette Orientation (0x0112) d'un JPEG ; retourne 1 si elle est absente.
+func orientationEXIF(jpg []byte) int {
+    if len(jpg) < 4 || jpg[0] != 0xFF || jpg[1] != 0xD8 {
+        return 1
+    }
+    for i := 2; i+4 <= len(jpg); {
+        if jpg[i] != 0xFF {
+            return 1
+        }
+        marqueur := jpg[i+1]
+        longueur := int(binary.BigEndian.Uint16(jpg[i+2:]))
+        if marqueur == 0xDA {
+            return 1 // Début des données de l'image : pas de segment EXIF
+        }
+        if longueur < 2 || i+2+longueur > len(jpg) {
+            return 1 // Segment corrompu : la longueur inclut ses propres deux octets
+        }
+        segment := jpg[i+4 : i+2+longueur]
+        if marqueur == 0xE1 && len(segment) > 14 && string(segment[:6]) == "Exif\x00\x00" {
+            return orientationTIFF(segment[6:])
+        }
+        i += 2 + longueur
+    }
+    return 1
+}
+
+func orientationTIFF(tiff []byte) int {
+    var ordre binary.ByteOrder
+    switch string(tiff[:2]) {
+    case "II":
+        ordre = binary.LittleEndian
+    case "MM":
+        ordre = binary.BigEndian
+    default:
+        return 1
+    }
+
+    ifd := int(ordre.Uint32(tiff[4:]))
+    if ifd+2 > len(tiff) {
+        return 1
+    }
+    entrees := int(ordre.Uint16(tiff[ifd:]))
+    for e := 0; e < entrees; e++ {
+        p := ifd + 2 + e*12
+        if p+12 > len(tiff) {
+            return 1
+        }
+        if ordre.Uint16(tiff[p:]) == 0x0112 {
+            if o := int(ordre.Uint16(tiff[p+8:])); o >= 1 && o <= 8 {
+                return o
+            }
+            return 1
+        }
+    }
+    return 1
+}
+
+// orienter applique à l'image la transformation décrite par l'orientation EXIF (1 à 8).
+func orienter(src *image.NRGBA, orientation int) *image.NRGBA {
+    if orientation <= 1 || orientation > 8 {
+        return src
+    }
+
+    l, h := src.Bounds().Dx(), src.Bounds().Dy()
+    dl, dh := l, h
+    if orientation >= 5 {
+        dl, dh = h, l // Orientations 5 à 8 : rotation d'un quart de tour
+    }
+
+    dst := image.NewNRGBA(image.Rect(0, 0, dl, dh))
+    for y := 0; y < h; y++ {
+        for x := 0; x < l; x++ {
+            var dx, dy int
+            switch orientation {
+            case 2:
+                dx, dy = l-1-x, y
+            case 3:
+                dx, dy = l-1-x, h-1-y
+            case 4:
+                dx, dy = x, h-1-y
+            case 5:
+                dx, dy = y, x
+            case 6:
+                dx, dy = h-1-y, x
+            case 7:
+                dx, dy = h-1-y, l-1-x
+            case 8:
+                dx, dy = y, l-1-x
+            }
+            copy(dst.Pix[dst.PixOffset(dx, dy):dst.PixOffset(dx, dy)+4], src.Pix[src.PixOffset(x, y):src.PixOffset(x, y)+4])
+        }
+    }
+    return dst
+}
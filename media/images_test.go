@@ -0,0 +1,174 @@
+package media
+
+import (
+    "bytes"
+    "encoding/binary"
+    "image"
+    "image/color"
+    "image/jpeg"
+    "testing"
+)
+
+// jpegEXIF construit le début d'un JPEG dont le segment APP1 ne contient que l'étiquette Orientation.
+func jpegEXIF(ordre binary.ByteOrder, orientation uint16) []byte {
+    tiff := make([]byte, 8+2+12+4)
+    if ordre == binary.LittleEndian {
+        copy(tiff, "II")
+    } else {
+        copy(tiff, "MM")
+    }
+    ordre.PutUint16(tiff[2:], 42)
+    ordre.PutUint32(tiff[4:], 8) // Premier IFD juste après l'en-tête
+    ordre.PutUint16(tiff[8:], 1)
+    ordre.PutUint16(tiff[10:], 0x0112)
+    ordre.PutUint16(tiff[12:], 3) // SHORT
+    ordre.PutUint32(tiff[14:], 1)
+    ordre.PutUint16(tiff[18:], orientation)
+
+    segment := append([]byte("Exif\x00\x00"), tiff...)
+    jpg := []byte{0xFF, 0xD8, 0xFF, 0xE1, 0, 0}
+    binary.BigEndian.PutUint16(jpg[4:], uint16(len(segment)+2))
+    return append(jpg, segment...)
+}
+
+func TestOrientationEXIF(t *testing.T) {
+    cas := []struct {
+        nom     string
+        donnees []byte
+        attendu int
+    }{
+        {"Intel", jpegEXIF(binary.LittleEndian, 6), 6},
+        {"Motorola", jpegEXIF(binary.BigEndian, 8), 8},
+        {"orientation hors limites", jpegEXIF(binary.BigEndian, 9), 1},
+        {"sans EXIF", []byte{0xFF, 0xD8, 0xFF, 0xDA, 0x00, 0x08}, 1},
+        {"pas un JPEG", []byte("\x89PNG\r\n\x1a\n"), 1},
+        {"vide", nil, 1},
+        {"segment tronqué", jpegEXIF(binary.BigEndian, 3)[:20], 1},
+        {"longueur nulle", []byte{0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x00, 0xFF, 0xDA}, 1},
+        {"longueur d'un octet", []byte{0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x01, 0xFF, 0xDA}, 1},
+    }
+    for _, c := range cas {
+        if obtenu := orientationEXIF(c.donnees); obtenu != c.attendu {
+            t.Errorf("%s : orientation %d, attendu %d", c.nom, obtenu, c.attendu)
+        }
+    }
+}
+
+// imageTest retourne une image dont chaque pixel porte ses coordonnées dans les canaux rouge et vert.
+func imageTest(largeur, hauteur int) *image.NRGBA {
+    img := image.NewNRGBA(image.Rect(0, 0, largeur, hauteur))
+    for y := 0; y < hauteur; y++ {
+        for x := 0; x < largeur; x++ {
+            img.SetNRGBA(x, y, color.NRGBA{R: uint8(x), G: uint8(y), A: 255})
+        }
+    }
+    return img
+}
+
+func TestOrienter(t *testing.T) {
+    // Image de 3x2 : où arrivent ses coins supérieurs gauche (0,0) et droit (2,0) ?
+    cas := []struct {
+        orientation           int
+        largeur, hauteur      int
+        hautGauche, hautDroit image.Point
+    }{
+        {1, 3, 2, image.Pt(0, 0), image.Pt(2, 0)},
+        {2, 3, 2, image.Pt(2, 0), image.Pt(0, 0)}, // Miroir horizontal
+        {3, 3, 2, image.Pt(2, 1), image.Pt(0, 1)}, // Demi-tour
+        {4, 3, 2, image.Pt(0, 1), image.Pt(2, 1)}, // Miroir vertical
+        {5, 2, 3, image.Pt(0, 0), image.Pt(0, 2)}, // Transposition
+        {6, 2, 3, image.Pt(1, 0), image.Pt(1, 2)}, // Quart de tour horaire
+        {7, 2, 3, image.Pt(1, 2), image.Pt(1, 0)}, // Transposition inverse
+        {8, 2, 3, image.Pt(0, 2), image.Pt(0, 0)}, // Quart de tour antihoraire
+        {0, 3, 2, image.Pt(0, 0), image.Pt(2, 0)}, // Valeur invalide : image inchangée
+        {9, 3, 2, image.Pt(0, 0), image.Pt(2, 0)},
+    }
+    for _, c := range cas {
+        img := orienter(imageTest(3, 2), c.orientation)
+        if l, h := img.Bounds().Dx(), img.Bounds().Dy(); l != c.largeur || h != c.hauteur {
+            t.Errorf("orientation %d : %dx%d, attendu %dx%d", c.orientation, l, h, c.largeur, c.hauteur)
+            continue
+        }
+        if p := img.NRGBAAt(c.hautGauche.X, c.hautGauche.Y); p.R != 0 || p.G != 0 {
+            t.Errorf("orientation %d : le coin (0,0) n'est pas en %v", c.orientation, c.hautGauche)
+        }
+        if p := img.NRGBAAt(c.hautDroit.X, c.hautDroit.Y); p.R != 2 || p.G != 0 {
+            t.Errorf("orientation %d : le coin (2,0) n'est pas en %v", c.orientation, c.hautDroit)
+        }
+    }
+}
+
+func TestRedimensionner(t *testing.T) {
+    cas := []struct {
+        nom                string
+        largeur, hauteur   int
+        cote               int
+        attenduL, attenduH int
+    }{
+        {"paysage", 1000, 500, 800, 800, 400},
+        {"portrait", 500, 1000, 800, 400, 800},
+        {"carré", 1200, 1200, 200, 200, 200},
+        {"déjà assez petite", 300, 200, 800, 300, 200},
+        {"exactement à la limite", 800, 800, 800, 800, 800},
+        {"un pixel de trop", 801, 800, 800, 800, 799},
+        {"bandeau horizontal", 2000, 1, 200, 200, 1},
+        {"bandeau vertical", 1, 3000, 200, 1, 200},
+    }
+    for _, c := range cas {
+        src := image.NewNRGBA(image.Rect(0, 0, c.largeur, c.hauteur))
+        img := redimensionner(src, c.cote)
+        if l, h := img.Bounds().Dx(), img.Bounds().Dy(); l != c.attenduL || h != c.attenduH {
+            t.Errorf("%s : %dx%d, attendu %dx%d", c.nom, l, h, c.attenduL, c.attenduH)
+        }
+    }
+}
+
+func TestRedimensionnerConserveLesCouleurs(t *testing.T) {
+    src := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+    for y := 0; y < 20; y++ {
+        for x := 0; x < 40; x++ {
+            if x%2 == 0 {
+                src.SetNRGBA(x, y, color.NRGBA{R: 200, G: 100, B: 50, A: 255})
+            } // Une colonne sur deux est transparente
+        }
+    }
+
+    img := redimensionner(src, 10)
+    for y := 0; y < img.Bounds().Dy(); y++ {
+        for x := 0; x < img.Bounds().Dx(); x++ {
+            if p := img.NRGBAAt(x, y); p.R != 200 || p.G != 100 || p.B != 50 || p.A != 127 {
+                t.Fatalf("pixel (%d,%d) = %v, attendu la couleur source à demi transparente", x, y, p)
+            }
+        }
+    }
+}
+
+// Une photo JPEG prise de côté (orientation 6) ressort dans le bon sens et sans EXIF.
+func TestTraiterImageAppliqueOrientation(t *testing.T) {
+    var tampon bytes.Buffer
+    if err := jpeg.Encode(&tampon, imageTest(40, 20), nil); err != nil {
+        t.Fatal(err)
+    }
+    encodee := tampon.Bytes()
+    exif := jpegEXIF(binary.BigEndian, 6)
+    photo := append(append([]byte{}, exif...), encodee[2:]...) // APP1 inséré juste après SOI
+
+    declinaisons, extension, err := traiterImage(photo)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if extension != "jpg" {
+        t.Errorf("extension %q, attendu jpg", extension)
+    }
+    original := declinaisons[0].contenu
+    if orientationEXIF(original) != 1 {
+        t.Error("l'original réencodé porte encore une orientation EXIF")
+    }
+    config, err := jpeg.DecodeConfig(bytes.NewReader(original))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if config.Width != 20 || config.Height != 40 {
+        t.Errorf("original en %dx%d, attendu 20x40", config.Width, config.Height)
+    }
+}
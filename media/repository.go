@@ -0,0 +1,101 @@
+package media
+
+import (
+    "bytes"
+    "ecommerce-api/models"
+    "fmt"
+    "path"
+    "strings"
+
+    "github.com/google/uuid"
+    "github.com/jmoiron/sqlx"
+    "github.com/lib/pq"
+)
+
+// prefixeProduits regroupe les images de produits dans le stockage : produits/<id>/<déclinaison>.<ext>
+const prefixeProduits = "produits"
+
+type Repository struct {
+    db      *sqlx.DB
+    storage Storage
+}
+
+func NewRepository(db *sqlx.DB, storage Storage) *Repository {
+    return &Repository{db: db, storage: storage}
+}
+
+// Televerser traite l'image puis enregistre ses déclinaisons dans le stockage.
+func (r *Repository) Televerser(donnees []byte) (*models.Media, error) {
+    declinaisons, extension, err := traiterImage(donnees)
+    if err != nil {
+        return nil, err
+    }
+
+    media := &models.Media{ID: uuid.New().String()}
+    var enregistrees []string
+    for _, d := range declinaisons {
+        cle := path.Join(prefixeProduits, media.ID, d.nom+"."+extension)
+        if err := r.storage.Enregistrer(cle, bytes.NewReader(d.contenu)); err != nil {
+            // Ne pas laisser de déclinaisons partielles
+            for _, c := range enregistrees {
+                r.storage.Supprimer(c)
+            }
+            return nil, err
+        }
+        enregistrees = append(enregistrees, cle)
+
+        switch d.nom {
+        case "original":
+            media.Original = r.storage.URL(cle)
+        case "medium":
+            media.Medium = r.storage.URL(cle)
+        case "miniature":
+            media.Miniature = r.storage.URL(cle)
+        }
+    }
+    return media, nil
+}
+
+// SupprimerOrphelins supprime les images gérées par le stockage qui ne sont plus
+// référencées par aucun produit, avec toutes leurs déclinaisons. Les URLs externes sont ignorées.
+func (r *Repository) SupprimerOrphelins(urls []string) error {
+    traites := make(map[string]bool)
+    for _, url := range urls {
+        cle, ok := r.storage.Cle(url)
+        if !ok {
+            continue
+        }
+        morceaux := strings.Split(cle, "/")
+        if len(morceaux) != 3 || morceaux[0] != prefixeProduits || traites[morceaux[1]] {
+            continue
+        }
+        id := morceaux[1]
+        traites[id] = true
+
+        extension := path.Ext(morceaux[2])
+        var cles, urlsMedia []string
+        for _, nom := range []string{"original", "medium", "miniature"} {
+            c := path.Join(prefixeProduits, id, nom+extension)
+            cles = append(cles, c)
+            urlsMedia = append(urlsMedia, r.storage.URL(c))
+        }
+
+        // Une même image peut être attachée à plusieurs produits
+        var utilisee bool
+        err := r.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM produits WHERE photos && $1)`,
+            pq.Array(urlsMedia)).Scan(&utilisee)
+        if err != nil {
+            return fmt.Errorf("erreur lors de la vérification des images utilisées : %v", err)
+        }
+        if utilisee {
+            continue
+        }
+
+        for _, c := range cles {
+            if err := r.storage.Supprimer(c); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
@@ -0,0 +1,95 @@
+package media
+
+import (
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+// Storage abstrait l'emplacement où sont conservés les fichiers téléversés.
+// Une clé est un chemin relatif (ex. « produits/<id>/medium.jpg »).
+type Storage interface {
+    Enregistrer(cle string, contenu io.Reader) error
+    Supprimer(cle string) error
+    // URL retourne l'adresse publique du fichier.
+    URL(cle string) string
+    // Cle retrouve la clé d'une URL ; ok vaut false si l'URL n'est pas gérée par ce stockage.
+    Cle(url string) (cle string, ok bool)
+}
+
+// LocalStorage conserve les fichiers sur le disque, sous un répertoire servi en statique.
+type LocalStorage struct {
+    racine  string
+    urlBase string
+}
+
+// NewLocalStorage crée un stockage dans le répertoire racine, dont les fichiers sont servis sous urlBase.
+func NewLocalStorage(racine, urlBase string) *LocalStorage {
+    return &LocalStorage{racine: racine, urlBase: strings.TrimSuffix(urlBase, "/")}
+}
+
+func (s *LocalStorage) chemin(cle string) (string, error) {
+    cle = filepath.Clean("/" + cle)
+    if cle == "/" {
+        return "", fmt.Errorf("clé de fichier invalide")
+    }
+    return filepath.Join(s.racine, filepath.FromSlash(cle)), nil
+}
+
+func (s *LocalStorage) Enregistrer(cle string, contenu io.Reader) error {
+    chemin, err := s.chemin(cle)
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(filepath.Dir(chemin), 0o755); err != nil {
+        return fmt.Errorf("erreur lors de la création du répertoire : %v", err)
+    }
+
+    // Écriture dans un fichier temporaire puis renommage, pour ne jamais servir un fichier incomplet
+    tmp, err := os.CreateTemp(filepath.Dir(chemin), ".upload-*")
+    if err != nil {
+        return fmt.Errorf("erreur lors de l'enregistrement du fichier : %v", err)
+    }
+    defer os.Remove(tmp.Name())
+
+    if _, err := io.Copy(tmp, contenu); err != nil {
+        tmp.Close()
+        return fmt.Errorf("erreur lors de l'enregistrement du fichier : %v", err)
+    }
+    if err := tmp.Close(); err != nil {
+        return fmt.Errorf("erreur lors de l'enregistrement du fichier : %v", err)
+    }
+    if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+        return fmt.Errorf("erreur lors de l'enregistrement du fichier : %v", err)
+    }
+    if err := os.Rename(tmp.Name(), chemin); err != nil {
+        return fmt.Errorf("erreur lors de l'enregistrement du fichier : %v", err)
+    }
+    return nil
+}
+
+func (s *LocalStorage) Supprimer(cle string) error {
+    chemin, err := s.chemin(cle)
+    if err != nil {
+        return err
+    }
+    if err := os.Remove(chemin); err != nil && !os.IsNotExist(err) {
+        return fmt.Errorf("erreur lors de la suppression du fichier : %v", err)
+    }
+    // Retirer le répertoire de l'image s'il est désormais vide ; l'erreur est ignorée sinon
+    os.Remove(filepath.Dir(chemin))
+    return nil
+}
+
+func (s *LocalStorage) URL(cle string) string {
+    return s.urlBase + "/" + strings.TrimPrefix(cle, "/")
+}
+
+func (s *LocalStorage) Cle(url string) (string, bool) {
+    if !strings.HasPrefix(url, s.urlBase+"/") {
+        return "", false
+    }
+    return strings.TrimPrefix(url, s.urlBase+"/"), true
+}
@@ -166,3 +166,510 @@ ALTER TABLE events
     ALTER COLUMN end_date TYPE character varying(255);
 ALTER TABLE events
     ALTER COLUMN start_time TYPE character varying(255);
+
+-- Les dates des tickets suivent le même format texte que celles des événements
+ALTER TABLE tickets
+    ALTER COLUMN start_date TYPE character varying(255),
+    ALTER COLUMN start_time TYPE character varying(255);
+
+CREATE INDEX idx_tickets_user ON tickets(user_id);
+CREATE INDEX idx_tickets_event ON tickets(event_id);
+
+-- Historique des changements de statut des commandes
+CREATE TABLE commande_status_history (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    commande_id UUID NOT NULL,
+    ancien_status VARCHAR(50),
+    nouveau_status VARCHAR(50) NOT NULL,
+    modifie_par VARCHAR(255) NOT NULL, -- googleid du client ou email de l'admin
+    commentaire TEXT,
+    created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_commande_history FOREIGN KEY (commande_id) REFERENCES commandes(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_commande_status_history_commande ON commande_status_history(commande_id, created_at);
+
+ALTER TABLE commandes
+    ADD CONSTRAINT commandes_status_check
+    CHECK (status IN ('en_attente', 'payée', 'expédiée', 'livrée', 'annulée', 'remboursée'));
+
+-- Quantité par produit dans le panier
+ALTER TABLE panier
+    ADD COLUMN quantite INTEGER NOT NULL DEFAULT 1 CHECK (quantite > 0);
+
+-- Liste de souhaits des utilisateurs
+CREATE TABLE liste_souhaits (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    google_id CHARACTER VARYING(255) NOT NULL,
+    produit_id UUID NOT NULL,
+    notifier BOOLEAN NOT NULL DEFAULT false,      -- Alerte baisse de prix / retour en stock
+    prix_reference DECIMAL(10,2) NOT NULL,        -- Prix au moment de l'ajout ou de la dernière alerte
+    stock_reference INTEGER NOT NULL DEFAULT 0,   -- Stock au moment de l'ajout ou de la dernière alerte
+    created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT liste_souhaits_user_produit_key UNIQUE (google_id, produit_id),
+    CONSTRAINT liste_souhaits_produit_id_fkey FOREIGN KEY (produit_id) REFERENCES produits(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_liste_souhaits_notifier ON liste_souhaits(produit_id) WHERE notifier;
+
+-- Recherche plein texte en français, insensible aux accents
+CREATE EXTENSION IF NOT EXISTS unaccent;
+
+CREATE TEXT SEARCH CONFIGURATION french_unaccent (COPY = french);
+ALTER TEXT SEARCH CONFIGURATION french_unaccent
+    ALTER MAPPING FOR hword, hword_part, word
+    WITH unaccent, french_stem;
+
+ALTER TABLE produits ADD COLUMN search_vector tsvector;
+
+CREATE OR REPLACE FUNCTION produits_search_vector(nom TEXT, marque TEXT, modele TEXT, description TEXT)
+RETURNS tsvector AS $$
+    SELECT setweight(to_tsvector('french_unaccent', COALESCE(nom, '')), 'A') ||
+           setweight(to_tsvector('french_unaccent', COALESCE(marque, '')), 'A') ||
+           setweight(to_tsvector('french_unaccent', COALESCE(modele, '')), 'B') ||
+           setweight(to_tsvector('french_unaccent', COALESCE(description, '')), 'C');
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE OR REPLACE FUNCTION produits_search_vector_update()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.search_vector := produits_search_vector(NEW.nom, NEW.marque, NEW.modele, NEW.description);
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER update_produits_search_vector
+    BEFORE INSERT OR UPDATE OF nom, marque, modele, description ON produits
+    FOR EACH ROW
+    EXECUTE FUNCTION produits_search_vector_update();
+
+-- Remplir la colonne pour les produits existants sans toucher à updated_at
+ALTER TABLE produits DISABLE TRIGGER update_produits_updated_at;
+UPDATE produits SET search_vector = produits_search_vector(nom, marque, modele, description);
+ALTER TABLE produits ENABLE TRIGGER update_produits_updated_at;
+
+CREATE INDEX idx_produits_search_vector ON produits USING GIN(search_vector);
+
+-- Recherche tolérante aux fautes de frappe et suggestions (trigrammes)
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- unaccent n'est pas IMMUTABLE : cette enveloppe permet de l'utiliser dans des index
+CREATE OR REPLACE FUNCTION f_unaccent(TEXT)
+RETURNS TEXT AS $$
+    SELECT public.unaccent('public.unaccent', $1)
+$$ LANGUAGE sql IMMUTABLE PARALLEL SAFE STRICT;
+
+CREATE INDEX idx_produits_nom_trgm ON produits USING GIN (lower(f_unaccent(nom)) gin_trgm_ops);
+CREATE INDEX idx_produits_marque_trgm ON produits USING GIN (lower(f_unaccent(marque)) gin_trgm_ops);
+CREATE INDEX idx_categories_nom_trgm ON categories USING GIN (lower(f_unaccent(nom)) gin_trgm_ops);
+
+-- Index correspondant aux tris de la pagination par curseur (voir products/pagination.go)
+CREATE INDEX idx_produits_tri_prix ON produits(prix, id);
+CREATE INDEX idx_produits_tri_recent ON produits((COALESCE(created_at, 'epoch'::timestamp)) DESC, id DESC);
+CREATE INDEX idx_produits_tri_vues ON produits((COALESCE(nombre_vues, 0)) DESC, id DESC);
+
+-- Compteur de vues : l'incrément de nombre_vues ne doit pas modifier updated_at
+DROP TRIGGER update_produits_updated_at ON produits;
+CREATE TRIGGER update_produits_updated_at
+    BEFORE UPDATE ON produits
+    FOR EACH ROW
+    WHEN (OLD.nombre_vues IS NOT DISTINCT FROM NEW.nombre_vues)
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Vues agrégées par jour, pour les tendances
+CREATE TABLE produit_vues_jour (
+    produit_id UUID NOT NULL REFERENCES produits(id) ON DELETE CASCADE,
+    jour DATE NOT NULL,
+    vues INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (produit_id, jour)
+);
+
+CREATE INDEX idx_produit_vues_jour_jour ON produit_vues_jour(jour);
+
+-- Variantes de produit (taille, couleur, capacité...) avec prix et stock propres
+CREATE TABLE produit_variantes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    produit_id UUID NOT NULL REFERENCES produits(id) ON DELETE CASCADE,
+    sku VARCHAR(100) NOT NULL UNIQUE,
+    attributs JSONB NOT NULL DEFAULT '{}',        -- ex. {"couleur": "noir", "stockage": "128 Go"}
+    prix DECIMAL(10,2) CHECK (prix >= 0),         -- NULL : prix du produit
+    stock INTEGER NOT NULL DEFAULT 0 CHECK (stock >= 0),
+    disponible BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_produit_variantes_produit ON produit_variantes (produit_id);
+
+-- Le stock d'un produit à variantes est la somme du stock de ses variantes
+CREATE OR REPLACE FUNCTION synchroniser_stock_variantes() RETURNS trigger AS $$
+DECLARE
+    produit UUID;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        produit := OLD.produit_id;
+    ELSE
+        produit := NEW.produit_id;
+    END IF;
+
+    UPDATE produits
+    SET stock = (SELECT COALESCE(SUM(stock), 0) FROM produit_variantes WHERE produit_id = produit)
+    WHERE id = produit;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER produit_variantes_stock
+    AFTER INSERT OR DELETE OR UPDATE OF stock ON produit_variantes
+    FOR EACH ROW EXECUTE FUNCTION synchroniser_stock_variantes();
+
+-- Le panier référence une variante ; une ligne par (utilisateur, produit, variante)
+ALTER TABLE panier
+    ADD COLUMN variante_id UUID REFERENCES produit_variantes(id) ON DELETE CASCADE;
+ALTER TABLE panier DROP CONSTRAINT panier_user_produit_key;
+CREATE UNIQUE INDEX panier_user_produit_key ON panier (user_id, produit_id) WHERE variante_id IS NULL;
+CREATE UNIQUE INDEX panier_user_variante_key ON panier (user_id, variante_id) WHERE variante_id IS NOT NULL;
+
+-- Les lignes de commande capturent la variante et son SKU au moment de l'achat
+ALTER TABLE commande_produits DROP CONSTRAINT commande_produits_pkey;
+ALTER TABLE commande_produits
+    ADD COLUMN id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    ADD COLUMN variante_id UUID REFERENCES produit_variantes(id) ON DELETE SET NULL,
+    ADD COLUMN sku VARCHAR(100);
+CREATE INDEX idx_commande_produits_commande ON commande_produits (commande_id);
+
+-- Journal d'inventaire : chaque variation de stock avec sa raison
+CREATE TABLE inventory_movements (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    produit_id UUID NOT NULL REFERENCES produits(id) ON DELETE CASCADE,
+    variante_id UUID REFERENCES produit_variantes(id) ON DELETE CASCADE,  -- NULL : stock du produit lui-même
+    quantite INTEGER NOT NULL CHECK (quantite <> 0),                      -- Négative pour une sortie
+    stock_apres INTEGER NOT NULL CHECK (stock_apres >= 0),
+    raison VARCHAR(20) NOT NULL CHECK (raison IN ('vente', 'annulation', 'ajustement', 'retour', 'import')),
+    reference VARCHAR(255),                                               -- ex. ID de la commande
+    commentaire TEXT,
+    cree_par VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_inventory_movements_produit ON inventory_movements (produit_id, created_at DESC);
+CREATE INDEX idx_inventory_movements_variante ON inventory_movements (variante_id) WHERE variante_id IS NOT NULL;
+
+-- Solde d'ouverture : le stock actuel devient le premier mouvement du journal
+INSERT INTO inventory_movements (produit_id, quantite, stock_apres, raison, commentaire, cree_par)
+SELECT p.id, p.stock, p.stock, 'ajustement', 'Solde d''ouverture', 'migration'
+FROM produits p
+WHERE p.stock > 0
+  AND NOT EXISTS (SELECT 1 FROM produit_variantes v WHERE v.produit_id = p.id);
+
+INSERT INTO inventory_movements (produit_id, variante_id, quantite, stock_apres, raison, commentaire, cree_par)
+SELECT v.produit_id, v.id, v.stock, v.stock, 'ajustement', 'Solde d''ouverture', 'migration'
+FROM produit_variantes v
+WHERE v.stock > 0;
+
+-- Emplacements de stock (entrepôts, boutiques)
+CREATE TABLE emplacements (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    nom VARCHAR(255) NOT NULL,
+    type VARCHAR(20) NOT NULL DEFAULT 'entrepot' CHECK (type IN ('entrepot', 'boutique')),
+    adresse TEXT,
+    localisation VARCHAR(255) NOT NULL,   -- Même libellé que produits.localisation, ex. "Paris 11ème"
+    latitude DOUBLE PRECISION,
+    longitude DOUBLE PRECISION,
+    actif BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Part du stock d'un produit (ou d'une variante) présente dans chaque emplacement.
+-- Le stock du produit reste le total ; la part non affectée à un emplacement est stock - SUM(quantite).
+CREATE TABLE stock_emplacements (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    emplacement_id UUID NOT NULL REFERENCES emplacements(id) ON DELETE CASCADE,
+    produit_id UUID NOT NULL REFERENCES produits(id) ON DELETE CASCADE,
+    variante_id UUID REFERENCES produit_variantes(id) ON DELETE CASCADE,
+    quantite INTEGER NOT NULL DEFAULT 0 CHECK (quantite >= 0),
+    updated_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX stock_emplacements_produit_key ON stock_emplacements (emplacement_id, produit_id) WHERE variante_id IS NULL;
+CREATE UNIQUE INDEX stock_emplacements_variante_key ON stock_emplacements (emplacement_id, variante_id) WHERE variante_id IS NOT NULL;
+CREATE INDEX idx_stock_emplacements_produit ON stock_emplacements (produit_id) WHERE quantite > 0;
+
+-- Les mouvements et les lignes de commande indiquent l'emplacement concerné
+ALTER TABLE inventory_movements
+    ADD COLUMN emplacement_id UUID REFERENCES emplacements(id) ON DELETE SET NULL;
+ALTER TABLE inventory_movements DROP CONSTRAINT inventory_movements_raison_check;
+ALTER TABLE inventory_movements
+    ADD CONSTRAINT inventory_movements_raison_check
+    CHECK (raison IN ('vente', 'annulation', 'ajustement', 'retour', 'import', 'transfert'));
+
+ALTER TABLE commande_produits
+    ADD COLUMN emplacement_id UUID REFERENCES emplacements(id) ON DELETE SET NULL;
+
+-- Réservations de stock pendant le checkout, valables jusqu'à expire_le
+CREATE TABLE reservations_stock (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id CHARACTER VARYING(255) NOT NULL,
+    produit_id UUID NOT NULL REFERENCES produits(id) ON DELETE CASCADE,
+    variante_id UUID REFERENCES produit_variantes(id) ON DELETE CASCADE,
+    quantite INTEGER NOT NULL CHECK (quantite > 0),
+    statut VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (statut IN ('active', 'convertie', 'expiree', 'liberee')),
+    expire_le TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+    commande_id UUID REFERENCES commandes(id) ON DELETE SET NULL,   -- Renseignée à la conversion
+    created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_reservations_stock_actives ON reservations_stock (produit_id, variante_id) WHERE statut = 'active';
+CREATE INDEX idx_reservations_stock_user ON reservations_stock (user_id) WHERE statut = 'active';
+
+-- Seuil d'alerte de stock bas et disponibilité automatique selon le stock
+ALTER TABLE produits
+    ADD COLUMN seuil_stock_bas INTEGER NOT NULL DEFAULT 5 CHECK (seuil_stock_bas >= 0),
+    ADD COLUMN indisponible_auto BOOLEAN NOT NULL DEFAULT false;  -- true si disponible a été désactivé faute de stock
+
+-- Un produit passe indisponible quand son stock tombe à zéro et redevient disponible au réapprovisionnement,
+-- sauf s'il a été désactivé manuellement.
+CREATE OR REPLACE FUNCTION basculer_disponibilite_stock() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND NEW.disponible IS DISTINCT FROM OLD.disponible THEN
+        -- Changement manuel : il prime sur la bascule automatique
+        NEW.indisponible_auto := false;
+    END IF;
+
+    IF NEW.stock <= 0 AND NEW.disponible THEN
+        NEW.disponible := false;
+        NEW.indisponible_auto := true;
+    ELSIF NEW.stock > 0 AND NEW.indisponible_auto THEN
+        NEW.disponible := true;
+        NEW.indisponible_auto := false;
+    END IF;
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER produits_disponibilite_stock
+    BEFORE INSERT OR UPDATE OF stock, disponible ON produits
+    FOR EACH ROW EXECUTE FUNCTION basculer_disponibilite_stock();
+
+UPDATE produits SET stock = stock WHERE stock <= 0 AND disponible;
+
+CREATE INDEX idx_produits_stock_bas ON produits (stock) WHERE stock <= seuil_stock_bas;
+
+-- Référence (SKU) des produits, utilisée comme clé par l'import CSV
+ALTER TABLE produits ADD COLUMN sku VARCHAR(100) UNIQUE;
+
+-- Numéros de version pour les modifications concurrentes (ETag / If-Match)
+ALTER TABLE produits ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE categories ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE events ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+-- Hiérarchie des catégories (ex. Électronique > Téléphones > Smartphones)
+ALTER TABLE categories
+    ADD COLUMN parent_id UUID REFERENCES categories(id) ON DELETE RESTRICT,
+    ADD CONSTRAINT categories_parent_different CHECK (parent_id <> id);
+
+CREATE INDEX idx_categories_parent ON categories (parent_id);
+
+-- Refuse un parent qui est la catégorie elle-même ou l'une de ses descendantes
+CREATE OR REPLACE FUNCTION verifier_cycle_categorie() RETURNS trigger AS $$
+BEGIN
+    IF NEW.parent_id IS NOT NULL AND EXISTS (
+        WITH RECURSIVE ancetres AS (
+            SELECT id, parent_id FROM categories WHERE id = NEW.parent_id
+            UNION
+            SELECT c.id, c.parent_id FROM categories c JOIN ancetres a ON c.id = a.parent_id
+        )
+        SELECT 1 FROM ancetres WHERE id = NEW.id
+    ) THEN
+        RAISE EXCEPTION 'la catégorie % ne peut pas avoir pour parent une de ses sous-catégories', NEW.id;
+    END IF;
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER categories_cycle
+    BEFORE INSERT OR UPDATE OF parent_id ON categories
+    FOR EACH ROW EXECUTE FUNCTION verifier_cycle_categorie();
+
+-- Compteurs de produits par catégorie, tenus à jour par trigger
+ALTER TABLE categories
+    ALTER COLUMN nombre_produits SET NOT NULL,
+    ADD COLUMN nombre_produits_disponibles INT NOT NULL DEFAULT 0;  -- Produits disponibles uniquement, pour le menu
+
+CREATE OR REPLACE FUNCTION compter_produits_categorie() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') AND OLD.categorie_id IS NOT NULL THEN
+        UPDATE categories
+        SET nombre_produits = nombre_produits - 1,
+            nombre_produits_disponibles = nombre_produits_disponibles - CASE WHEN OLD.disponible THEN 1 ELSE 0 END
+        WHERE id = OLD.categorie_id;
+    END IF;
+    IF TG_OP IN ('UPDATE', 'INSERT') AND NEW.categorie_id IS NOT NULL THEN
+        UPDATE categories
+        SET nombre_produits = nombre_produits + 1,
+            nombre_produits_disponibles = nombre_produits_disponibles + CASE WHEN NEW.disponible THEN 1 ELSE 0 END
+        WHERE id = NEW.categorie_id;
+    END IF;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER produits_compteur_categorie
+    AFTER INSERT OR DELETE ON produits
+    FOR EACH ROW EXECUTE FUNCTION compter_produits_categorie();
+
+-- Pas de liste de colonnes (UPDATE OF) : disponible est aussi basculé par le trigger
+-- basculer_disponibilite_stock lors d'un UPDATE qui ne touche que le stock.
+CREATE TRIGGER produits_compteur_categorie_modification
+    AFTER UPDATE ON produits
+    FOR EACH ROW
+    WHEN (OLD.categorie_id IS DISTINCT FROM NEW.categorie_id OR OLD.disponible IS DISTINCT FROM NEW.disponible)
+    EXECUTE FUNCTION compter_produits_categorie();
+
+-- Initialisation des compteurs à partir des produits existants
+UPDATE categories c SET
+    nombre_produits = (SELECT COUNT(*) FROM produits p WHERE p.categorie_id = c.id),
+    nombre_produits_disponibles = (SELECT COUNT(*) FROM produits p WHERE p.categorie_id = c.id AND p.disponible);
+
+-- Activation programmée des catégories saisonnières
+ALTER TABLE categories
+    ADD COLUMN active_du TIMESTAMP,       -- NULL : active dès maintenant
+    ADD COLUMN active_jusqu_au TIMESTAMP; -- NULL : sans date de fin
+
+-- Catégories visibles du public : statut actif, dans leur période d'activation,
+-- et dont toutes les catégories parentes sont elles-mêmes visibles
+CREATE VIEW categories_visibles AS
+    WITH RECURSIVE visibles AS (
+        SELECT c.* FROM categories c
+        WHERE c.parent_id IS NULL
+          AND c.statut = 'actif'
+          AND (c.active_du IS NULL OR c.active_du <= NOW())
+          AND (c.active_jusqu_au IS NULL OR c.active_jusqu_au > NOW())
+        UNION ALL
+        SELECT c.* FROM categories c
+        JOIN visibles v ON c.parent_id = v.id
+        WHERE c.statut = 'actif'
+          AND (c.active_du IS NULL OR c.active_du <= NOW())
+          AND (c.active_jusqu_au IS NULL OR c.active_jusqu_au > NOW())
+    )
+    SELECT * FROM visibles;
+
+-- Attributs typés définis par catégorie (RAM, taille d'écran, kilométrage...) ;
+-- ils s'appliquent aussi aux produits des sous-catégories
+CREATE TABLE categorie_attributs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    categorie_id UUID NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+    code VARCHAR(100) NOT NULL CHECK (code ~ '^[a-z0-9_]+$'),  -- Clé dans produits.attributs
+    libelle VARCHAR(255) NOT NULL,
+    type VARCHAR(20) NOT NULL CHECK (type IN ('enum', 'nombre', 'booleen')),
+    unite VARCHAR(20),                          -- Pour les nombres (Go, pouces, km...)
+    valeurs TEXT[] NOT NULL DEFAULT '{}',       -- Valeurs autorisées d'un enum
+    obligatoire BOOLEAN NOT NULL DEFAULT false,
+    ordre INTEGER NOT NULL DEFAULT 0,           -- Ordre d'affichage dans la fiche technique
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (categorie_id, code),
+    CHECK (type <> 'enum' OR cardinality(valeurs) > 0)
+);
+
+-- Valeurs des attributs du produit, validées par l'API selon le schéma de sa catégorie
+ALTER TABLE produits ADD COLUMN attributs JSONB NOT NULL DEFAULT '{}';
+
+CREATE INDEX idx_produits_attributs ON produits USING GIN (attributs);
+
+-- Le journal d'inventaire survit à la suppression d'un produit ou d'une variante :
+-- les clés passent à NULL et le nom et le SKU de l'article sont conservés dans chaque mouvement.
+-- sur_variante garde la trace du niveau du mouvement une fois variante_id effacé.
+ALTER TABLE inventory_movements
+    ADD COLUMN produit_nom VARCHAR(255),
+    ADD COLUMN sku VARCHAR(100),
+    ADD COLUMN sur_variante BOOLEAN NOT NULL DEFAULT false;
+
+UPDATE inventory_movements m SET
+    sur_variante = m.variante_id IS NOT NULL,
+    produit_nom = (SELECT nom FROM produits WHERE id = m.produit_id),
+    sku = COALESCE((SELECT sku FROM produit_variantes WHERE id = m.variante_id),
+                   (SELECT sku FROM produits WHERE id = m.produit_id));
+
+ALTER TABLE inventory_movements
+    ALTER COLUMN produit_id DROP NOT NULL,
+    DROP CONSTRAINT inventory_movements_produit_id_fkey,
+    DROP CONSTRAINT inventory_movements_variante_id_fkey,
+    ADD CONSTRAINT inventory_movements_produit_id_fkey
+        FOREIGN KEY (produit_id) REFERENCES produits(id) ON DELETE SET NULL,
+    ADD CONSTRAINT inventory_movements_variante_id_fkey
+        FOREIGN KEY (variante_id) REFERENCES produit_variantes(id) ON DELETE SET NULL;
+
+-- Le stock d'un produit à variantes est dérivé de celui de ses variantes : seuls les mouvements
+-- des variantes sont journalisés, et ListerEcarts ne contrôle pas ce stock dérivé.
+-- Quand la dernière variante disparaît, le produit redevient un article simple : un ajustement
+-- aligne alors son journal propre sur le stock recalculé.
+CREATE OR REPLACE FUNCTION synchroniser_stock_variantes() RETURNS trigger AS $$
+DECLARE
+    produit UUID;
+    nouveau_stock INTEGER;
+    journal INTEGER;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        produit := OLD.produit_id;
+    ELSE
+        produit := NEW.produit_id;
+    END IF;
+
+    UPDATE produits
+    SET stock = (SELECT COALESCE(SUM(stock), 0) FROM produit_variantes WHERE produit_id = produit)
+    WHERE id = produit
+    RETURNING stock INTO nouveau_stock;
+
+    IF TG_OP = 'DELETE' AND nouveau_stock IS NOT NULL
+       AND NOT EXISTS (SELECT 1 FROM produit_variantes WHERE produit_id = produit) THEN
+        SELECT COALESCE(SUM(quantite), 0) INTO journal
+        FROM inventory_movements WHERE produit_id = produit AND NOT sur_variante;
+
+        IF journal <> nouveau_stock THEN
+            INSERT INTO inventory_movements (produit_id, quantite, stock_apres, raison, commentaire, cree_par, produit_nom, sku)
+            SELECT p.id, nouveau_stock - journal, nouveau_stock, 'ajustement',
+                   'Dernière variante supprimée', 'système', p.nom, p.sku
+            FROM produits p WHERE p.id = produit;
+        END IF;
+    END IF;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+-- La version d'un produit (ETag) change avec toute donnée enregistrée de sa fiche, quel que soit
+-- le chemin d'écriture : produit, variantes et stock par emplacement. Le compteur de vues et les
+-- colonnes techniques n'en font pas partie ; une écriture qui incrémente déjà version n'est pas comptée deux fois.
+CREATE OR REPLACE FUNCTION incrementer_version_produit() RETURNS trigger AS $$
+BEGIN
+    IF NEW.version = OLD.version
+       AND to_jsonb(NEW) - ARRAY['nombre_vues', 'updated_at', 'search_vector', 'version']
+           IS DISTINCT FROM to_jsonb(OLD) - ARRAY['nombre_vues', 'updated_at', 'search_vector', 'version'] THEN
+        NEW.version := OLD.version + 1;
+    END IF;
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER produits_version
+    BEFORE UPDATE ON produits
+    FOR EACH ROW EXECUTE FUNCTION incrementer_version_produit();
+
+CREATE OR REPLACE FUNCTION incrementer_version_produit_parent() RETURNS trigger AS $$
+BEGIN
+    UPDATE produits SET version = version + 1
+    WHERE id = CASE WHEN TG_OP = 'DELETE' THEN OLD.produit_id ELSE NEW.produit_id END;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER produit_variantes_version
+    AFTER INSERT OR UPDATE OR DELETE ON produit_variantes
+    FOR EACH ROW EXECUTE FUNCTION incrementer_version_produit_parent();
+
+CREATE TRIGGER stock_emplacements_version
+    AFTER INSERT OR UPDATE OR DELETE ON stock_emplacements
+    FOR EACH ROW EXECUTE FUNCTION incrementer_version_produit_parent();
@@ -6,9 +6,46 @@ import "time"
 type Category struct {
     ID             string    `db:"id" json:"id"`
     Nom            string    `db:"nom" json:"nom"`
-    NombreProduits int       `db:"nombre_produits" json:"nombre_produits"`
+    ParentID       *string   `db:"parent_id" json:"parent_id"` // nil pour une catégorie racine
+    NombreProduits int       `db:"nombre_produits" json:"nombre_produits"` // Tenu à jour par trigger
+    NombreProduitsDisponibles int `db:"nombre_produits_disponibles" json:"nombre_produits_disponibles"` // Sans les produits indisponibles
     Statut         string    `db:"statut" json:"statut"`
+    ActiveDu       *time.Time `db:"active_du" json:"active_du"`             // Début d'activation programmée
+    ActiveJusquAu  *time.Time `db:"active_jusqu_au" json:"active_jusqu_au"` // Fin d'activation programmée
+    Visible        bool      `db:"visible" json:"visible"`                  // Visible du public (statut, dates et parents)
     CreatedAt      time.Time `db:"created_at" json:"created_at"`
     UpdatedAt      time.Time `db:"updated_at" json:"updated_at"`
+    Version        int       `db:"version" json:"version"` // Incrémentée à chaque modification, exposée en ETag
+    Enfants        []Category `db:"-" json:"enfants,omitempty"` // Sous-catégories, renseignées par l'arbre
+}
+
+// Statuts d'une catégorie
+const (
+    CategorieActive   = "actif"
+    CategorieInactive = "inactif"
+)
+
+// ResultatDeplacement résume le déplacement des produits d'une catégorie vers une autre
+type ResultatDeplacement struct {
+    SourceID                 string `json:"source_id"`
+    CibleID                  string `json:"cible_id"`
+    ProduitsDeplaces         int64  `json:"produits_deplaces"`
+    SousCategoriesDeplacees  int64  `json:"sous_categories_deplacees"`  // Fusion : sous-catégories rattachées à la cible
+    AttributsDeplaces        int64  `json:"attributs_deplaces"`         // Fusion : définitions d'attributs reprises par la cible
+    ProduitsAttributsRetires int64  `json:"produits_attributs_retires"` // Produits ayant perdu des valeurs hors du schéma de la cible
+    SourceSupprimee          bool   `json:"source_supprimee"`
+}
+
+// ProduitRejete est un produit dont les attributs ne respectent pas le schéma de la catégorie cible
+type ProduitRejete struct {
+    ID      string `json:"id"`
+    Nom     string `json:"nom"`
+    Message string `json:"message"`
+}
+
+// CategorieResume est un élément du fil d'Ariane d'un produit
+type CategorieResume struct {
+    ID  string `db:"id" json:"id"`
+    Nom string `db:"nom" json:"nom"`
 }
 
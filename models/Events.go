@@ -15,4 +15,5 @@ type Event struct {
     Longitude      float64 `db:"longitude" json:"longitude"`
     CreatedAt      string  `db:"created_at" json:"created_at"`
     UpdatedAt      string  `db:"updated_at" json:"updated_at"`
+    Version        int     `db:"version" json:"version"` // Incrémentée à chaque modification, exposée en ETag
 }
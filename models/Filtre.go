@@ -10,4 +10,46 @@ type ProductFilters struct {
     CategorieID     string   `json:"categorie_id,omitempty"`
     Disponible      *bool    `json:"disponible,omitempty"`
     SearchTerm      string   `json:"search_term,omitempty"`
-}
\ No newline at end of file
+    Attributs       map[string][]string `json:"attributs,omitempty"`     // Code d'attribut → valeurs acceptées
+    AttributsMin    map[string]float64  `json:"attributs_min,omitempty"` // Bornes des attributs numériques
+    AttributsMax    map[string]float64  `json:"attributs_max,omitempty"`
+    InclureInactives bool    `json:"-"` // Administrateurs : inclut les produits des catégories non visibles
+}
+// FacetteValeur représente le nombre de produits pour une valeur de filtre
+type FacetteValeur struct {
+    Valeur  string `json:"valeur"`
+    Libelle string `json:"libelle,omitempty"` // Nom lisible, par exemple le nom de la catégorie
+    Nombre  int    `json:"nombre"`
+}
+
+// TranchePrix représente le nombre de produits dans une tranche de prix [Min, Max[
+type TranchePrix struct {
+    Min    float64  `json:"min"`
+    Max    *float64 `json:"max"` // nil pour la dernière tranche
+    Nombre int      `json:"nombre"`
+}
+
+// Facettes regroupe les compteurs affichés à côté des filtres
+type Facettes struct {
+    Marque       []FacetteValeur `json:"marque"`
+    Etat         []FacetteValeur `json:"etat"`
+    Localisation []FacetteValeur `json:"localisation"`
+    Categorie    []FacetteValeur `json:"categorie_id"`
+    Prix         []TranchePrix   `json:"prix"`
+}
+
+// ListingOptions décrit le tri et la pagination par curseur communs aux listes de produits
+type ListingOptions struct {
+    Tri     string // prix_asc, prix_desc, recent (défaut) ou populaire
+    Limite  int    // 20 par défaut, 100 au maximum
+    Curseur string // Curseur opaque retourné par la page précédente
+}
+
+// ProductPage représente une page de produits et le curseur de la page suivante
+type ProductPage struct {
+    Produits   []Product `json:"produits"`
+    NextCursor string    `json:"next_cursor,omitempty"`
+    HasMore    bool      `json:"has_more"`
+    Tri        string    `json:"sort"`
+    Limite     int       `json:"limit"`
+}
@@ -3,21 +3,73 @@ package models
 
 import "time"
 
+// EtatsProduit liste les valeurs autorisées par la contrainte CHECK de produits.etat
+var EtatsProduit = []string{"Très bon état", "Reconditionné", "Bon état", "État correct"}
+
 type Product struct {
     ID          string    `db:"id" json:"id"`
+    SKU         string    `db:"sku" json:"sku,omitempty"` // Référence fournisseur, clé des imports CSV
     Nom         string    `db:"nom" json:"nom"`
     Prix        float64   `db:"prix" json:"prix"`
     Stock       int       `db:"stock" json:"stock"`
+    StockDisponible int   `db:"stock_disponible" json:"stock_disponible"` // Stock moins les réservations de checkout actives
+    SeuilStockBas int     `db:"seuil_stock_bas" json:"seuil_stock_bas"` // Stock à partir duquel le produit figure dans l'alerte de stock bas
     Etat        string    `db:"etat" json:"etat"`
     Photos      []string  `db:"photos" json:"photos"`
     CategorieID string    `db:"categorie_id" json:"categorie_id"`
     CategorieNom  string    `json:"categorie_nom"`
+    FilAriane   []CategorieResume `db:"-" json:"fil_ariane,omitempty"` // Catégories de la racine jusqu'à celle du produit
     Localisation string   `db:"localisation" json:"localisation"`
     Description string    `db:"description" json:"description"`
     NombreVues  int       `db:"nombre_vues" json:"nombre_vues"`
     Disponible  bool      `db:"disponible" json:"disponible"`
     Marque      string    `db:"marque" json:"marque"`
     Modele      string    `db:"modele" json:"modele"`
+    Attributs   map[string]interface{} `db:"attributs" json:"attributs"` // Valeurs des attributs définis par la catégorie
     CreatedAt   time.Time `db:"created_at" json:"created_at"`
     UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
-}
\ No newline at end of file
+    Version     int       `db:"version" json:"version"` // Incrémentée à chaque modification, exposée en ETag
+    Extrait     string    `db:"-" json:"extrait,omitempty"` // Passage mis en évidence par la recherche plein texte
+    Variantes   []Variante `db:"-" json:"variantes,omitempty"`
+    Disponibilites []StockEmplacement `db:"-" json:"disponibilites,omitempty"` // Stock par entrepôt ou boutique
+}
+
+// ProductPatch liste les champs modifiables d'un produit ; un champ absent (nil) reste inchangé.
+type ProductPatch struct {
+    SKU           *string   `json:"sku"`
+    Nom           *string   `json:"nom"`
+    Prix          *float64  `json:"prix"`
+    Stock         *int      `json:"stock"` // Converti en ajustement dans le journal d'inventaire
+    SeuilStockBas *int      `json:"seuil_stock_bas"`
+    Etat          *string   `json:"etat"`
+    Photos        *[]string `json:"photos"`
+    CategorieID   *string   `json:"categorie_id"`
+    Localisation  *string   `json:"localisation"`
+    Description   *string   `json:"description"`
+    Disponible    *bool     `json:"disponible"`
+    Marque        *string   `json:"marque"`
+    Modele        *string   `json:"modele"`
+    Attributs     *map[string]interface{} `json:"attributs"` // Remplace toutes les valeurs d'attributs
+}
+
+// ProduitTendance représente un produit avec le nombre de vues des 7 derniers jours
+type ProduitTendance struct {
+    Product
+    VuesSemaine int `json:"vues_semaine"`
+}
+
+// ProduitStockBas représente un produit dont le stock est passé sous son seuil d'alerte
+type ProduitStockBas struct {
+    ID               string `db:"id" json:"id"`
+    Nom              string `db:"nom" json:"nom"`
+    Marque           string `db:"marque" json:"marque"`
+    Stock            int    `db:"stock" json:"stock"`
+    SeuilStockBas    int    `db:"seuil_stock_bas" json:"seuil_stock_bas"`
+    Disponible       bool   `db:"disponible" json:"disponible"`
+    IndisponibleAuto bool   `db:"indisponible_auto" json:"indisponible_auto"` // Désactivé automatiquement faute de stock
+}
+
+// StockBasEmailService envoie le récapitulatif quotidien des produits en stock bas
+type StockBasEmailService interface {
+    EnvoyerEmailStockBas(destinataires []string, produits []ProduitStockBas) error
+}
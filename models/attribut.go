@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Types d'attribut de catégorie
+const (
+    AttributEnum    = "enum"
+    AttributNombre  = "nombre"
+    AttributBooleen = "booleen"
+)
+
+// AttributCategorie décrit une caractéristique typée des produits d'une catégorie et de ses sous-catégories.
+type AttributCategorie struct {
+    ID          string    `db:"id" json:"id"`
+    CategorieID string    `db:"categorie_id" json:"categorie_id"`
+    Code        string    `db:"code" json:"code"` // Clé dans Product.Attributs
+    Libelle     string    `db:"libelle" json:"libelle"`
+    Type        string    `db:"type" json:"type"`
+    Unite       string    `db:"unite" json:"unite,omitempty"`     // Pour les attributs de type nombre
+    Valeurs     []string  `db:"valeurs" json:"valeurs,omitempty"` // Valeurs autorisées d'un enum
+    Obligatoire bool      `db:"obligatoire" json:"obligatoire"`
+    Ordre       int       `db:"ordre" json:"ordre"`
+    CreatedAt   time.Time `db:"created_at" json:"created_at"`
+    UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+}
@@ -12,6 +12,8 @@ type ProduitDetail struct {
     Etat         string  `json:"etat" db:"etat"`
     Localisation string  `json:"localisation" db:"localisation"`
     Photos       []string `json:"photos" db:"photos"`
+    SKU          string   `json:"sku,omitempty" db:"sku"`
+    Attributs    map[string]string `json:"attributs,omitempty" db:"-"` // Attributs de la variante commandée
 }
 
 type Commande struct {
@@ -26,10 +28,13 @@ type Commande struct {
 }
 
 type CommandeProduit struct {
-    CommandeID string  `json:"commande_id" db:"commande_id"`
-    ProduitID  string  `json:"produit_id" db:"produit_id"`
-    Quantite   int     `json:"quantite" db:"quantite"`
-    PrixUnite  float64 `json:"prix_unite" db:"prix_unite"`
+    CommandeID    string  `json:"commande_id" db:"commande_id"`
+    ProduitID     string  `json:"produit_id" db:"produit_id"`
+    VarianteID    string  `json:"variante_id,omitempty" db:"variante_id"` // Obligatoire si le produit a des variantes
+    SKU           string  `json:"sku,omitempty" db:"sku"`
+    EmplacementID string  `json:"emplacement_id,omitempty" db:"emplacement_id"` // Emplacement choisi, ou alloué à la création
+    Quantite      int     `json:"quantite" db:"quantite"`
+    PrixUnite     float64 `json:"prix_unite" db:"prix_unite"`
 }
 
 
@@ -50,3 +55,23 @@ type CommandeDetail struct {
     UpdatedAt      time.Time `db:"updated_at" json:"updated_at"`
 }
 
+// Statuts possibles d'une commande
+const (
+    CommandeStatusEnAttente  = "en_attente"
+    CommandeStatusPayee      = "payée"
+    CommandeStatusExpediee   = "expédiée"
+    CommandeStatusLivree     = "livrée"
+    CommandeStatusAnnulee    = "annulée"
+    CommandeStatusRemboursee = "remboursée"
+)
+
+// CommandeStatusHistorique représente un changement de statut d'une commande
+type CommandeStatusHistorique struct {
+    ID            string    `db:"id" json:"id"`
+    CommandeID    string    `db:"commande_id" json:"commande_id"`
+    AncienStatus  *string   `db:"ancien_status" json:"ancien_status"`
+    NouveauStatus string    `db:"nouveau_status" json:"nouveau_status"`
+    ModifiePar    string    `db:"modifie_par" json:"modifie_par"`
+    Commentaire   string    `db:"commentaire" json:"commentaire"`
+    CreatedAt     time.Time `db:"created_at" json:"created_at"`
+}
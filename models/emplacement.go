@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Types d'emplacement de stock
+const (
+    EmplacementEntrepot = "entrepot"
+    EmplacementBoutique = "boutique"
+)
+
+// Emplacement représente un entrepôt ou une boutique détenant du stock.
+type Emplacement struct {
+    ID           string    `db:"id" json:"id"`
+    Nom          string    `db:"nom" json:"nom"`
+    Type         string    `db:"type" json:"type"`
+    Adresse      string    `db:"adresse" json:"adresse"`
+    Localisation string    `db:"localisation" json:"localisation"` // Même libellé que Product.Localisation
+    Latitude     *float64  `db:"latitude" json:"latitude"`
+    Longitude    *float64  `db:"longitude" json:"longitude"`
+    Actif        bool      `db:"actif" json:"actif"`
+    CreatedAt    time.Time `db:"created_at" json:"created_at"`
+    UpdatedAt    time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// StockEmplacement représente la quantité d'un produit (ou d'une variante) disponible dans un emplacement.
+type StockEmplacement struct {
+    EmplacementID string   `db:"emplacement_id" json:"emplacement_id"`
+    Nom           string   `db:"nom" json:"nom"`
+    Type          string   `db:"type" json:"type"`
+    Localisation  string   `db:"localisation" json:"localisation"`
+    ProduitID     string   `db:"produit_id" json:"produit_id"`
+    VarianteID    string   `db:"variante_id" json:"variante_id,omitempty"`
+    Quantite      int      `db:"quantite" json:"quantite"`
+    DistanceKm    *float64 `db:"distance_km" json:"distance_km,omitempty"` // Renseignée si une position est fournie
+}
+
+// Position est un point géographique, utilisé pour choisir l'emplacement le plus proche.
+type Position struct {
+    Latitude  float64 `json:"latitude"`
+    Longitude float64 `json:"longitude"`
+}
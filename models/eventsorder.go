@@ -6,11 +6,21 @@ import (
 
 // Ticket représente un ticket acheté pour un événement.
 type Ticket struct {
-    ID          string    `json:"id" db:"id"`
-    EventID     string    `json:"event_id" db:"event_id"` // L'ID de l'événement auquel ce ticket est lié
-    UserID      string    `json:"user_id" db:"user_id"`   // L'ID de l'utilisateur ayant acheté le ticket
-    Price       float64   `json:"price" db:"price"`       // Le prix du ticket
-    Status      string    `json:"status" db:"status"`     // Le statut du ticket (par exemple "validé" ou "annulé")
-    CreatedAt   time.Time `json:"created_at" db:"created_at"`
-    UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+    ID           string    `json:"id" db:"id"`
+    NumeroTicket string    `json:"numero_ticket" db:"numero_ticket"`
+    EventID      string    `json:"event_id" db:"event_id"`         // L'ID de l'événement auquel ce ticket est lié
+    UserID       string    `json:"user_id" db:"user_id"`           // L'ID de l'utilisateur ayant acheté le ticket
+    Quantity     int       `json:"quantity" db:"quantity"`         // Le nombre de places achetées
+    PriceTotal   float64   `json:"price_total" db:"price_total"`   // Le prix total payé pour les places
+    Status       string    `json:"status" db:"status"`             // Le statut du ticket (par exemple "validé" ou "annulé")
+    StartDate    string    `json:"start_date" db:"start_date"`     // Copie de la date de l'événement au moment de l'achat
+    StartTime    string    `json:"start_time" db:"start_time"`     // Copie de l'heure de l'événement au moment de l'achat
+    EventTitle   string    `json:"event_title,omitempty" db:"event_title"`
+    CreatedAt    time.Time `json:"created_at" db:"created_at"`
+    UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
 }
+
+const (
+    TicketStatusValide = "validé"
+    TicketStatusAnnule = "annulé"
+)
@@ -0,0 +1,18 @@
+package models
+
+// ErreurImport décrit une ligne du fichier CSV qui n'a pas pu être importée
+type ErreurImport struct {
+    Ligne   int    `json:"ligne"` // Numéro de ligne dans le fichier, en-tête compris
+    Colonne string `json:"colonne,omitempty"`
+    Message string `json:"message"`
+}
+
+// RapportImport résume un import CSV de produits
+type RapportImport struct {
+    DryRun   bool           `json:"dry_run"`
+    Lignes   int            `json:"lignes"`
+    Crees    int            `json:"crees"`
+    MisAJour int            `json:"mis_a_jour"`
+    Erreurs  []ErreurImport `json:"erreurs"`
+    Applique bool           `json:"applique"` // false en dry-run ou si au moins une ligne est en erreur
+}
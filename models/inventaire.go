@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// Raisons possibles d'un mouvement de stock
+const (
+    RaisonVente      = "vente"
+    RaisonAnnulation = "annulation"
+    RaisonAjustement = "ajustement"
+    RaisonRetour     = "retour"
+    RaisonImport     = "import"
+    RaisonTransfert  = "transfert" // Déplacement entre emplacements, sans effet sur le stock total
+)
+
+// MouvementStock est une ligne du journal d'inventaire (inventory_movements).
+// Quantite est signée : négative pour une sortie, positive pour une entrée.
+type MouvementStock struct {
+    ID            string    `db:"id" json:"id"`
+    ProduitID     string    `db:"produit_id" json:"produit_id"`                 // Vide si le produit a été supprimé
+    VarianteID    string    `db:"variante_id" json:"variante_id,omitempty"`
+    ProduitNom    string    `db:"produit_nom" json:"produit_nom"`               // Nom de l'article au moment du mouvement
+    SKU           string    `db:"sku" json:"sku,omitempty"`                     // SKU de la variante, sinon du produit
+    EmplacementID string    `db:"emplacement_id" json:"emplacement_id,omitempty"` // Vide : stock non affecté à un emplacement
+    Quantite      int       `db:"quantite" json:"quantite"`
+    StockApres    int       `db:"stock_apres" json:"stock_apres"`
+    Raison        string    `db:"raison" json:"raison"`
+    Reference     string    `db:"reference" json:"reference,omitempty"` // ex. ID de la commande
+    Commentaire   string    `db:"commentaire" json:"commentaire,omitempty"`
+    CreePar       string    `db:"cree_par" json:"cree_par"`
+    CreatedAt     time.Time `db:"created_at" json:"created_at"`
+}
+
+// EcartStock signale un produit ou une variante dont le stock ne correspond pas au journal.
+type EcartStock struct {
+    ProduitID    string `db:"produit_id" json:"produit_id"`
+    VarianteID   string `db:"variante_id" json:"variante_id,omitempty"`
+    Nom          string `db:"nom" json:"nom"`
+    SKU          string `db:"sku" json:"sku,omitempty"`
+    Stock        int    `db:"stock" json:"stock"`
+    StockJournal int    `db:"stock_journal" json:"stock_journal"`
+    Ecart        int    `db:"ecart" json:"ecart"` // Stock - StockJournal
+}
@@ -4,19 +4,43 @@ import "time"
 
 // ListeSouhaits représente une entrée dans la liste des souhaits
 type ListeSouhaits struct {
-    ID        string    `db:"id" json:"id"`               // UUID pour l'id de la liste de souhaits
-    GoogleID  string    `db:"google_id" json:"google_id"` // Identifiant de l'utilisateur
-    ProduitID string    `db:"produit_id" json:"produit_id"` // Identifiant du produit
-    CreatedAt time.Time `db:"created_at" json:"created_at"` // Date de création
-    UpdatedAt time.Time `db:"updated_at" json:"updated_at"` // Date de mise à jour
+    ID             string    `db:"id" json:"id"`                           // UUID pour l'id de la liste de souhaits
+    GoogleID       string    `db:"google_id" json:"google_id"`             // Identifiant de l'utilisateur
+    ProduitID      string    `db:"produit_id" json:"produit_id"`           // Identifiant du produit
+    Notifier       bool      `db:"notifier" json:"notifier"`               // Prévenir l'utilisateur en cas de baisse de prix ou de retour en stock
+    PrixReference  float64   `db:"prix_reference" json:"prix_reference"`   // Dernier prix connu de l'utilisateur
+    StockReference int       `db:"stock_reference" json:"stock_reference"` // Dernier stock connu de l'utilisateur
+    CreatedAt      time.Time `db:"created_at" json:"created_at"`           // Date de création
+    UpdatedAt      time.Time `db:"updated_at" json:"updated_at"`           // Date de mise à jour
 }
 
 // ProduitSouhait représente les détails d'un produit dans la liste de souhaits
 type ProduitSouhait struct {
-    ID       string  `db:"id"`
-    Nom      string  `db:"nom"`
-    Prix     float64 `db:"prix"`
-    Marque   string  `db:"marque"`
-    Photos   []string `db:"photos"` // Si tu veux aussi garder toutes les photos
-    Photo    string  // Champ supplémentaire pour la première photo
-}
\ No newline at end of file
+    ID         string    `db:"id" json:"id"`
+    Nom        string    `db:"nom" json:"nom"`
+    Prix       float64   `db:"prix" json:"prix"`
+    Marque     string    `db:"marque" json:"marque"`
+    Photos     []string  `db:"photos" json:"photos"` // Si tu veux aussi garder toutes les photos
+    Photo      string    `json:"photo"`              // Champ supplémentaire pour la première photo
+    Stock      int       `db:"stock" json:"stock"`
+    Disponible bool      `db:"disponible" json:"disponible"`
+    Notifier   bool      `db:"notifier" json:"notifier"`
+    AjouteLe   time.Time `db:"created_at" json:"ajoute_le"`
+}
+
+// AlerteSouhait décrit une notification à envoyer pour un produit de la liste de souhaits
+type AlerteSouhait struct {
+    SouhaitID     string
+    Email         string
+    NomProduit    string
+    Prix          float64
+    AncienPrix    float64
+    Stock         int
+    BaissePrix    bool
+    RetourEnStock bool
+}
+
+// SouhaitEmailService envoie les alertes de la liste de souhaits
+type SouhaitEmailService interface {
+    EnvoyerEmailAlerteSouhait(alerte AlerteSouhait) error
+}
@@ -0,0 +1,15 @@
+package models
+
+// Media regroupe les URLs des déclinaisons d'une image téléversée.
+// Original est l'image réencodée sans métadonnées EXIF.
+type Media struct {
+    ID        string `json:"id"`
+    Original  string `json:"original"`
+    Medium    string `json:"medium"`
+    Miniature string `json:"miniature"`
+}
+
+// NettoyeurMedias supprime les fichiers d'images qui ne sont plus référencés par aucun produit.
+type NettoyeurMedias interface {
+    SupprimerOrphelins(urls []string) error
+}
@@ -0,0 +1,26 @@
+package models
+
+// PanierLigne représente un produit du panier avec sa quantité et son sous-total
+type PanierLigne struct {
+    ProduitID     string  `db:"produit_id" json:"produit_id"`
+    VarianteID    string  `db:"variante_id" json:"variante_id,omitempty"`
+    SKU           string  `db:"sku" json:"sku,omitempty"`
+    Attributs     map[string]string `db:"-" json:"attributs,omitempty"` // Attributs de la variante choisie
+    Nom           string  `db:"nom" json:"nom"`
+    Prix          float64 `db:"prix" json:"prix"`
+    Marque        string  `db:"marque" json:"marque"`
+    Photo         string  `json:"photo"`
+    Quantite      int     `db:"quantite" json:"quantite"`
+    SousTotal     float64 `json:"sous_total"`
+    Stock         int     `db:"stock" json:"stock"`
+    Disponible    bool    `db:"disponible" json:"disponible"`
+    Avertissement string  `json:"avertissement,omitempty"` // Rempli si la ligne ne peut pas être commandée en l'état
+}
+
+// Panier représente le contenu du panier d'un utilisateur et ses totaux
+type Panier struct {
+    Lignes         []PanierLigne `json:"produits"`
+    NombreArticles int           `json:"nombre_articles"`
+    Total          float64       `json:"total"`
+    Commandable    bool          `json:"commandable"` // false si au moins une ligne porte un avertissement
+}
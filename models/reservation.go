@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Statuts d'une réservation de stock
+const (
+    ReservationActive    = "active"
+    ReservationConvertie = "convertie" // Transformée en commande
+    ReservationExpiree   = "expiree"
+    ReservationLiberee   = "liberee" // Abandonnée par l'utilisateur
+)
+
+// Reservation bloque une quantité d'un produit (ou d'une variante) pour un utilisateur pendant le checkout.
+type Reservation struct {
+    ID         string    `db:"id" json:"id"`
+    UserID     string    `db:"user_id" json:"user_id"`
+    ProduitID  string    `db:"produit_id" json:"produit_id"`
+    VarianteID string    `db:"variante_id" json:"variante_id,omitempty"`
+    Quantite   int       `db:"quantite" json:"quantite"`
+    Statut     string    `db:"statut" json:"statut"`
+    ExpireLe   time.Time `db:"expire_le" json:"expire_le"`
+    CommandeID string    `db:"commande_id" json:"commande_id,omitempty"`
+    CreatedAt  time.Time `db:"created_at" json:"created_at"`
+}
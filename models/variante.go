@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Variante représente une déclinaison d'un produit (taille, couleur, capacité...)
+// avec son propre SKU, son stock et éventuellement son propre prix.
+type Variante struct {
+    ID           string            `db:"id" json:"id"`
+    ProduitID    string            `db:"produit_id" json:"produit_id"`
+    SKU          string            `db:"sku" json:"sku"`
+    Attributs    map[string]string `db:"attributs" json:"attributs"`
+    Prix         *float64          `db:"prix" json:"prix"`                   // nil : le prix du produit s'applique
+    PrixEffectif float64           `db:"prix_effectif" json:"prix_effectif"` // Prix de la variante ou, à défaut, du produit
+    Stock        int               `db:"stock" json:"stock"`
+    StockDisponible int            `db:"stock_disponible" json:"stock_disponible"` // Stock moins les réservations actives
+    Disponible   bool              `db:"disponible" json:"disponible"`
+    CreatedAt    time.Time         `db:"created_at" json:"created_at"`
+    UpdatedAt    time.Time         `db:"updated_at" json:"updated_at"`
+}
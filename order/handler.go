@@ -2,11 +2,15 @@ package order
 
 import (
     "encoding/json"
+    "ecommerce-api/admin"
     "ecommerce-api/models"
     "ecommerce-api/googleauth"
+    "errors"
     "fmt"
     "net/http"
     "strings"
+
+    "github.com/go-chi/chi/v5"
 )
 
 type Handler struct {
@@ -50,6 +54,7 @@ func (h *Handler) HandleCreerCommande(w http.ResponseWriter, r *http.Request) {
 
     var req struct {
         Produits []*models.CommandeProduit `json:"produits"`
+        Position *models.Position          `json:"position"` // Pour prélever dans l'emplacement le plus proche
     }
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
         http.Error(w, "Format de requête invalide", http.StatusBadRequest)
@@ -61,7 +66,7 @@ func (h *Handler) HandleCreerCommande(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    commande, err := h.repo.CreerCommande(googleID, req.Produits)
+    commande, err := h.repo.CreerCommande(googleID, req.Produits, req.Position)
     if err != nil {
         http.Error(w, fmt.Sprintf("Erreur lors de la création de la commande: %v", err), http.StatusInternalServerError)
         return
@@ -140,4 +145,122 @@ func (h *Handler) HandleListerToutesCommandes(w http.ResponseWriter, r *http.Req
     }); err != nil {
         http.Error(w, "Erreur lors de l'encodage de la réponse", http.StatusInternalServerError)
     }
-}
\ No newline at end of file
+}
+
+// HandleChangerStatut permet à un admin de faire avancer une commande dans son cycle de vie.
+func (h *Handler) HandleChangerStatut(w http.ResponseWriter, r *http.Request) {
+    commandeID := chi.URLParam(r, "id")
+
+    var req struct {
+        Status      string `json:"status"`
+        Commentaire string `json:"commentaire"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Status == "" {
+        http.Error(w, "Format de requête invalide ou statut manquant", http.StatusBadRequest)
+        return
+    }
+
+    changement, err := h.repo.ChangerStatutCommande(commandeID, req.Status, admin.AdminEmail(r), req.Commentaire)
+    if err != nil {
+        ecrireErreurCommande(w, err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "status":  "success",
+        "message": "Statut de la commande mis à jour",
+        "data":    changement,
+    })
+}
+
+// HandleAnnulerCommande permet au client d'annuler sa commande tant qu'elle n'a pas été expédiée.
+func (h *Handler) HandleAnnulerCommande(w http.ResponseWriter, r *http.Request) {
+    googleID, _, err := googleauth.ExtraireUtilisateur(r)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+
+    var req struct {
+        Commentaire string `json:"commentaire"`
+    }
+    // Le motif est facultatif : un corps vide est accepté
+    json.NewDecoder(r.Body).Decode(&req)
+
+    changement, err := h.repo.AnnulerCommande(chi.URLParam(r, "id"), googleID, req.Commentaire)
+    if err != nil {
+        ecrireErreurCommande(w, err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "status":  "success",
+        "message": "Commande annulée, les produits ont été remis en stock",
+        "data":    changement,
+    })
+}
+
+// HandleAnnulerCommandeAdmin permet à un admin d'annuler n'importe quelle commande encore annulable.
+func (h *Handler) HandleAnnulerCommandeAdmin(w http.ResponseWriter, r *http.Request) {
+    var req struct {
+        Commentaire string `json:"commentaire"`
+    }
+    json.NewDecoder(r.Body).Decode(&req)
+
+    changement, err := h.repo.ChangerStatutCommande(chi.URLParam(r, "id"), models.CommandeStatusAnnulee, admin.AdminEmail(r), req.Commentaire)
+    if err != nil {
+        ecrireErreurCommande(w, err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "status":  "success",
+        "message": "Commande annulée, les produits ont été remis en stock",
+        "data":    changement,
+    })
+}
+
+// HandleHistoriqueCommande retourne la chronologie des statuts d'une commande de l'utilisateur connecté.
+func (h *Handler) HandleHistoriqueCommande(w http.ResponseWriter, r *http.Request) {
+    googleID, _, err := googleauth.ExtraireUtilisateur(r)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+
+    h.ecrireHistorique(w, chi.URLParam(r, "id"), googleID)
+}
+
+// HandleHistoriqueCommandeAdmin retourne la chronologie des statuts de n'importe quelle commande.
+func (h *Handler) HandleHistoriqueCommandeAdmin(w http.ResponseWriter, r *http.Request) {
+    h.ecrireHistorique(w, chi.URLParam(r, "id"), "")
+}
+
+func (h *Handler) ecrireHistorique(w http.ResponseWriter, commandeID, userID string) {
+    historique, err := h.repo.ListerHistoriqueCommande(commandeID, userID)
+    if err != nil {
+        ecrireErreurCommande(w, err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "status": "success",
+        "data":   historique,
+    })
+}
+
+// ecrireErreurCommande traduit les erreurs du repository en codes HTTP.
+func ecrireErreurCommande(w http.ResponseWriter, err error) {
+    switch {
+    case errors.Is(err, ErrCommandeIntrouvable):
+        http.Error(w, err.Error(), http.StatusNotFound)
+    case errors.Is(err, ErrTransitionInvalide):
+        http.Error(w, err.Error(), http.StatusConflict)
+    default:
+        http.Error(w, fmt.Sprintf("Erreur lors du traitement de la commande : %v", err), http.StatusInternalServerError)
+    }
+}
@@ -3,8 +3,10 @@ package order
 
 import (
 	"database/sql"
+	"ecommerce-api/inventaire"
 	"ecommerce-api/models"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -21,7 +23,19 @@ type Repository struct {
 func NewRepository(db *sqlx.DB) *Repository {
     return &Repository{db: db}
 }
-func (r *Repository) CreerCommande(userID string, produits []*models.CommandeProduit) (*models.Commande, error) {
+// CreerCommande crée la commande et prélève le stock de chaque ligne dans l'emplacement choisi
+// (CommandeProduit.EmplacementID) ou, à défaut, dans les emplacements les plus proches de origine.
+func (r *Repository) CreerCommande(userID string, produits []*models.CommandeProduit, origine *models.Position) (*models.Commande, error) {
+    return r.creerCommande(userID, produits, origine, false)
+}
+
+// CreerCommandeDepuisPanier crée la commande comme CreerCommande et vide le panier de l'utilisateur
+// dans la même transaction : une nouvelle tentative ne peut pas dupliquer la commande.
+func (r *Repository) CreerCommandeDepuisPanier(userID string, produits []*models.CommandeProduit, origine *models.Position) (*models.Commande, error) {
+    return r.creerCommande(userID, produits, origine, true)
+}
+
+func (r *Repository) creerCommande(userID string, produits []*models.CommandeProduit, origine *models.Position, viderPanier bool) (*models.Commande, error) {
     // Validation des entrées
     if len(produits) == 0 {
         return nil, fmt.Errorf("la commande doit contenir au moins un produit")
@@ -44,13 +58,26 @@ func (r *Repository) CreerCommande(userID string, produits []*models.CommandePro
     }
     defer tx.Rollback()
 
-    // Préparer la requête pour optimiser les performances
-    stmt, err := tx.Preparex(`SELECT nom, prix, stock FROM produits WHERE id = $1 FOR UPDATE`)
+    // Préparer les requêtes pour optimiser les performances
+    stmt, err := tx.Preparex(`
+        SELECT nom, prix, stock, EXISTS (SELECT 1 FROM produit_variantes WHERE produit_id = produits.id)
+        FROM produits WHERE id = $1 FOR UPDATE`)
     if err != nil {
         return nil, fmt.Errorf("erreur lors de la préparation de la requête: %v", err)
     }
     defer stmt.Close()
 
+    stmtVariante, err := tx.Preparex(`
+        SELECT p.nom, COALESCE(v.prix, p.prix), v.stock, v.disponible, v.sku, v.attributs
+        FROM produit_variantes v
+        JOIN produits p ON p.id = v.produit_id
+        WHERE v.id = $1 AND v.produit_id = $2
+        FOR UPDATE OF v`)
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors de la préparation de la requête: %v", err)
+    }
+    defer stmtVariante.Close()
+
     var produitsDetails []models.ProduitDetail
 
     // Vérifier tous les produits avant de faire des modifications
@@ -62,13 +89,44 @@ func (r *Repository) CreerCommande(userID string, produits []*models.CommandePro
         var nom string
         var prixUnite float64
         var stockDisponible int
+        var attributs map[string]string
+
+        if produit.VarianteID == "" {
+            var aVariantes bool
+            err := stmt.QueryRow(produit.ProduitID).Scan(&nom, &prixUnite, &stockDisponible, &aVariantes)
+            if err == sql.ErrNoRows {
+                return nil, fmt.Errorf("le produit %s n'existe pas dans la base de données", produit.ProduitID)
+            } else if err != nil {
+                return nil, fmt.Errorf("erreur lors de la lecture du produit %s: %v", produit.ProduitID, err)
+            }
+            if aVariantes {
+                return nil, fmt.Errorf("une variante doit être choisie pour le produit %s", nom)
+            }
+            produit.SKU = ""
+        } else {
+            var disponible bool
+            var attributsJSON []byte
+            err := stmtVariante.QueryRow(produit.VarianteID, produit.ProduitID).Scan(
+                &nom, &prixUnite, &stockDisponible, &disponible, &produit.SKU, &attributsJSON)
+            if err == sql.ErrNoRows {
+                return nil, fmt.Errorf("la variante %s n'existe pas pour le produit %s", produit.VarianteID, produit.ProduitID)
+            } else if err != nil {
+                return nil, fmt.Errorf("erreur lors de la lecture de la variante %s: %v", produit.VarianteID, err)
+            }
+            if !disponible {
+                return nil, fmt.Errorf("la variante %s du produit %s n'est pas disponible", produit.SKU, nom)
+            }
+            if err := json.Unmarshal(attributsJSON, &attributs); err != nil {
+                return nil, fmt.Errorf("attributs invalides pour la variante %s: %v", produit.SKU, err)
+            }
+        }
 
-        err := stmt.QueryRow(produit.ProduitID).Scan(&nom, &prixUnite, &stockDisponible)
-        if err == sql.ErrNoRows {
-            return nil, fmt.Errorf("le produit %s n'existe pas dans la base de données", produit.ProduitID)
-        } else if err != nil {
-            return nil, fmt.Errorf("erreur lors de la lecture du produit %s: %v", produit.ProduitID, err)
+        // Le stock réservé par d'autres acheteurs en cours de checkout n'est pas disponible
+        reserve, err := inventaire.StockReserve(tx, produit.ProduitID, produit.VarianteID, userID)
+        if err != nil {
+            return nil, err
         }
+        stockDisponible -= reserve
 
         if stockDisponible < produit.Quantite {
             return nil, fmt.Errorf("stock insuffisant pour le produit %s (demandé: %d, disponible: %d)",
@@ -82,6 +140,8 @@ func (r *Repository) CreerCommande(userID string, produits []*models.CommandePro
             Nom:       nom,
             PrixUnite: prixUnite,
             Quantite:  produit.Quantite,
+            SKU:       produit.SKU,
+            Attributs: attributs,
         })
     }
 
@@ -91,7 +151,7 @@ func (r *Repository) CreerCommande(userID string, produits []*models.CommandePro
         NumeroCommande: numeroCommande,
         UserID:         userID,
         MontantTotal:   montantTotal,
-        Status:         "en_attente",
+        Status:         models.CommandeStatusEnAttente,
         CreatedAt:      time.Now(),
         UpdatedAt:      time.Now(),
         Produits:       produitsDetails,
@@ -106,35 +166,56 @@ func (r *Repository) CreerCommande(userID string, produits []*models.CommandePro
         return nil, fmt.Errorf("erreur lors de l'insertion de la commande: %v", err)
     }
 
-    // Insérer les produits de la commande et mettre à jour les stocks
+    if err = insererHistorique(tx, commande.ID, nil, commande.Status, userID, "Commande créée"); err != nil {
+        return nil, err
+    }
+
+    // Allouer les emplacements, mettre à jour les stocks et insérer les produits de la commande
     for _, produit := range produits {
+        prelevements, err := inventaire.AllouerEmplacements(tx, produit.ProduitID, produit.VarianteID,
+            produit.Quantite, produit.EmplacementID, origine)
+        if err != nil {
+            return nil, fmt.Errorf("impossible d'allouer le produit %s: %w", produit.ProduitID, err)
+        }
+
+        // Décrémenter le stock de chaque emplacement et l'inscrire au journal d'inventaire
+        for _, prelevement := range prelevements {
+            err = inventaire.AppliquerMouvement(tx, &models.MouvementStock{
+                ProduitID:     produit.ProduitID,
+                VarianteID:    produit.VarianteID,
+                EmplacementID: prelevement.EmplacementID,
+                Quantite:      -prelevement.Quantite,
+                Raison:        models.RaisonVente,
+                Reference:     commande.ID,
+                CreePar:       userID,
+            })
+            if err != nil {
+                return nil, fmt.Errorf("impossible de mettre à jour le stock du produit %s: %w", produit.ProduitID, err)
+            }
+        }
+        // La ligne de commande indique l'emplacement principal ; le détail reste dans le journal
+        produit.EmplacementID = prelevements[0].EmplacementID
+
         // Insérer dans commande_produits
         produit.CommandeID = commande.ID
         _, err = tx.NamedExec(`
-            INSERT INTO commande_produits (commande_id, produit_id, quantite, prix_unite)
-            VALUES (:commande_id, :produit_id, :quantite, :prix_unite)`,
+            INSERT INTO commande_produits (commande_id, produit_id, variante_id, sku, emplacement_id, quantite, prix_unite)
+            VALUES (:commande_id, :produit_id, NULLIF(:variante_id, '')::uuid, NULLIF(:sku, ''),
+                    NULLIF(:emplacement_id, '')::uuid, :quantite, :prix_unite)`,
             produit)
         if err != nil {
             return nil, fmt.Errorf("erreur lors de l'insertion du produit dans la commande: %v", err)
         }
+    }
 
-        // Mettre à jour le stock
-        result, err := tx.Exec(`
-            UPDATE produits 
-            SET stock = stock - $1,
-                updated_at = NOW()
-            WHERE id = $2 AND stock >= $1`,
-            produit.Quantite, produit.ProduitID)
-        if err != nil {
-            return nil, fmt.Errorf("erreur lors de la mise à jour du stock: %v", err)
-        }
+    // Les réservations du checkout sont consommées par la commande
+    if err = inventaire.ConvertirReservations(tx, userID, commande.ID); err != nil {
+        return nil, err
+    }
 
-        rowsAffected, err := result.RowsAffected()
-        if err != nil {
-            return nil, fmt.Errorf("erreur lors de la vérification de la mise à jour: %v", err)
-        }
-        if rowsAffected == 0 {
-            return nil, fmt.Errorf("impossible de mettre à jour le stock du produit %s", produit.ProduitID)
+    if viderPanier {
+        if _, err = tx.Exec(`DELETE FROM panier WHERE user_id = $1`, userID); err != nil {
+            return nil, fmt.Errorf("impossible de vider le panier: %v", err)
         }
     }
 
@@ -180,10 +261,13 @@ func (r *Repository) ListerCommandesParUtilisateur(userID string) ([]*models.Com
             cp.quantite AS produit_quantite,
             p.etat AS produit_etat,
             p.localisation AS produit_localisation,
-            p.photos AS produit_photos
+            p.photos AS produit_photos,
+            cp.sku AS produit_sku,
+            v.attributs AS variante_attributs
         FROM commandes c
         LEFT JOIN commande_produits cp ON cp.commande_id = c.id
         LEFT JOIN produits p ON p.id = cp.produit_id
+        LEFT JOIN produit_variantes v ON v.id = cp.variante_id
         WHERE c.user_id = $1
         ORDER BY c.created_at DESC
     `
@@ -211,12 +295,14 @@ func (r *Repository) ListerCommandesParUtilisateur(userID string) ([]*models.Com
             produitEtat  sql.NullString
             produitLocalisation sql.NullString
             produitPhotos sql.NullString
+            produitSKU   sql.NullString
+            varianteAttributs []byte
         )
 
         err := rows.Scan(
             &commandeID, &numeroCommande, &userID, &montantTotal, &status, &createdAt, &updatedAt,
             &produitNom, &produitMarque, &produitModele, &produitPrix, &produitQuantite, 
-            &produitEtat, &produitLocalisation, &produitPhotos,
+            &produitEtat, &produitLocalisation, &produitPhotos, &produitSKU, &varianteAttributs,
         )
         if err != nil {
             return nil, fmt.Errorf("erreur lors du scan des commandes: %w", err)
@@ -245,6 +331,13 @@ func (r *Repository) ListerCommandesParUtilisateur(userID string) ([]*models.Com
             if err != nil {
                 return nil, fmt.Errorf("erreur lors de la conversion des photos pour le produit %s: %w", produitNom.String, err)
             }
+
+            var attributs map[string]string
+            if varianteAttributs != nil {
+                if err := json.Unmarshal(varianteAttributs, &attributs); err != nil {
+                    return nil, fmt.Errorf("erreur lors de la lecture des attributs de la variante %s: %w", produitSKU.String, err)
+                }
+            }
         
         
 
@@ -256,6 +349,8 @@ func (r *Repository) ListerCommandesParUtilisateur(userID string) ([]*models.Com
                 Etat:        produitEtat.String,
                 Localisation: produitLocalisation.String,
                 Photos:      photos,
+                SKU:         produitSKU.String,
+                Attributs:   attributs,
             })
         }
     }
@@ -300,3 +395,188 @@ func (r *Repository) ListerToutesCommandes() ([]*models.CommandeDetail, error) {
     return commandes, nil
 }
 
+// insererHistorique enregistre un changement de statut dans commande_status_history.
+func insererHistorique(tx *sqlx.Tx, commandeID string, ancienStatus *string, nouveauStatus, modifiePar, commentaire string) error {
+    _, err := tx.Exec(`
+        INSERT INTO commande_status_history (commande_id, ancien_status, nouveau_status, modifie_par, commentaire, created_at)
+        VALUES ($1, $2, $3, $4, $5, NOW())`,
+        commandeID, ancienStatus, nouveauStatus, modifiePar, commentaire)
+    if err != nil {
+        return fmt.Errorf("erreur lors de l'enregistrement de l'historique: %v", err)
+    }
+    return nil
+}
+
+// ChangerStatutCommande fait passer une commande à un nouveau statut si la transition est autorisée
+// et enregistre le changement dans l'historique.
+func (r *Repository) ChangerStatutCommande(commandeID, nouveauStatus, modifiePar, commentaire string) (*models.CommandeStatusHistorique, error) {
+    return r.changerStatut(commandeID, "", nouveauStatus, modifiePar, commentaire)
+}
+
+// AnnulerCommande annule une commande d'un client tant qu'elle n'a pas été expédiée
+// et remet les quantités commandées en stock.
+func (r *Repository) AnnulerCommande(commandeID, userID, commentaire string) (*models.CommandeStatusHistorique, error) {
+    return r.changerStatut(commandeID, userID, models.CommandeStatusAnnulee, userID, commentaire)
+}
+
+// changerStatut applique une transition dans une transaction. Si proprietaire est renseigné,
+// la commande doit lui appartenir et ne peut être annulée qu'avant l'expédition.
+// Le passage à "annulée" remet les produits de la commande en stock.
+func (r *Repository) changerStatut(commandeID, proprietaire, nouveauStatus, modifiePar, commentaire string) (*models.CommandeStatusHistorique, error) {
+    if _, err := uuid.Parse(commandeID); err != nil {
+        return nil, ErrCommandeIntrouvable
+    }
+    if !StatutValide(nouveauStatus) {
+        return nil, fmt.Errorf("%w: statut inconnu %q", ErrTransitionInvalide, nouveauStatus)
+    }
+
+    tx, err := r.db.Beginx()
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors du début de la transaction: %v", err)
+    }
+    defer tx.Rollback()
+
+    var statusActuel, userID string
+    err = tx.QueryRow(`SELECT status, user_id FROM commandes WHERE id = $1 FOR UPDATE`, commandeID).Scan(&statusActuel, &userID)
+    if err == sql.ErrNoRows {
+        return nil, ErrCommandeIntrouvable
+    } else if err != nil {
+        return nil, fmt.Errorf("erreur lors de la lecture de la commande: %v", err)
+    }
+
+    if proprietaire != "" {
+        if userID != proprietaire {
+            return nil, ErrCommandeIntrouvable
+        }
+        if statusActuel != models.CommandeStatusEnAttente && statusActuel != models.CommandeStatusPayee {
+            return nil, fmt.Errorf("%w: une commande %s ne peut plus être annulée", ErrTransitionInvalide, statusActuel)
+        }
+    }
+
+    if !TransitionAutorisee(statusActuel, nouveauStatus) {
+        return nil, fmt.Errorf("%w: %s → %s", ErrTransitionInvalide, statusActuel, nouveauStatus)
+    }
+
+    _, err = tx.Exec(`UPDATE commandes SET status = $1, updated_at = NOW() WHERE id = $2`, nouveauStatus, commandeID)
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors de la mise à jour du statut: %v", err)
+    }
+
+    if nouveauStatus == models.CommandeStatusAnnulee {
+        if err = restaurerStock(tx, commandeID, modifiePar); err != nil {
+            return nil, err
+        }
+    }
+
+    if err = insererHistorique(tx, commandeID, &statusActuel, nouveauStatus, modifiePar, commentaire); err != nil {
+        return nil, err
+    }
+
+    if err = tx.Commit(); err != nil {
+        return nil, fmt.Errorf("erreur lors de la validation de la transaction: %v", err)
+    }
+
+    return &models.CommandeStatusHistorique{
+        CommandeID:    commandeID,
+        AncienStatus:  &statusActuel,
+        NouveauStatus: nouveauStatus,
+        ModifiePar:    modifiePar,
+        Commentaire:   commentaire,
+        CreatedAt:     time.Now(),
+    }, nil
+}
+
+// restaurerStock rajoute au stock les quantités de commande_produits, à l'inverse du décrément de CreerCommande,
+// en inscrivant une annulation au journal d'inventaire. Chaque emplacement récupère ce que la vente y a prélevé.
+// Les lignes dont la variante a été supprimée sont ignorées.
+func restaurerStock(tx *sqlx.Tx, commandeID, modifiePar string) error {
+    var lignes []models.CommandeProduit
+    err := tx.Select(&lignes, `
+        SELECT commande_id, produit_id, COALESCE(variante_id::text, '') AS variante_id,
+               COALESCE(sku, '') AS sku, COALESCE(emplacement_id::text, '') AS emplacement_id,
+               quantite, prix_unite
+        FROM commande_produits
+        WHERE commande_id = $1 AND (variante_id IS NOT NULL OR sku IS NULL)`,
+        commandeID)
+    if err != nil {
+        return fmt.Errorf("erreur lors de la lecture des produits de la commande: %v", err)
+    }
+
+    for _, ligne := range lignes {
+        prelevements, err := prelevementsVente(tx, commandeID, ligne)
+        if err != nil {
+            return err
+        }
+
+        for _, prelevement := range prelevements {
+            mouvement := models.MouvementStock{
+                ProduitID:     ligne.ProduitID,
+                VarianteID:    ligne.VarianteID,
+                EmplacementID: prelevement.EmplacementID,
+                Quantite:      prelevement.Quantite,
+                Raison:        models.RaisonAnnulation,
+                Reference:     commandeID,
+                CreePar:       modifiePar,
+            }
+            err := inventaire.AppliquerMouvement(tx, &mouvement)
+            if errors.Is(err, inventaire.ErrEmplacementInactif) {
+                // L'emplacement a été désactivé depuis la commande : le stock revient hors emplacement
+                mouvement.EmplacementID = ""
+                err = inventaire.AppliquerMouvement(tx, &mouvement)
+            }
+            if err != nil {
+                return fmt.Errorf("erreur lors de la remise en stock: %v", err)
+            }
+        }
+    }
+    return nil
+}
+
+// prelevementsVente retrouve dans le journal d'inventaire les emplacements d'où la vente a sorti la ligne.
+// Une commande antérieure au journal n'y figure pas : la ligne revient alors entière dans son emplacement.
+func prelevementsVente(tx *sqlx.Tx, commandeID string, ligne models.CommandeProduit) ([]inventaire.Prelevement, error) {
+    prelevements := []inventaire.Prelevement{}
+    err := tx.Select(&prelevements, `
+        SELECT COALESCE(emplacement_id::text, '') AS emplacement_id, -SUM(quantite) AS quantite
+        FROM inventory_movements
+        WHERE reference = $1 AND raison = $2 AND produit_id = $3
+          AND variante_id IS NOT DISTINCT FROM NULLIF($4, '')::uuid
+        GROUP BY emplacement_id
+        ORDER BY emplacement_id`,
+        commandeID, models.RaisonVente, ligne.ProduitID, ligne.VarianteID)
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors de la lecture des prélèvements de la commande: %v", err)
+    }
+    if len(prelevements) == 0 {
+        prelevements = append(prelevements, inventaire.Prelevement{EmplacementID: ligne.EmplacementID, Quantite: ligne.Quantite})
+    }
+    return prelevements, nil
+}
+
+// ListerHistoriqueCommande retourne la chronologie des statuts d'une commande.
+// Si userID est renseigné, la commande doit appartenir à cet utilisateur.
+func (r *Repository) ListerHistoriqueCommande(commandeID, userID string) ([]models.CommandeStatusHistorique, error) {
+    if _, err := uuid.Parse(commandeID); err != nil {
+        return nil, ErrCommandeIntrouvable
+    }
+
+    var proprietaire string
+    err := r.db.QueryRow(`SELECT user_id FROM commandes WHERE id = $1`, commandeID).Scan(&proprietaire)
+    if errors.Is(err, sql.ErrNoRows) || (err == nil && userID != "" && proprietaire != userID) {
+        return nil, ErrCommandeIntrouvable
+    } else if err != nil {
+        return nil, fmt.Errorf("erreur lors de la lecture de la commande: %v", err)
+    }
+
+    historique := []models.CommandeStatusHistorique{}
+    err = r.db.Select(&historique, `
+        SELECT id, commande_id, ancien_status, nouveau_status, modifie_par,
+               COALESCE(commentaire, '') AS commentaire, created_at
+        FROM commande_status_history
+        WHERE commande_id = $1
+        ORDER BY created_at ASC`, commandeID)
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors de la récupération de l'historique: %v", err)
+    }
+    return historique, nil
+}
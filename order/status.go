@@ -0,0 +1,40 @@
+package order
+
+import (
+    "ecommerce-api/models"
+    "errors"
+)
+
+var (
+    ErrCommandeIntrouvable = errors.New("commande introuvable")
+    ErrTransitionInvalide  = errors.New("transition de statut non autorisée")
+)
+
+// transitionsAutorisees décrit le cycle de vie d'une commande :
+// en_attente → payée → expédiée → livrée, avec annulée/remboursée comme sorties.
+var transitionsAutorisees = map[string][]string{
+    models.CommandeStatusEnAttente: {models.CommandeStatusPayee, models.CommandeStatusAnnulee},
+    models.CommandeStatusPayee:     {models.CommandeStatusExpediee, models.CommandeStatusAnnulee, models.CommandeStatusRemboursee},
+    models.CommandeStatusExpediee:  {models.CommandeStatusLivree, models.CommandeStatusAnnulee},
+    models.CommandeStatusLivree:    {models.CommandeStatusRemboursee},
+}
+
+// StatutValide indique si le statut fait partie du cycle de vie d'une commande.
+func StatutValide(status string) bool {
+    switch status {
+    case models.CommandeStatusEnAttente, models.CommandeStatusPayee, models.CommandeStatusExpediee,
+        models.CommandeStatusLivree, models.CommandeStatusAnnulee, models.CommandeStatusRemboursee:
+        return true
+    }
+    return false
+}
+
+// TransitionAutorisee indique si une commande peut passer de `actuel` à `nouveau`.
+func TransitionAutorisee(actuel, nouveau string) bool {
+    for _, s := range transitionsAutorisees[actuel] {
+        if s == nouveau {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,69 @@
+package order
+
+import (
+    "ecommerce-api/models"
+    "testing"
+)
+
+func TestTransitionAutorisee(t *testing.T) {
+    cas := []struct {
+        actuel, nouveau string
+        attendu         bool
+    }{
+        {models.CommandeStatusEnAttente, models.CommandeStatusPayee, true},
+        {models.CommandeStatusEnAttente, models.CommandeStatusAnnulee, true},
+        {models.CommandeStatusEnAttente, models.CommandeStatusExpediee, false},
+        {models.CommandeStatusEnAttente, models.CommandeStatusRemboursee, false},
+        {models.CommandeStatusPayee, models.CommandeStatusExpediee, true},
+        {models.CommandeStatusPayee, models.CommandeStatusAnnulee, true},
+        {models.CommandeStatusPayee, models.CommandeStatusRemboursee, true},
+        {models.CommandeStatusPayee, models.CommandeStatusEnAttente, false},
+        {models.CommandeStatusExpediee, models.CommandeStatusLivree, true},
+        {models.CommandeStatusExpediee, models.CommandeStatusAnnulee, true},
+        {models.CommandeStatusExpediee, models.CommandeStatusPayee, false},
+        {models.CommandeStatusLivree, models.CommandeStatusRemboursee, true},
+        {models.CommandeStatusLivree, models.CommandeStatusAnnulee, false},
+        // Statuts terminaux
+        {models.CommandeStatusAnnulee, models.CommandeStatusPayee, false},
+        {models.CommandeStatusRemboursee, models.CommandeStatusLivree, false},
+        // Pas de transition vers le même statut ni depuis un statut inconnu
+        {models.CommandeStatusPayee, models.CommandeStatusPayee, false},
+        {"inconnu", models.CommandeStatusPayee, false},
+        {models.CommandeStatusEnAttente, "inconnu", false},
+    }
+    for _, c := range cas {
+        if got := TransitionAutorisee(c.actuel, c.nouveau); got != c.attendu {
+            t.Errorf("TransitionAutorisee(%q, %q) = %v, attendu %v", c.actuel, c.nouveau, got, c.attendu)
+        }
+    }
+}
+
+func TestTransitionsVersStatutsValides(t *testing.T) {
+    for actuel, suivants := range transitionsAutorisees {
+        if !StatutValide(actuel) {
+            t.Errorf("statut de départ %q inconnu", actuel)
+        }
+        for _, s := range suivants {
+            if !StatutValide(s) {
+                t.Errorf("transition %q → %q vers un statut inconnu", actuel, s)
+            }
+        }
+    }
+}
+
+func TestStatutValide(t *testing.T) {
+    valides := []string{
+        models.CommandeStatusEnAttente, models.CommandeStatusPayee, models.CommandeStatusExpediee,
+        models.CommandeStatusLivree, models.CommandeStatusAnnulee, models.CommandeStatusRemboursee,
+    }
+    for _, s := range valides {
+        if !StatutValide(s) {
+            t.Errorf("StatutValide(%q) = false, attendu true", s)
+        }
+    }
+    for _, s := range []string{"", "inconnu", "PAYEE"} {
+        if StatutValide(s) {
+            t.Errorf("StatutValide(%q) = true, attendu false", s)
+        }
+    }
+}
@@ -2,18 +2,32 @@ package panier
 
 import (
     "ecommerce-api/googleauth" // Importer votre package googleauth
+    "ecommerce-api/inventaire"
+    "ecommerce-api/models"
+    "ecommerce-api/order"
+    "errors"
     "fmt"
+    "io"
+    "log"
     "net/http"
     "strings"
     "encoding/json"
 )
 
 type PanierHandler struct {
-    repo *Repository
+    repo           *Repository
+    commandeRepo   *order.Repository
+    inventaireRepo *inventaire.Repository
+    emailService   models.EmailService
 }
 
-func NewPanierHandler(repo *Repository) *PanierHandler {
-    return &PanierHandler{repo: repo}
+func NewPanierHandler(repo *Repository, commandeRepo *order.Repository, inventaireRepo *inventaire.Repository, emailService models.EmailService) *PanierHandler {
+    return &PanierHandler{
+        repo:           repo,
+        commandeRepo:   commandeRepo,
+        inventaireRepo: inventaireRepo,
+        emailService:   emailService,
+    }
 }
 
 // HandleAjouterProduit ajoute un produit au panier après validation du token JWT.
@@ -47,15 +61,24 @@ func (h *PanierHandler) HandleAjouterProduit(w http.ResponseWriter, r *http.Requ
 
     // Decode the product from the request body
     var req struct {
-        ProduitID string `json:"produit_id"`
+        ProduitID  string `json:"produit_id"`
+        VarianteID string `json:"variante_id"`
+        Quantite   int    `json:"quantite"`
     }
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ProduitID == "" {
         http.Error(w, "Invalid request format or missing ProduitID", http.StatusBadRequest)
         return
     }
+    if req.Quantite == 0 {
+        req.Quantite = 1
+    }
+    if req.Quantite < 0 {
+        http.Error(w, "La quantité doit être supérieure à 0", http.StatusBadRequest)
+        return
+    }
 
     // Add the product to the user's cart (using repository method)
-    if err := h.repo.AjouterProduitAuPanier(googleID, req.ProduitID); err != nil {
+    if err := h.repo.AjouterProduitAuPanier(googleID, req.ProduitID, req.VarianteID, req.Quantite); err != nil {
         http.Error(w, "Error adding product to cart", http.StatusInternalServerError)
         return
     }
@@ -133,7 +156,8 @@ func (h *PanierHandler) HandleEnleverDuPanier(w http.ResponseWriter, r *http.Req
 
     // Decode the request body to get the product ID to remove
     var req struct {
-        ProduitID string `json:"produit_id"`
+        ProduitID  string `json:"produit_id"`
+        VarianteID string `json:"variante_id"`
     }
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ProduitID == "" {
         http.Error(w, "Invalid request format or missing ProduitID", http.StatusBadRequest)
@@ -141,7 +165,7 @@ func (h *PanierHandler) HandleEnleverDuPanier(w http.ResponseWriter, r *http.Req
     }
 
     // Call the repository method to remove the product from the cart
-    if err := h.repo.EnleverDuPanier(googleID, req.ProduitID); err != nil {
+    if err := h.repo.EnleverDuPanier(googleID, req.ProduitID, req.VarianteID); err != nil {
         http.Error(w, "Error removing product from cart", http.StatusInternalServerError)
         return
     }
@@ -153,4 +177,191 @@ func (h *PanierHandler) HandleEnleverDuPanier(w http.ResponseWriter, r *http.Req
         "status":  "success",
         "message": "Product removed from cart",
     })
-}
\ No newline at end of file
+}
+
+// HandleModifierQuantite remplace la quantité d'un produit du panier.
+func (h *PanierHandler) HandleModifierQuantite(w http.ResponseWriter, r *http.Request) {
+    googleID, _, err := googleauth.ExtraireUtilisateur(r)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+
+    var req struct {
+        ProduitID  string `json:"produit_id"`
+        VarianteID string `json:"variante_id"`
+        Quantite   int    `json:"quantite"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ProduitID == "" {
+        http.Error(w, "Invalid request format or missing ProduitID", http.StatusBadRequest)
+        return
+    }
+    if req.Quantite <= 0 {
+        http.Error(w, "La quantité doit être supérieure à 0", http.StatusBadRequest)
+        return
+    }
+
+    if err := h.repo.ModifierQuantite(googleID, req.ProduitID, req.VarianteID, req.Quantite); err != nil {
+        http.Error(w, fmt.Sprintf("Erreur lors de la modification de la quantité : %v", err), http.StatusNotFound)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "status":  "success",
+        "message": "Quantité mise à jour",
+    })
+}
+
+// HandleDemarrerCheckout réserve le stock des produits du panier pendant inventaire.DureeReservation.
+// La réservation est consommée par HandleCheckout ou expire d'elle-même.
+func (h *PanierHandler) HandleDemarrerCheckout(w http.ResponseWriter, r *http.Request) {
+    googleID, _, err := googleauth.ExtraireUtilisateur(r)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+
+    panier, err := h.repo.ObtenirPanierParUserID(googleID)
+    if err != nil {
+        http.Error(w, fmt.Sprintf("Impossible de démarrer le checkout : %v", err), http.StatusBadRequest)
+        return
+    }
+
+    if !panier.Commandable {
+        w.Header().Set("Content-Type", "application/json")
+        w.WriteHeader(http.StatusConflict)
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "status":  "error",
+            "message": "Certains produits du panier ne peuvent pas être commandés",
+            "data":    panier,
+        })
+        return
+    }
+
+    lignes := make([]models.CommandeProduit, 0, len(panier.Lignes))
+    for _, ligne := range panier.Lignes {
+        lignes = append(lignes, models.CommandeProduit{
+            ProduitID:  ligne.ProduitID,
+            VarianteID: ligne.VarianteID,
+            Quantite:   ligne.Quantite,
+        })
+    }
+
+    reservations, err := h.inventaireRepo.Reserver(googleID, lignes, inventaire.DureeReservation)
+    if errors.Is(err, inventaire.ErrPanierVide) {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    if errors.Is(err, inventaire.ErrStockInsuffisant) {
+        http.Error(w, err.Error(), http.StatusConflict)
+        return
+    }
+    if err != nil {
+        http.Error(w, fmt.Sprintf("Erreur lors de la réservation du stock : %v", err), http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "status": "success",
+        "data": map[string]interface{}{
+            "panier":       panier,
+            "reservations": reservations,
+            "expire_le":    reservations[0].ExpireLe,
+        },
+    })
+}
+
+// HandleAbandonnerCheckout libère le stock réservé par l'utilisateur.
+func (h *PanierHandler) HandleAbandonnerCheckout(w http.ResponseWriter, r *http.Request) {
+    googleID, _, err := googleauth.ExtraireUtilisateur(r)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+
+    if err := h.inventaireRepo.LibererReservations(googleID); err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "status":  "success",
+        "message": "Réservations libérées",
+    })
+}
+
+// HandleCheckout transforme le panier en commande via order.Repository.CreerCommandeDepuisPanier,
+// qui vide le panier dans la même transaction.
+func (h *PanierHandler) HandleCheckout(w http.ResponseWriter, r *http.Request) {
+    googleID, email, err := googleauth.ExtraireUtilisateur(r)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+
+    // Corps facultatif : emplacement de retrait choisi ou position pour l'emplacement le plus proche
+    var req struct {
+        EmplacementID string           `json:"emplacement_id"`
+        Position      *models.Position `json:"position"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+        http.Error(w, "Format de requête invalide", http.StatusBadRequest)
+        return
+    }
+
+    panier, err := h.repo.ObtenirPanierParUserID(googleID)
+    if err != nil {
+        http.Error(w, fmt.Sprintf("Impossible de passer commande : %v", err), http.StatusBadRequest)
+        return
+    }
+
+    if !panier.Commandable {
+        w.Header().Set("Content-Type", "application/json")
+        w.WriteHeader(http.StatusConflict)
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "status":  "error",
+            "message": "Certains produits du panier ne peuvent pas être commandés",
+            "data":    panier,
+        })
+        return
+    }
+
+    produits := make([]*models.CommandeProduit, 0, len(panier.Lignes))
+    for _, ligne := range panier.Lignes {
+        produits = append(produits, &models.CommandeProduit{
+            ProduitID:     ligne.ProduitID,
+            VarianteID:    ligne.VarianteID,
+            EmplacementID: req.EmplacementID,
+            Quantite:      ligne.Quantite,
+        })
+    }
+
+    commande, err := h.commandeRepo.CreerCommandeDepuisPanier(googleID, produits, req.Position)
+    if err != nil {
+        http.Error(w, fmt.Sprintf("Erreur lors de la création de la commande: %v", err), http.StatusInternalServerError)
+        return
+    }
+
+    if email != "" {
+        if err := h.emailService.EnvoyerEmailConfirmationCommande(commande, email); err != nil {
+            log.Printf("Erreur lors de l'envoi de l'email pour la commande %s: %v", commande.NumeroCommande, err)
+        }
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "status":  "success",
+        "message": "Commande créée avec succès",
+        "data": map[string]interface{}{
+            "commande": commande,
+            "produits": commande.Produits,
+        },
+    })
+}
@@ -1,7 +1,9 @@
 package panier
 
 import (
+	"ecommerce-api/inventaire"
 	"ecommerce-api/models"
+	"encoding/json"
 	"fmt"
 	"log" // Le package log standard de Go
 
@@ -17,25 +19,92 @@ func NewRepository(db *sqlx.DB) *Repository {
     return &Repository{db: db}
 }
 
-func (r *Repository) AjouterProduitAuPanier(googleID, produitID string) error {
-    _, err := r.db.Exec(`
-        INSERT INTO panier (user_id, produit_id, created_at, updated_at)
-        VALUES ($1, $2, NOW(), NOW())
-        ON CONFLICT (user_id, produit_id) DO NOTHING`,
-        googleID, produitID)
+// AjouterProduitAuPanier ajoute un produit, ou une variante de ce produit si varianteID est renseigné.
+func (r *Repository) AjouterProduitAuPanier(googleID, produitID, varianteID string, quantite int) error {
+    if quantite <= 0 {
+        return fmt.Errorf("la quantité doit être supérieure à 0")
+    }
+
+    if varianteID == "" {
+        _, err := r.db.Exec(`
+            INSERT INTO panier (user_id, produit_id, quantite, created_at, updated_at)
+            VALUES ($1, $2, $3, NOW(), NOW())
+            ON CONFLICT (user_id, produit_id) WHERE variante_id IS NULL
+            DO UPDATE SET quantite = panier.quantite + EXCLUDED.quantite, updated_at = NOW()`,
+            googleID, produitID, quantite)
+        if err != nil {
+            return fmt.Errorf("impossible d'ajouter le produit au panier: %v", err)
+        }
+        return nil
+    }
+
+    // La variante doit appartenir au produit
+    result, err := r.db.Exec(`
+        INSERT INTO panier (user_id, produit_id, variante_id, quantite, created_at, updated_at)
+        SELECT $1, v.produit_id, v.id, $4, NOW(), NOW()
+        FROM produit_variantes v
+        WHERE v.id = $3 AND v.produit_id = $2
+        ON CONFLICT (user_id, variante_id) WHERE variante_id IS NOT NULL
+        DO UPDATE SET quantite = panier.quantite + EXCLUDED.quantite, updated_at = NOW()`,
+        googleID, produitID, varianteID, quantite)
     if err != nil {
         return fmt.Errorf("impossible d'ajouter le produit au panier: %v", err)
     }
+
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return err
+    }
+    if rowsAffected == 0 {
+        return fmt.Errorf("la variante %s n'existe pas pour le produit %s", varianteID, produitID)
+    }
     return nil
 }
 
+// ModifierQuantite remplace la quantité d'un produit (ou d'une variante) déjà présent dans le panier.
+func (r *Repository) ModifierQuantite(userID, produitID, varianteID string, quantite int) error {
+    if quantite <= 0 {
+        return fmt.Errorf("la quantité doit être supérieure à 0")
+    }
+
+    result, err := r.db.Exec(`
+        UPDATE panier
+        SET quantite = $1, updated_at = NOW()
+        WHERE user_id = $2 AND produit_id = $3
+          AND variante_id IS NOT DISTINCT FROM NULLIF($4, '')::uuid`,
+        quantite, userID, produitID, varianteID)
+    if err != nil {
+        return fmt.Errorf("impossible de modifier la quantité: %v", err)
+    }
 
-func (r *Repository) ObtenirPanierParUserID(userID string) ([]*models.ProduitSouhait, error) {
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return err
+    }
+    if rowsAffected == 0 {
+        return fmt.Errorf("no product found in cart")
+    }
+    return nil
+}
+
+
+func (r *Repository) ObtenirPanierParUserID(userID string) (*models.Panier, error) {
     rows, err := r.db.Queryx(`
-        SELECT pr.id, pr.nom, pr.prix, pr.marque, pr.photos
+        SELECT pr.id, COALESCE(v.id::text, ''), COALESCE(v.sku, ''), v.attributs,
+               pr.nom, COALESCE(v.prix, pr.prix), COALESCE(pr.marque, ''), pr.photos, p.quantite,
+               CASE WHEN v.id IS NULL THEN COALESCE(pr.stock, 0) ELSE v.stock END - (
+                   SELECT COALESCE(SUM(rs.quantite), 0)
+                   FROM reservations_stock rs
+                   WHERE rs.produit_id = pr.id AND rs.variante_id IS NOT DISTINCT FROM v.id
+                     AND rs.user_id <> p.user_id AND ` + inventaire.ConditionReservationActive + `
+               ),
+               COALESCE(pr.disponible, false) AND COALESCE(v.disponible, true),
+               v.id IS NULL AND EXISTS (SELECT 1 FROM produit_variantes pv WHERE pv.produit_id = pr.id)
         FROM panier p
         JOIN produits pr ON p.produit_id = pr.id
-        WHERE p.user_id = $1`, userID)
+        LEFT JOIN produit_variantes v ON v.id = p.variante_id
+        WHERE p.user_id = $1
+        ORDER BY p.created_at`, userID)
 
     if err != nil {
         log.Printf("Error executing query: %v", err)
@@ -43,41 +112,69 @@ func (r *Repository) ObtenirPanierParUserID(userID string) ([]*models.ProduitSou
     }
     defer rows.Close()
 
-    var produits []*models.ProduitSouhait
+    panier := &models.Panier{Lignes: []models.PanierLigne{}, Commandable: true}
     for rows.Next() {
-        var produit models.ProduitSouhait
+        var ligne models.PanierLigne
         var photos pq.StringArray // Déclare un tableau de chaînes pour les photos
+        var attributs []byte
+        var varianteManquante bool
 
         // Scan des colonnes
-        if err := rows.Scan(&produit.ID, &produit.Nom, &produit.Prix, &produit.Marque, &photos); err != nil {
+        if err := rows.Scan(&ligne.ProduitID, &ligne.VarianteID, &ligne.SKU, &attributs,
+            &ligne.Nom, &ligne.Prix, &ligne.Marque, &photos,
+            &ligne.Quantite, &ligne.Stock, &ligne.Disponible, &varianteManquante); err != nil {
             log.Printf("Error scanning row: %v", err)
             return nil, err
         }
+        if attributs != nil {
+            if err := json.Unmarshal(attributs, &ligne.Attributs); err != nil {
+                return nil, fmt.Errorf("attributs invalides pour la variante %s: %v", ligne.SKU, err)
+            }
+        }
 
         // Récupérer la première photo
         if len(photos) > 0 {
-            produit.Photo = photos[0] // Assigner la première photo à la structure
+            ligne.Photo = photos[0]
+        }
+
+        ligne.SousTotal = ligne.Prix * float64(ligne.Quantite)
+        switch {
+        case varianteManquante:
+            ligne.Avertissement = "Veuillez choisir une variante"
+        case !ligne.Disponible:
+            ligne.Avertissement = "Produit indisponible"
+        case ligne.Stock < ligne.Quantite:
+            ligne.Avertissement = fmt.Sprintf("Stock insuffisant (disponible: %d)", ligne.Stock)
+        }
+        if ligne.Avertissement != "" {
+            panier.Commandable = false
         }
 
-        produits = append(produits, &produit)
+        panier.NombreArticles += ligne.Quantite
+        panier.Total += ligne.SousTotal
+        panier.Lignes = append(panier.Lignes, ligne)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
     }
 
     // Vérification si aucun produit n'a été trouvé
-    if len(produits) == 0 {
+    if len(panier.Lignes) == 0 {
         return nil, fmt.Errorf("aucun produit trouvé dans le panier")
     }
 
-    return produits, nil
+    return panier, nil
 }
 
 
-func (r *Repository) EnleverDuPanier(userID, produitID string) error {
+func (r *Repository) EnleverDuPanier(userID, produitID, varianteID string) error {
     log.Printf("Attempting to remove product %s from cart of user %s", produitID, userID)
 
     result, err := r.db.Exec(`
         DELETE FROM panier
-        WHERE user_id = $1 AND produit_id = $2`,
-        userID, produitID)
+        WHERE user_id = $1 AND produit_id = $2
+          AND variante_id IS NOT DISTINCT FROM NULLIF($3, '')::uuid`,
+        userID, produitID, varianteID)
 
     if err != nil {
         log.Printf("Database error removing product: %v", err)
@@ -0,0 +1,38 @@
+package utils
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+    "strconv"
+    "strings"
+)
+
+// ErrVersionPerimee est retournée quand la ressource a été modifiée depuis la lecture du client.
+var ErrVersionPerimee = errors.New("la ressource a été modifiée entre-temps, rechargez-la avant de la modifier")
+
+// ETag construit l'en-tête ETag correspondant à la version d'une ressource.
+func ETag(version int) string {
+    return fmt.Sprintf(`"%d"`, version)
+}
+
+// VersionAttendue lit l'en-tête If-Match des écritures conditionnelles et retourne la version attendue.
+// « If-Match: * » retourne 0, ce qui désactive la vérification.
+// En cas d'en-tête absent (428) ou illisible (400), la réponse est écrite et ok vaut false.
+func VersionAttendue(w http.ResponseWriter, r *http.Request) (version int, ok bool) {
+    ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+    if ifMatch == "" {
+        http.Error(w, "En-tête If-Match requis : reprenez l'ETag retourné à la lecture de la ressource", http.StatusPreconditionRequired)
+        return 0, false
+    }
+    if ifMatch == "*" {
+        return 0, true
+    }
+
+    version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"`))
+    if err != nil || version <= 0 {
+        http.Error(w, "En-tête If-Match invalide", http.StatusBadRequest)
+        return 0, false
+    }
+    return version, true
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestETag(t *testing.T) {
+    if got := ETag(7); got != `"7"` {
+        t.Errorf(`ETag(7) = %s, attendu "7"`, got)
+    }
+}
+
+func TestVersionAttendue(t *testing.T) {
+    cas := []struct {
+        nom          string
+        ifMatch      string
+        absent       bool
+        version      int
+        ok           bool
+        statutErreur int
+    }{
+        {nom: "en-tête absent", absent: true, statutErreur: http.StatusPreconditionRequired},
+        {nom: "en-tête vide", ifMatch: "  ", statutErreur: http.StatusPreconditionRequired},
+        {nom: "joker", ifMatch: "*", version: 0, ok: true},
+        {nom: "ETag fort", ifMatch: `"3"`, version: 3, ok: true},
+        {nom: "ETag faible", ifMatch: `W/"12"`, version: 12, ok: true},
+        {nom: "sans guillemets", ifMatch: "5", version: 5, ok: true},
+        {nom: "aller-retour ETag", ifMatch: ETag(42), version: 42, ok: true},
+        {nom: "non numérique", ifMatch: `"abc"`, statutErreur: http.StatusBadRequest},
+        {nom: "version nulle", ifMatch: `"0"`, statutErreur: http.StatusBadRequest},
+        {nom: "version négative", ifMatch: `"-1"`, statutErreur: http.StatusBadRequest},
+    }
+    for _, c := range cas {
+        t.Run(c.nom, func(t *testing.T) {
+            r := httptest.NewRequest(http.MethodPut, "/", nil)
+            if !c.absent {
+                r.Header.Set("If-Match", c.ifMatch)
+            }
+            w := httptest.NewRecorder()
+
+            version, ok := VersionAttendue(w, r)
+            if ok != c.ok || version != c.version {
+                t.Fatalf("VersionAttendue = (%d, %v), attendu (%d, %v)", version, ok, c.version, c.ok)
+            }
+            if !c.ok && w.Code != c.statutErreur {
+                t.Errorf("statut %d, attendu %d", w.Code, c.statutErreur)
+            }
+            if c.ok && w.Body.Len() != 0 {
+                t.Errorf("aucune réponse ne doit être écrite, reçu %q", w.Body.String())
+            }
+        })
+    }
+}
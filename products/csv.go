@@ -0,0 +1,422 @@
+package products
+
+import (
+    "bufio"
+    "database/sql"
+    "ecommerce-api/models"
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+
+    "github.com/google/uuid"
+    "github.com/jmoiron/sqlx"
+    "github.com/lib/pq"
+)
+
+// colonnesCSV est l'en-tête produit par l'export et accepté par l'import.
+// Les photos sont séparées par des « | » ; les attributs sont un objet JSON.
+var colonnesCSV = []string{
+    "id", "sku", "nom", "prix", "stock", "etat", "marque", "modele",
+    "categorie", "localisation", "description", "photos", "seuil_stock_bas", "attributs",
+}
+
+// colonnesObligatoires doivent figurer dans l'en-tête de tout fichier importé.
+var colonnesObligatoires = []string{"nom", "prix", "etat", "categorie", "localisation"}
+
+// ligneImport est une ligne du CSV validée, prête à être écrite.
+type ligneImport struct {
+    numero  int
+    produit models.Product
+    stock   *int // nil : stock inchangé pour une mise à jour, 0 pour une création
+    seuil   *int
+    // nil (colonne vide ou absente) : attributs inchangés pour une mise à jour, aucun pour une création.
+    // Dans tous les cas, les valeurs retenues sont validées selon le schéma de la catégorie.
+    attributs map[string]interface{}
+}
+
+// ImporterCSV crée ou met à jour les produits décrits par le CSV, en une seule transaction.
+// Une ligne est rattachée à un produit existant par sa colonne id, sinon par sa colonne sku.
+// Si une ligne est en erreur ou en dry-run, rien n'est écrit et le rapport liste les erreurs par ligne.
+func (r *ProductRepository) ImporterCSV(source io.Reader, dryRun bool, importePar string) (*models.RapportImport, error) {
+    rapport := &models.RapportImport{DryRun: dryRun, Erreurs: []models.ErreurImport{}}
+
+    lecteur, err := nouveauLecteurCSV(source)
+    if err != nil {
+        return nil, err
+    }
+
+    entete, err := lecteur.Read()
+    if err != nil {
+        return nil, fmt.Errorf("fichier CSV vide ou illisible : %v", err)
+    }
+    index, err := indexerEntete(entete)
+    if err != nil {
+        return nil, err
+    }
+
+    categories, err := r.categoriesParNom()
+    if err != nil {
+        return nil, err
+    }
+
+    var lignes []ligneImport
+    for numero := 2; ; numero++ {
+        enregistrement, err := lecteur.Read()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            rapport.Erreurs = append(rapport.Erreurs, models.ErreurImport{Ligne: numero, Message: err.Error()})
+            continue
+        }
+        rapport.Lignes++
+
+        valeur := func(colonne string) string {
+            if i, ok := index[colonne]; ok && i < len(enregistrement) {
+                return strings.TrimSpace(restaurerCellule(enregistrement[i]))
+            }
+            return ""
+        }
+
+        ligne, erreurs := validerLigneCSV(numero, valeur, categories)
+        if len(erreurs) > 0 {
+            rapport.Erreurs = append(rapport.Erreurs, erreurs...)
+            continue
+        }
+        lignes = append(lignes, ligne)
+    }
+
+    tx, err := r.db.Beginx()
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors du début de la transaction : %v", err)
+    }
+    defer tx.Rollback()
+
+    // Chaque ligne est écrite sous un point de sauvegarde pour qu'une erreur SQL
+    // (SKU en double, etc.) soit rapportée sans interrompre la vérification des suivantes.
+    for _, ligne := range lignes {
+        if _, err := tx.Exec("SAVEPOINT ligne_import"); err != nil {
+            return nil, fmt.Errorf("erreur lors de l'import : %v", err)
+        }
+
+        cree, err := ecrireLigneImport(tx, ligne, importePar)
+        if err != nil {
+            rapport.Erreurs = append(rapport.Erreurs, models.ErreurImport{Ligne: ligne.numero, Message: err.Error()})
+            if _, err := tx.Exec("ROLLBACK TO SAVEPOINT ligne_import"); err != nil {
+                return nil, fmt.Errorf("erreur lors de l'import : %v", err)
+            }
+            continue
+        }
+        if _, err := tx.Exec("RELEASE SAVEPOINT ligne_import"); err != nil {
+            return nil, fmt.Errorf("erreur lors de l'import : %v", err)
+        }
+
+        if cree {
+            rapport.Crees++
+        } else {
+            rapport.MisAJour++
+        }
+    }
+
+    if dryRun || len(rapport.Erreurs) > 0 {
+        return rapport, nil
+    }
+
+    if err = tx.Commit(); err != nil {
+        return nil, fmt.Errorf("erreur lors de la validation de l'import : %v", err)
+    }
+    rapport.Applique = true
+    return rapport, nil
+}
+
+// nouveauLecteurCSV détecte le séparateur (« ; » pour les exports Excel français, « , » sinon).
+func nouveauLecteurCSV(source io.Reader) (*csv.Reader, error) {
+    tampon := bufio.NewReader(source)
+    premiereLigne, err := tampon.Peek(tampon.Size())
+    if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+        return nil, fmt.Errorf("lecture du fichier impossible : %v", err)
+    }
+    if i := strings.IndexByte(string(premiereLigne), '\n'); i >= 0 {
+        premiereLigne = premiereLigne[:i]
+    }
+
+    lecteur := csv.NewReader(tampon)
+    if strings.Count(string(premiereLigne), ";") > strings.Count(string(premiereLigne), ",") {
+        lecteur.Comma = ';'
+    }
+    lecteur.FieldsPerRecord = -1
+    lecteur.TrimLeadingSpace = true
+    return lecteur, nil
+}
+
+// debutsFormule sont les caractères par lesquels un tableur reconnaît une formule.
+const debutsFormule = "=+-@\t\r"
+
+// neutraliserFormule préfixe d'une apostrophe une cellule qu'un tableur interpréterait comme une formule.
+func neutraliserFormule(cellule string) string {
+    if cellule != "" && strings.ContainsRune(debutsFormule, rune(cellule[0])) {
+        return "'" + cellule
+    }
+    return cellule
+}
+
+// restaurerCellule retire l'apostrophe ajoutée par neutraliserFormule, pour qu'un export réimporté reste identique.
+func restaurerCellule(cellule string) string {
+    if len(cellule) > 1 && cellule[0] == '\'' && strings.ContainsRune(debutsFormule, rune(cellule[1])) {
+        return cellule[1:]
+    }
+    return cellule
+}
+
+// indexerEntete associe chaque colonne (en minuscules, BOM retiré) à sa position
+// et vérifie la présence des colonnes obligatoires.
+func indexerEntete(entete []string) (map[string]int, error) {
+    index := make(map[string]int)
+    for i, colonne := range entete {
+        index[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(colonne, "\ufeff")))] = i
+    }
+    for _, colonne := range colonnesObligatoires {
+        if _, ok := index[colonne]; !ok {
+            return nil, fmt.Errorf("colonne obligatoire absente de l'en-tête : %s", colonne)
+        }
+    }
+    return index, nil
+}
+
+// categorieAmbigue marque, dans categoriesParNom, un nom porté par plusieurs catégories.
+const categorieAmbigue = ""
+
+// categoriesParNom associe l'ID et le nom (en minuscules) de chaque catégorie à son ID.
+// Un nom porté par plusieurs catégories (ex. « Accessoires » sous deux parents) est associé à
+// categorieAmbigue : la ligne doit alors désigner la catégorie par son ID.
+func (r *ProductRepository) categoriesParNom() (map[string]string, error) {
+    rows, err := r.db.Query(`SELECT id, nom FROM categories`)
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors de la récupération des catégories : %v", err)
+    }
+    defer rows.Close()
+
+    categories := make(map[string]string)
+    for rows.Next() {
+        var id, nom string
+        if err := rows.Scan(&id, &nom); err != nil {
+            return nil, fmt.Errorf("erreur lors du scan des catégories : %v", err)
+        }
+        categories[id] = id
+        nom = strings.ToLower(strings.TrimSpace(nom))
+        if _, doublon := categories[nom]; doublon {
+            categories[nom] = categorieAmbigue
+        } else {
+            categories[nom] = id
+        }
+    }
+    return categories, rows.Err()
+}
+
+func validerLigneCSV(numero int, valeur func(string) string, categories map[string]string) (ligneImport, []models.ErreurImport) {
+    ligne := ligneImport{numero: numero}
+    var erreurs []models.ErreurImport
+    erreur := func(colonne, format string, args ...interface{}) {
+        erreurs = append(erreurs, models.ErreurImport{Ligne: numero, Colonne: colonne, Message: fmt.Sprintf(format, args...)})
+    }
+
+    p := &ligne.produit
+    p.ID = valeur("id")
+    p.SKU = valeur("sku")
+    p.Nom = valeur("nom")
+    p.Etat = valeur("etat")
+    p.Marque = valeur("marque")
+    p.Modele = valeur("modele")
+    p.Localisation = valeur("localisation")
+    p.Description = valeur("description")
+    p.Photos = []string{}
+    for _, photo := range strings.Split(valeur("photos"), "|") {
+        if photo = strings.TrimSpace(photo); photo != "" {
+            p.Photos = append(p.Photos, photo)
+        }
+    }
+
+    if p.ID != "" {
+        if _, err := uuid.Parse(p.ID); err != nil {
+            erreur("id", "identifiant invalide %q", p.ID)
+        }
+    }
+    if p.Nom == "" {
+        erreur("nom", "le nom est obligatoire")
+    }
+    if p.Localisation == "" {
+        erreur("localisation", "la localisation est obligatoire")
+    }
+
+    prix, err := strconv.ParseFloat(strings.Replace(valeur("prix"), ",", ".", 1), 64)
+    if err != nil || prix < 0 {
+        erreur("prix", "prix invalide %q", valeur("prix"))
+    }
+    p.Prix = prix
+
+    if !etatValide(p.Etat) {
+        erreur("etat", "état %q invalide (valeurs possibles : %s)", p.Etat, strings.Join(models.EtatsProduit, ", "))
+    }
+
+    categorieID, ok := categories[strings.ToLower(valeur("categorie"))]
+    if !ok {
+        erreur("categorie", "catégorie inconnue %q", valeur("categorie"))
+    } else if categorieID == categorieAmbigue {
+        erreur("categorie", "plusieurs catégories s'appellent %q, indiquez l'ID de la catégorie", valeur("categorie"))
+    }
+    p.CategorieID = categorieID
+
+    if v := valeur("stock"); v != "" {
+        stock, err := strconv.Atoi(v)
+        if err != nil || stock < 0 {
+            erreur("stock", "stock invalide %q", v)
+        }
+        ligne.stock = &stock
+    }
+    if v := valeur("seuil_stock_bas"); v != "" {
+        seuil, err := strconv.Atoi(v)
+        if err != nil || seuil < 0 {
+            erreur("seuil_stock_bas", "seuil invalide %q", v)
+        }
+        ligne.seuil = &seuil
+    }
+    if v := valeur("attributs"); v != "" {
+        if err := json.Unmarshal([]byte(v), &ligne.attributs); err != nil || ligne.attributs == nil {
+            erreur("attributs", "objet JSON attendu, par exemple {\"couleur\": \"noir\"}")
+        }
+    }
+
+    return ligne, erreurs
+}
+
+// ecrireLigneImport crée ou met à jour le produit de la ligne ; le stock passe par le journal d'inventaire.
+// Retourne true si le produit a été créé.
+func ecrireLigneImport(tx *sqlx.Tx, ligne ligneImport, importePar string) (bool, error) {
+    p := ligne.produit
+
+    // Rattacher la ligne à un produit existant, par id puis par SKU
+    var id string
+    var attributsActuels []byte
+    var err error
+    if p.ID != "" {
+        err = tx.QueryRow(`SELECT id, attributs FROM produits WHERE id = $1 FOR UPDATE`, p.ID).Scan(&id, &attributsActuels)
+        if err == sql.ErrNoRows {
+            return false, fmt.Errorf("aucun produit avec l'id %s", p.ID)
+        }
+    } else if p.SKU != "" {
+        err = tx.QueryRow(`SELECT id, attributs FROM produits WHERE sku = $1 FOR UPDATE`, p.SKU).Scan(&id, &attributsActuels)
+        if err == sql.ErrNoRows {
+            err = nil
+        }
+    }
+    if err != nil {
+        return false, fmt.Errorf("erreur lors de la recherche du produit : %v", err)
+    }
+
+    cree := id == ""
+
+    // Même validation que CreateProduct et UpdateProduct : les valeurs conservées sont
+    // revalidées, le produit ayant pu changer de catégorie
+    valeurs := ligne.attributs
+    if valeurs == nil && !cree {
+        if err := json.Unmarshal(attributsActuels, &valeurs); err != nil {
+            return false, fmt.Errorf("attributs invalides pour le produit %s : %v", id, err)
+        }
+    }
+    attributs, err := attributsValides(tx, p.CategorieID, valeurs)
+    if err != nil {
+        return false, err
+    }
+
+    if cree {
+        id = uuid.New().String()
+        seuil := seuilStockBasParDefaut
+        if ligne.seuil != nil {
+            seuil = *ligne.seuil
+        }
+        _, err = tx.Exec(`
+            INSERT INTO produits (
+                id, sku, nom, prix, stock, etat, photos, categorie_id, localisation,
+                description, marque, modele, seuil_stock_bas, disponible, attributs
+            ) VALUES ($1, NULLIF($2, ''), $3, $4, 0, $5, $6, $7, $8, $9, $10, $11, $12, true, $13)`,
+            id, p.SKU, p.Nom, p.Prix, p.Etat, pq.Array(p.Photos), p.CategorieID, p.Localisation,
+            p.Description, p.Marque, p.Modele, seuil, attributs)
+    } else {
+        _, err = tx.Exec(`
+            UPDATE produits
+            SET sku = COALESCE(NULLIF($2, ''), sku), nom = $3, prix = $4, etat = $5, photos = $6,
+                categorie_id = $7, localisation = $8, description = $9, marque = $10, modele = $11,
+                seuil_stock_bas = COALESCE($12, seuil_stock_bas), attributs = $13, updated_at = NOW(),
+                version = version + 1
+            WHERE id = $1`,
+            id, p.SKU, p.Nom, p.Prix, p.Etat, pq.Array(p.Photos), p.CategorieID, p.Localisation,
+            p.Description, p.Marque, p.Modele, ligne.seuil, attributs)
+    }
+    if err != nil {
+        return false, fmt.Errorf("erreur lors de l'enregistrement du produit : %v", err)
+    }
+
+    if ligne.stock != nil {
+        err := ajusterStockVers(tx, id, "", *ligne.stock, models.RaisonImport, "Import CSV", importePar)
+        if err != nil {
+            return false, err
+        }
+    }
+    return cree, nil
+}
+
+// ExporterCSV écrit au format d'import les produits correspondant aux filtres.
+func (r *ProductRepository) ExporterCSV(destination io.Writer, filters models.ProductFilters) error {
+    conditions, args := construireFiltres(filters, "")
+    rows, err := r.db.Query(`
+        SELECT p.id, COALESCE(p.sku, ''), p.nom, p.prix, p.stock, p.etat, COALESCE(p.marque, ''),
+               COALESCE(p.modele, ''), c.nom, p.localisation, COALESCE(p.description, ''),
+               p.photos, p.seuil_stock_bas, p.attributs
+        FROM produits p
+        JOIN categories c ON c.id = p.categorie_id
+        WHERE 1=1`+conditions+`
+        ORDER BY p.nom, p.id`, args...)
+    if err != nil {
+        return fmt.Errorf("erreur lors de l'export des produits : %v", err)
+    }
+    defer rows.Close()
+
+    ecrivain := csv.NewWriter(destination)
+    if err := ecrivain.Write(colonnesCSV); err != nil {
+        return err
+    }
+
+    for rows.Next() {
+        var id, sku, nom, etat, marque, modele, categorie, localisation, description string
+        var prix float64
+        var stock, seuil int
+        var photos []string
+        var attributs []byte
+        err := rows.Scan(&id, &sku, &nom, &prix, &stock, &etat, &marque, &modele,
+            &categorie, &localisation, &description, pq.Array(&photos), &seuil, &attributs)
+        if err != nil {
+            return fmt.Errorf("erreur lors du scan des produits : %v", err)
+        }
+
+        cellules := []string{
+            id, sku, nom, strconv.FormatFloat(prix, 'f', 2, 64), strconv.Itoa(stock), etat, marque, modele,
+            categorie, localisation, description, strings.Join(photos, "|"), strconv.Itoa(seuil), string(attributs),
+        }
+        for i := range cellules {
+            cellules[i] = neutraliserFormule(cellules[i])
+        }
+        err = ecrivain.Write(cellules)
+        if err != nil {
+            return err
+        }
+    }
+    if err := rows.Err(); err != nil {
+        return fmt.Errorf("erreur lors de l'itération sur les produits : %v", err)
+    }
+
+    ecrivain.Flush()
+    return ecrivain.Error()
+}
@@ -0,0 +1,162 @@
+package products
+
+import (
+    "reflect"
+    "sort"
+    "strings"
+    "testing"
+)
+
+const idCategorie = "6b8e2f0a-1c3d-4e5f-8a9b-0c1d2e3f4a5b"
+
+var categoriesTest = map[string]string{idCategorie: idCategorie, "smartphones": idCategorie, "accessoires": categorieAmbigue}
+
+// ligneCSV construit l'accès aux colonnes tel que le fait ImporterCSV.
+func ligneCSV(colonnes map[string]string) func(string) string {
+    return func(colonne string) string { return strings.TrimSpace(colonnes[colonne]) }
+}
+
+func ligneValide() map[string]string {
+    return map[string]string{
+        "sku": "IPH-13-128", "nom": "iPhone 13", "prix": "649,90", "stock": "4", "etat": "Reconditionné",
+        "marque": "Apple", "categorie": "Smartphones", "localisation": "Lyon",
+        "photos": "a.jpg | b.jpg||", "seuil_stock_bas": "2", "attributs": `{"couleur": "noir", "stockage": 128}`,
+    }
+}
+
+func TestValiderLigneCSV(t *testing.T) {
+    ligne, erreurs := validerLigneCSV(2, ligneCSV(ligneValide()), categoriesTest)
+    if len(erreurs) > 0 {
+        t.Fatalf("erreurs inattendues : %+v", erreurs)
+    }
+    p := ligne.produit
+    if p.Prix != 649.90 || p.CategorieID != idCategorie || p.SKU != "IPH-13-128" || p.Nom != "iPhone 13" {
+        t.Errorf("produit inattendu : %+v", p)
+    }
+    if !reflect.DeepEqual(p.Photos, []string{"a.jpg", "b.jpg"}) {
+        t.Errorf("photos %v, attendu [a.jpg b.jpg]", p.Photos)
+    }
+    if ligne.stock == nil || *ligne.stock != 4 || ligne.seuil == nil || *ligne.seuil != 2 {
+        t.Errorf("stock %v et seuil %v, attendu 4 et 2", ligne.stock, ligne.seuil)
+    }
+    if attendu := map[string]interface{}{"couleur": "noir", "stockage": 128.0}; !reflect.DeepEqual(ligne.attributs, attendu) {
+        t.Errorf("attributs %v, attendu %v", ligne.attributs, attendu)
+    }
+
+    // Stock, seuil et attributs absents : laissés inchangés lors d'une mise à jour
+    colonnes := ligneValide()
+    colonnes["stock"], colonnes["seuil_stock_bas"], colonnes["attributs"], colonnes["categorie"] = "", "", "", idCategorie
+    ligne, erreurs = validerLigneCSV(3, ligneCSV(colonnes), categoriesTest)
+    if len(erreurs) > 0 || ligne.stock != nil || ligne.seuil != nil || ligne.attributs != nil || ligne.produit.CategorieID != idCategorie {
+        t.Errorf("ligne %+v, erreurs %+v", ligne, erreurs)
+    }
+}
+
+func TestValiderLigneCSVErreurs(t *testing.T) {
+    cas := []struct {
+        colonne, valeur string
+    }{
+        {"id", "pas-un-uuid"},
+        {"nom", ""},
+        {"localisation", " "},
+        {"prix", "gratuit"},
+        {"prix", "-1"},
+        {"etat", "Neuf"},
+        {"categorie", "Tablettes"},
+        {"categorie", "Accessoires"},
+        {"stock", "-3"},
+        {"stock", "beaucoup"},
+        {"seuil_stock_bas", "1.5"},
+        {"attributs", "couleur=noir"},
+        {"attributs", "[1, 2]"},
+        {"attributs", "null"},
+    }
+    for _, c := range cas {
+        colonnes := ligneValide()
+        colonnes[c.colonne] = c.valeur
+        _, erreurs := validerLigneCSV(7, ligneCSV(colonnes), categoriesTest)
+        if len(erreurs) != 1 || erreurs[0].Colonne != c.colonne || erreurs[0].Ligne != 7 {
+            t.Errorf("%s = %q : erreurs %+v, attendu une erreur sur cette colonne en ligne 7", c.colonne, c.valeur, erreurs)
+        }
+    }
+
+    // Toutes les erreurs d'une ligne sont rapportées ensemble
+    _, erreurs := validerLigneCSV(2, ligneCSV(map[string]string{}), categoriesTest)
+    var colonnes []string
+    for _, e := range erreurs {
+        colonnes = append(colonnes, e.Colonne)
+    }
+    sort.Strings(colonnes)
+    if attendu := []string{"categorie", "etat", "localisation", "nom", "prix"}; !reflect.DeepEqual(colonnes, attendu) {
+        t.Errorf("colonnes en erreur %v, attendu %v", colonnes, attendu)
+    }
+}
+
+func TestIndexerEntete(t *testing.T) {
+    index, err := indexerEntete([]string{"\ufeffNom", " Prix ", "etat", "CATEGORIE", "localisation", "stock"})
+    if err != nil {
+        t.Fatalf("erreur inattendue : %v", err)
+    }
+    if index["nom"] != 0 || index["prix"] != 1 || index["categorie"] != 3 || index["stock"] != 5 {
+        t.Errorf("index inattendu : %v", index)
+    }
+
+    if _, err := indexerEntete([]string{"nom", "prix", "etat", "categorie"}); err == nil {
+        t.Error("erreur attendue pour la colonne localisation absente")
+    }
+}
+
+func TestNouveauLecteurCSV(t *testing.T) {
+    cas := []struct {
+        nom     string
+        contenu string
+        attendu []string
+    }{
+        {"virgules", "nom,prix\n\"iPhone 13, 128 Go\",649.90\n", []string{"iPhone 13, 128 Go", "649.90"}},
+        {"points-virgules", "nom;prix\niPhone 13;649,90\n", []string{"iPhone 13", "649,90"}},
+        {"champs manquants", "nom;prix;etat\niPhone 13\n", []string{"iPhone 13"}},
+    }
+    for _, c := range cas {
+        t.Run(c.nom, func(t *testing.T) {
+            lecteur, err := nouveauLecteurCSV(strings.NewReader(c.contenu))
+            if err != nil {
+                t.Fatalf("erreur inattendue : %v", err)
+            }
+            if _, err := lecteur.Read(); err != nil {
+                t.Fatalf("lecture de l'en-tête : %v", err)
+            }
+            enregistrement, err := lecteur.Read()
+            if err != nil {
+                t.Fatalf("lecture de la ligne : %v", err)
+            }
+            if !reflect.DeepEqual(enregistrement, c.attendu) {
+                t.Errorf("ligne %q, attendu %q", enregistrement, c.attendu)
+            }
+        })
+    }
+}
+
+func TestNeutraliserFormule(t *testing.T) {
+    cas := []struct {
+        cellule, exportee string
+    }{
+        {"=HYPERLINK(\"http://exemple.com\")", "'=HYPERLINK(\"http://exemple.com\")"},
+        {"+33 6 12 34 56 78", "'+33 6 12 34 56 78"},
+        {"-10%", "'-10%"},
+        {"@SUM(A1)", "'@SUM(A1)"},
+        {"\t=1+1", "'\t=1+1"},
+        {"iPhone 13", "iPhone 13"},
+        {"'déjà cité", "'déjà cité"},
+        {"649.90", "649.90"},
+        {"", ""},
+    }
+    for _, c := range cas {
+        exportee := neutraliserFormule(c.cellule)
+        if exportee != c.exportee {
+            t.Errorf("neutraliserFormule(%q) = %q, attendu %q", c.cellule, exportee, c.exportee)
+        }
+        if restauree := restaurerCellule(exportee); restauree != c.cellule {
+            t.Errorf("restaurerCellule(%q) = %q, attendu %q", exportee, restauree, c.cellule)
+        }
+    }
+}
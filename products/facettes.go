@@ -0,0 +1,170 @@
+package products
+
+import (
+    "ecommerce-api/models"
+    "fmt"
+
+    "github.com/lib/pq"
+)
+
+// bornesTranchesPrix découpe les prix en tranches : <50, 50-100, 100-250, 250-500, 500-1000, >=1000
+var bornesTranchesPrix = []float64{50, 100, 250, 500, 1000}
+
+// GetFacettes compte les produits par marque, état, localisation, catégorie et tranche de prix.
+// Chaque facette respecte tous les filtres actifs sauf le sien, pour que l'interface
+// puisse afficher les alternatives disponibles.
+func (r *ProductRepository) GetFacettes(filters models.ProductFilters) (*models.Facettes, error) {
+    facettes := &models.Facettes{}
+    var err error
+
+    if facettes.Marque, err = r.compterParColonne(filters, filtreMarque, "marque"); err != nil {
+        return nil, err
+    }
+    if facettes.Etat, err = r.compterParColonne(filters, filtreEtat, "etat"); err != nil {
+        return nil, err
+    }
+    if facettes.Localisation, err = r.compterParLocalisation(filters); err != nil {
+        return nil, err
+    }
+    if facettes.Categorie, err = r.compterParCategorie(filters); err != nil {
+        return nil, err
+    }
+    if facettes.Prix, err = r.compterParTranchePrix(filters); err != nil {
+        return nil, err
+    }
+
+    return facettes, nil
+}
+
+func (r *ProductRepository) compterParColonne(filters models.ProductFilters, filtre, colonne string) ([]models.FacetteValeur, error) {
+    conditions, args := construireFiltres(filters, filtre)
+    query := fmt.Sprintf(`
+        SELECT %[1]s, COUNT(*)
+        FROM produits p
+        WHERE %[1]s IS NOT NULL AND %[1]s <> ''`+conditions+`
+        GROUP BY %[1]s
+        ORDER BY COUNT(*) DESC, %[1]s`, colonne)
+
+    rows, err := r.db.Query(query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors du calcul de la facette %s : %v", colonne, err)
+    }
+    defer rows.Close()
+
+    valeurs := []models.FacetteValeur{}
+    for rows.Next() {
+        var v models.FacetteValeur
+        if err := rows.Scan(&v.Valeur, &v.Nombre); err != nil {
+            return nil, fmt.Errorf("erreur lors du scan de la facette %s : %v", colonne, err)
+        }
+        valeurs = append(valeurs, v)
+    }
+    return valeurs, rows.Err()
+}
+
+// compterParLocalisation compte chaque produit dans sa localisation et dans celles
+// des emplacements actifs où il a du stock, comme ConditionLocalisation.
+func (r *ProductRepository) compterParLocalisation(filters models.ProductFilters) ([]models.FacetteValeur, error) {
+    conditions, args := construireFiltres(filters, filtreLocalisation)
+    query := `
+        SELECT l.localisation, COUNT(DISTINCT p.id)
+        FROM produits p
+        CROSS JOIN LATERAL (
+            SELECT p.localisation
+            UNION
+            SELECT e.localisation
+            FROM stock_emplacements se
+            JOIN emplacements e ON e.id = se.emplacement_id AND e.actif
+            WHERE se.produit_id = p.id AND se.quantite > 0
+        ) l(localisation)
+        WHERE l.localisation IS NOT NULL AND l.localisation <> ''` + conditions + `
+        GROUP BY l.localisation
+        ORDER BY COUNT(DISTINCT p.id) DESC, l.localisation`
+
+    rows, err := r.db.Query(query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors du calcul de la facette localisation : %v", err)
+    }
+    defer rows.Close()
+
+    valeurs := []models.FacetteValeur{}
+    for rows.Next() {
+        var v models.FacetteValeur
+        if err := rows.Scan(&v.Valeur, &v.Nombre); err != nil {
+            return nil, fmt.Errorf("erreur lors du scan de la facette localisation : %v", err)
+        }
+        valeurs = append(valeurs, v)
+    }
+    return valeurs, rows.Err()
+}
+
+func (r *ProductRepository) compterParCategorie(filters models.ProductFilters) ([]models.FacetteValeur, error) {
+    conditions, args := construireFiltres(filters, filtreCategorie)
+    query := `
+        SELECT c.id, c.nom, COUNT(*)
+        FROM (SELECT categorie_id FROM produits p WHERE 1=1` + conditions + `) p
+        JOIN categories c ON c.id = p.categorie_id
+        GROUP BY c.id, c.nom
+        ORDER BY COUNT(*) DESC, c.nom`
+
+    rows, err := r.db.Query(query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors du calcul de la facette catégorie : %v", err)
+    }
+    defer rows.Close()
+
+    valeurs := []models.FacetteValeur{}
+    for rows.Next() {
+        var v models.FacetteValeur
+        if err := rows.Scan(&v.Valeur, &v.Libelle, &v.Nombre); err != nil {
+            return nil, fmt.Errorf("erreur lors du scan de la facette catégorie : %v", err)
+        }
+        valeurs = append(valeurs, v)
+    }
+    return valeurs, rows.Err()
+}
+
+func (r *ProductRepository) compterParTranchePrix(filters models.ProductFilters) ([]models.TranchePrix, error) {
+    conditions, args := construireFiltres(filters, filtrePrix)
+    args = append(args, pq.Array(bornesTranchesPrix))
+    query := fmt.Sprintf(`
+        SELECT width_bucket(prix, $%d::numeric[]) AS tranche, COUNT(*)
+        FROM produits p
+        WHERE 1=1`+conditions+`
+        GROUP BY tranche`, len(args))
+
+    rows, err := r.db.Query(query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors du calcul de la facette prix : %v", err)
+    }
+    defer rows.Close()
+
+    // width_bucket retourne 0 pour prix < 50, 1 pour [50, 100[, ... et len(bornes) au-delà
+    comptes := make([]int, len(bornesTranchesPrix)+1)
+    for rows.Next() {
+        var tranche, nombre int
+        if err := rows.Scan(&tranche, &nombre); err != nil {
+            return nil, fmt.Errorf("erreur lors du scan de la facette prix : %v", err)
+        }
+        if tranche >= 0 && tranche < len(comptes) {
+            comptes[tranche] = nombre
+        }
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    tranches := make([]models.TranchePrix, 0, len(comptes))
+    for i, nombre := range comptes {
+        tranche := models.TranchePrix{Nombre: nombre}
+        if i > 0 {
+            tranche.Min = bornesTranchesPrix[i-1]
+        }
+        if i < len(bornesTranchesPrix) {
+            max := bornesTranchesPrix[i]
+            tranche.Max = &max
+        }
+        tranches = append(tranches, tranche)
+    }
+    return tranches, nil
+}
@@ -2,33 +2,56 @@
 package products
 
 import (
+	"ecommerce-api/admin"
+	"ecommerce-api/categories"
+	"ecommerce-api/inventaire"
 	"ecommerce-api/models"
+	"ecommerce-api/pkg/utils"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 )
 
 type ProductHandler struct {
-    repo *ProductRepository
+    repo    *ProductRepository
+    tracker *ViewTracker
+    medias  models.NettoyeurMedias
 }
 
-func NewProductHandler(repo *ProductRepository) *ProductHandler {
-    return &ProductHandler{repo: repo}
+func NewProductHandler(repo *ProductRepository, tracker *ViewTracker, medias models.NettoyeurMedias) *ProductHandler {
+    return &ProductHandler{repo: repo, tracker: tracker, medias: medias}
 }
 
+// seuilStockBasParDefaut s'applique si la requête de création ne précise pas seuil_stock_bas.
+const seuilStockBasParDefaut = 5
+
 func (h *ProductHandler) HandleCreateProduct(w http.ResponseWriter, r *http.Request) {
-    var product models.Product
+    product := models.Product{SeuilStockBas: seuilStockBasParDefaut}
     if err := json.NewDecoder(r.Body).Decode(&product); err != nil {
         http.Error(w, "Requête invalide", http.StatusBadRequest)
         return
     }
     
-    if err := h.repo.CreateProduct(product); err != nil {
+    err := h.repo.CreateProduct(product, admin.AdminEmail(r))
+    if errors.Is(err, categories.ErrValeursAttributs) {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    if errors.Is(err, ErrSKUExistant) {
+        http.Error(w, err.Error(), http.StatusConflict)
+        return
+    }
+    if err != nil {
         http.Error(w, err.Error(), http.StatusInternalServerError)
         return
     }
@@ -41,7 +64,17 @@ func (h *ProductHandler) HandleCreateProduct(w http.ResponseWriter, r *http.Requ
 }
 
 func (h *ProductHandler) HandleGetAllProducts(w http.ResponseWriter, r *http.Request) {
-    products, err := h.repo.GetAllProducts()
+    opts, err := OptionsDepuisRequete(r.URL.Query())
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    products, err := h.repo.GetAllProducts(admin.EstAdmin(r), opts)
+    if errors.Is(err, ErrCurseurInvalide) {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
     if err != nil {
         http.Error(w, fmt.Sprintf("Échec de la récupération des produits : %v", err), http.StatusInternalServerError)
         return
@@ -64,16 +97,56 @@ func (h *ProductHandler) HandleGetProductByID(w http.ResponseWriter, r *http.Req
         return
     }
     
-    product, err := h.repo.GetProductByID(id)
+    product, err := h.repo.GetProductByID(id, admin.EstAdmin(r))
     if err != nil {
         http.Error(w, fmt.Sprintf("Produit non trouvé : %v", err), http.StatusNotFound)
         return
     }
+
+    h.tracker.Enregistrer(product.ID, identifiantVisiteur(r))
     
+    w.Header().Set("ETag", utils.ETag(product.Version))
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(product)
 }
 
+// HandleGetPlusVus retourne les produits les plus consultés.
+func (h *ProductHandler) HandleGetPlusVus(w http.ResponseWriter, r *http.Request) {
+    products, err := h.repo.GetPlusVus(limiteDepuisRequete(r, 10))
+    if err != nil {
+        http.Error(w, fmt.Sprintf("Échec de la récupération des produits : %v", err), http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(products)
+}
+
+// HandleGetTendances retourne les produits les plus consultés cette semaine.
+func (h *ProductHandler) HandleGetTendances(w http.ResponseWriter, r *http.Request) {
+    tendances, err := h.repo.GetTendances(limiteDepuisRequete(r, 10))
+    if err != nil {
+        http.Error(w, fmt.Sprintf("Échec de la récupération des tendances : %v", err), http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(tendances)
+}
+
+func limiteDepuisRequete(r *http.Request, defaut int) int {
+    limite, err := strconv.Atoi(r.URL.Query().Get("limit"))
+    if err != nil || limite <= 0 {
+        return defaut
+    }
+    if limite > limiteMax {
+        return limiteMax
+    }
+    return limite
+}
+
+// HandleUpdateProduct applique une modification partielle ; seuls les champs de models.ProductPatch sont acceptés.
+// L'en-tête If-Match doit reprendre l'ETag lu, pour ne pas écraser la modification d'un autre administrateur.
 func (h *ProductHandler) HandleUpdateProduct(w http.ResponseWriter, r *http.Request) {
     id := chi.URLParam(r, "id")
 
@@ -87,24 +160,45 @@ func (h *ProductHandler) HandleUpdateProduct(w http.ResponseWriter, r *http.Requ
         return
     }
 
-    // Décoder le JSON dans une map
-    updates := make(map[string]interface{})
-    if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
-        http.Error(w, "Requête invalide", http.StatusBadRequest)
+    versionAttendue, ok := utils.VersionAttendue(w, r)
+    if !ok {
         return
     }
 
-    if len(updates) == 0 {
-        http.Error(w, "Aucune donnée fournie pour la mise à jour", http.StatusBadRequest)
+    // Un champ inconnu ou non modifiable rejette toute la requête
+    var patch models.ProductPatch
+    decoder := json.NewDecoder(r.Body)
+    decoder.DisallowUnknownFields()
+    if err := decoder.Decode(&patch); err != nil {
+        http.Error(w, fmt.Sprintf("Requête invalide : %v", err), http.StatusBadRequest)
         return
     }
 
     // Mettre à jour le produit dans la base de données
-    if err := h.repo.UpdateProduct(id, updates); err != nil {
+    version, err := h.repo.UpdateProduct(id, patch, versionAttendue, admin.AdminEmail(r))
+    if errors.Is(err, ErrProduitIntrouvable) {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if errors.Is(err, utils.ErrVersionPerimee) {
+        http.Error(w, err.Error(), http.StatusPreconditionFailed)
+        return
+    }
+    if errors.Is(err, ErrSKUExistant) {
+        http.Error(w, err.Error(), http.StatusConflict)
+        return
+    }
+    if errors.Is(err, ErrModificationInvalide) || errors.Is(err, inventaire.ErrVarianteRequise) ||
+        errors.Is(err, categories.ErrValeursAttributs) {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    if err != nil {
         http.Error(w, fmt.Sprintf("Échec de la mise à jour : %v", err), http.StatusInternalServerError)
         return
     }
 
+    w.Header().Set("ETag", utils.ETag(version))
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(map[string]string{
         "message": "Produit mis à jour avec succès",
@@ -126,10 +220,16 @@ func (h *ProductHandler) HandleDeleteProduct(w http.ResponseWriter, r *http.Requ
         return
     }
     
-    if err := h.repo.DeleteProduct(id); err != nil {
+    photos, err := h.repo.DeleteProduct(id)
+    if err != nil {
         http.Error(w, fmt.Sprintf("Échec de la suppression : %v", err), http.StatusInternalServerError)
         return
     }
+
+    // Le produit est supprimé : un échec du nettoyage des images est seulement journalisé
+    if err := h.medias.SupprimerOrphelins(photos); err != nil {
+        log.Printf("Nettoyage des images du produit %s : %v", id, err)
+    }
     
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(map[string]string{
@@ -138,6 +238,229 @@ func (h *ProductHandler) HandleDeleteProduct(w http.ResponseWriter, r *http.Requ
     })
 }
 
+// tailleMaxImport limite la taille du fichier CSV accepté par HandleImportProducts.
+const tailleMaxImport = 10 << 20
+
+// HandleImportProducts importe un fichier CSV de produits, envoyé dans le champ multipart
+// « fichier » ou directement dans le corps. Avec ?dry_run=true, rien n'est écrit :
+// seul le rapport de validation est retourné.
+func (h *ProductHandler) HandleImportProducts(w http.ResponseWriter, r *http.Request) {
+    r.Body = http.MaxBytesReader(w, r.Body, tailleMaxImport)
+    dryRun := r.URL.Query().Get("dry_run") == "true"
+
+    var source io.Reader = r.Body
+    if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+        fichier, _, err := r.FormFile("fichier")
+        if err != nil {
+            http.Error(w, "Fichier CSV manquant (champ « fichier »)", http.StatusBadRequest)
+            return
+        }
+        defer fichier.Close()
+        source = fichier
+    }
+
+    rapport, err := h.repo.ImporterCSV(source, dryRun, admin.AdminEmail(r))
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    code, statut := statutImport(rapport)
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(code)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "status": statut,
+        "data":   rapport,
+    })
+}
+
+// statutImport retourne le code HTTP et le statut de la réponse d'un import : des lignes en erreur
+// font un échec, même en dry-run où le rapport reste renvoyé en 200.
+func statutImport(rapport *models.RapportImport) (int, string) {
+    code, statut := http.StatusOK, "success"
+    if len(rapport.Erreurs) > 0 {
+        statut = "error"
+    }
+    if !rapport.DryRun && !rapport.Applique {
+        code = http.StatusUnprocessableEntity
+    }
+    return code, statut
+}
+
+// HandleExportProducts exporte en CSV les produits correspondant aux filtres de /products/filter.
+func (h *ProductHandler) HandleExportProducts(w http.ResponseWriter, r *http.Request) {
+    filters := FiltresDepuisRequete(r.URL.Query())
+    filters.InclureInactives = true
+
+    w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+    w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="produits-%s.csv"`, time.Now().Format("20060102")))
+    if err := h.repo.ExporterCSV(w, filters); err != nil {
+        log.Printf("Export CSV des produits : %v", err)
+    }
+}
+
+// HandleDisponibilites retourne le stock du produit par emplacement,
+// du plus proche au plus éloigné si lat et lng sont fournis.
+func (h *ProductHandler) HandleDisponibilites(w http.ResponseWriter, r *http.Request) {
+    id := chi.URLParam(r, "id")
+    if _, err := uuid.Parse(id); err != nil {
+        http.Error(w, "Format d'ID invalide", http.StatusBadRequest)
+        return
+    }
+
+    var origine *models.Position
+    query := r.URL.Query()
+    if query.Get("lat") != "" || query.Get("lng") != "" {
+        lat, errLat := strconv.ParseFloat(query.Get("lat"), 64)
+        lng, errLng := strconv.ParseFloat(query.Get("lng"), 64)
+        if errLat != nil || errLng != nil {
+            http.Error(w, "lat et lng doivent être des nombres", http.StatusBadRequest)
+            return
+        }
+        origine = &models.Position{Latitude: lat, Longitude: lng}
+    }
+
+    disponibilites, err := h.repo.GetDisponibilites(id, origine)
+    if err != nil {
+        http.Error(w, fmt.Sprintf("Échec de la récupération des disponibilités : %v", err), http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(disponibilites)
+}
+
+// HandleListerVariantes retourne les variantes d'un produit.
+func (h *ProductHandler) HandleListerVariantes(w http.ResponseWriter, r *http.Request) {
+    id := chi.URLParam(r, "id")
+    if _, err := uuid.Parse(id); err != nil {
+        http.Error(w, "Format d'ID invalide", http.StatusBadRequest)
+        return
+    }
+
+    variantes, err := h.repo.ListerVariantes(id)
+    if err != nil {
+        http.Error(w, fmt.Sprintf("Échec de la récupération des variantes : %v", err), http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(variantes)
+}
+
+// varianteDepuisRequete décode une variante ; elle est disponible sauf mention contraire.
+func varianteDepuisRequete(r *http.Request) (models.Variante, error) {
+    var req struct {
+        SKU        string            `json:"sku"`
+        Attributs  map[string]string `json:"attributs"`
+        Prix       *float64          `json:"prix"`
+        Stock      int               `json:"stock"`
+        Disponible *bool             `json:"disponible"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        return models.Variante{}, err
+    }
+
+    variante := models.Variante{
+        SKU:        strings.TrimSpace(req.SKU),
+        Attributs:  req.Attributs,
+        Prix:       req.Prix,
+        Stock:      req.Stock,
+        Disponible: req.Disponible == nil || *req.Disponible,
+    }
+    return variante, nil
+}
+
+// HandleCreerVariante ajoute une variante au produit.
+func (h *ProductHandler) HandleCreerVariante(w http.ResponseWriter, r *http.Request) {
+    id := chi.URLParam(r, "id")
+    if _, err := uuid.Parse(id); err != nil {
+        http.Error(w, "Format d'ID invalide", http.StatusBadRequest)
+        return
+    }
+
+    variante, err := varianteDepuisRequete(r)
+    if err != nil {
+        http.Error(w, "Requête invalide", http.StatusBadRequest)
+        return
+    }
+
+    if _, err := h.repo.GetProductByID(id, true); err != nil {
+        http.Error(w, fmt.Sprintf("Produit non trouvé : %v", err), http.StatusNotFound)
+        return
+    }
+
+    creee, err := h.repo.CreerVariante(id, variante, admin.AdminEmail(r))
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "status": "success",
+        "data":   creee,
+    })
+}
+
+// HandleModifierVariante met à jour une variante.
+func (h *ProductHandler) HandleModifierVariante(w http.ResponseWriter, r *http.Request) {
+    id := chi.URLParam(r, "varianteID")
+    if _, err := uuid.Parse(id); err != nil {
+        http.Error(w, "Format d'ID invalide", http.StatusBadRequest)
+        return
+    }
+
+    variante, err := varianteDepuisRequete(r)
+    if err != nil {
+        http.Error(w, "Requête invalide", http.StatusBadRequest)
+        return
+    }
+
+    modifiee, err := h.repo.ModifierVariante(id, variante, admin.AdminEmail(r))
+    if errors.Is(err, ErrVarianteIntrouvable) {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "status": "success",
+        "data":   modifiee,
+    })
+}
+
+// HandleSupprimerVariante supprime une variante.
+func (h *ProductHandler) HandleSupprimerVariante(w http.ResponseWriter, r *http.Request) {
+    id := chi.URLParam(r, "varianteID")
+    if _, err := uuid.Parse(id); err != nil {
+        http.Error(w, "Format d'ID invalide", http.StatusBadRequest)
+        return
+    }
+
+    err := h.repo.SupprimerVariante(id)
+    if errors.Is(err, ErrVarianteIntrouvable) {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        http.Error(w, fmt.Sprintf("Échec de la suppression : %v", err), http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]string{
+        "message": "Variante supprimée avec succès",
+        "status":  "success",
+    })
+}
+
 func (h *ProductHandler) HandleGetProductsByCategory(w http.ResponseWriter, r *http.Request) {
     categoryID := chi.URLParam(r, "categoryID")
 
@@ -147,7 +470,20 @@ func (h *ProductHandler) HandleGetProductsByCategory(w http.ResponseWriter, r *h
         return
     }
 
-    products, err := h.repo.GetProductsByCategory(categoryID)
+    opts, err := OptionsDepuisRequete(r.URL.Query())
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    // ?descendants=true inclut les produits des sous-catégories
+    avecDescendants := r.URL.Query().Get("descendants") == "true"
+
+    products, err := h.repo.GetProductsByCategory(categoryID, avecDescendants, admin.EstAdmin(r), opts)
+    if errors.Is(err, ErrCurseurInvalide) {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
     if err != nil {
         http.Error(w, fmt.Sprintf("Erreur lors de la récupération des produits : %v", err), http.StatusInternalServerError)
         return
@@ -157,13 +493,11 @@ func (h *ProductHandler) HandleGetProductsByCategory(w http.ResponseWriter, r *h
     json.NewEncoder(w).Encode(products)
 }
 
-// products/handler.go
-func (h *ProductHandler) HandleFilterProducts(w http.ResponseWriter, r *http.Request) {
+// FiltresDepuisRequete construit les filtres produits à partir des paramètres de l'URL.
+// Elle est partagée par /products/filter et /search.
+func FiltresDepuisRequete(queryParams url.Values) models.ProductFilters {
     var filters models.ProductFilters
 
-    // Récupération des paramètres de l'URL
-    queryParams := r.URL.Query()
-    
     // Prix min/max
     if minPrice := queryParams.Get("prix_min"); minPrice != "" {
         if price, err := strconv.ParseFloat(minPrice, 64); err == nil {
@@ -203,15 +537,77 @@ func (h *ProductHandler) HandleFilterProducts(w http.ResponseWriter, r *http.Req
     // Terme de recherche
     filters.SearchTerm = queryParams.Get("search")
 
+    // Attributs de catégorie : attr.<code>=v1,v2, attr_min.<code>=n et attr_max.<code>=n
+    for cle, valeurs := range queryParams {
+        if len(valeurs) == 0 || valeurs[0] == "" {
+            continue
+        }
+        switch {
+        case strings.HasPrefix(cle, "attr."):
+            if filters.Attributs == nil {
+                filters.Attributs = make(map[string][]string)
+            }
+            filters.Attributs[strings.TrimPrefix(cle, "attr.")] = strings.Split(valeurs[0], ",")
+        case strings.HasPrefix(cle, "attr_min."), strings.HasPrefix(cle, "attr_max."):
+            borne, err := strconv.ParseFloat(valeurs[0], 64)
+            if err != nil {
+                continue
+            }
+            code := cle[len("attr_min."):]
+            if strings.HasPrefix(cle, "attr_min.") {
+                if filters.AttributsMin == nil {
+                    filters.AttributsMin = make(map[string]float64)
+                }
+                filters.AttributsMin[code] = borne
+            } else {
+                if filters.AttributsMax == nil {
+                    filters.AttributsMax = make(map[string]float64)
+                }
+                filters.AttributsMax[code] = borne
+            }
+        }
+    }
+
+    return filters
+}
+
+// products/handler.go
+func (h *ProductHandler) HandleFilterProducts(w http.ResponseWriter, r *http.Request) {
+    filters := FiltresDepuisRequete(r.URL.Query())
+    filters.InclureInactives = admin.EstAdmin(r)
+    opts, err := OptionsDepuisRequete(r.URL.Query())
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
     // Récupération des produits filtrés
-    products, err := h.repo.GetFilteredProducts(filters)
+    page, err := h.repo.GetFilteredProducts(filters, opts)
+    if errors.Is(err, ErrCurseurInvalide) {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
     if err != nil {
         http.Error(w, fmt.Sprintf("Erreur lors du filtrage des produits : %v", err), http.StatusInternalServerError)
         return
     }
 
+    // Compteurs par valeur de filtre pour la barre latérale
+    facettes, err := h.repo.GetFacettes(filters)
+    if err != nil {
+        http.Error(w, fmt.Sprintf("Erreur lors du calcul des facettes : %v", err), http.StatusInternalServerError)
+        return
+    }
+
     w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(products)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "produits":    page.Produits,
+        "facettes":    facettes,
+        "next_cursor": page.NextCursor,
+        "has_more":    page.HasMore,
+        "sort":        page.Tri,
+        "limit":       page.Limite,
+    })
 }
 
 
@@ -0,0 +1,65 @@
+package products
+
+import (
+    "ecommerce-api/models"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/go-chi/chi/v5"
+)
+
+// Un curseur invalide est rejeté avant toute requête : le dépôt n'a pas besoin de base.
+func TestCurseurInvalideRetourne400(t *testing.T) {
+    h := NewProductHandler(NewProductRepository(nil), nil, nil)
+    r := chi.NewRouter()
+    r.Get("/products/", h.HandleGetAllProducts)
+    r.Get("/products/filter", h.HandleFilterProducts)
+    r.Get("/products/by-category/{categoryID}", h.HandleGetProductsByCategory)
+
+    curseurs := map[string]string{
+        "illisible": "pas-un-curseur",
+        "autre tri": encodeurProduit(TriPrixAsc),
+    }
+    chemins := []string{
+        "/products/",
+        "/products/filter",
+        "/products/by-category/6b8e2f0a-1c3d-4e5f-8a9b-0c1d2e3f4a5b",
+        "/products/by-category/6b8e2f0a-1c3d-4e5f-8a9b-0c1d2e3f4a5b?descendants=true",
+    }
+    for nom, curseur := range curseurs {
+        for _, chemin := range chemins {
+            separateur := "?"
+            if strings.Contains(chemin, "?") {
+                separateur = "&"
+            }
+            req := httptest.NewRequest(http.MethodGet, chemin+separateur+"sort=prix_desc&cursor="+curseur, nil)
+            rec := httptest.NewRecorder()
+            r.ServeHTTP(rec, req)
+            if rec.Code != http.StatusBadRequest {
+                t.Errorf("%s %s : statut %d, attendu 400 (%s)", nom, chemin, rec.Code, rec.Body.String())
+            }
+        }
+    }
+}
+
+func TestStatutImport(t *testing.T) {
+    cas := []struct {
+        nom     string
+        rapport models.RapportImport
+        code    int
+        statut  string
+    }{
+        {"import appliqué", models.RapportImport{Applique: true}, http.StatusOK, "success"},
+        {"import refusé", models.RapportImport{Erreurs: []models.ErreurImport{{Ligne: 2, Message: "prix invalide"}}}, http.StatusUnprocessableEntity, "error"},
+        {"dry-run sans erreur", models.RapportImport{DryRun: true}, http.StatusOK, "success"},
+        {"dry-run avec erreurs", models.RapportImport{DryRun: true, Erreurs: []models.ErreurImport{{Ligne: 2, Message: "prix invalide"}}}, http.StatusOK, "error"},
+    }
+    for _, c := range cas {
+        code, statut := statutImport(&c.rapport)
+        if code != c.code || statut != c.statut {
+            t.Errorf("%s : %d %q, attendu %d %q", c.nom, code, statut, c.code, c.statut)
+        }
+    }
+}
@@ -0,0 +1,143 @@
+package products
+
+import (
+    "ecommerce-api/models"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/url"
+    "strconv"
+    "time"
+)
+
+const (
+    TriPrixAsc   = "prix_asc"
+    TriPrixDesc  = "prix_desc"
+    TriRecent    = "recent"
+    TriPopulaire = "populaire"
+
+    limiteParDefaut = 20
+    limiteMax       = 100
+)
+
+var ErrCurseurInvalide = errors.New("curseur invalide")
+
+// critereTri associe un tri à sa colonne SQL. L'id sert de départage pour un ordre stable.
+type critereTri struct {
+    expression string
+    typeSQL    string
+    desc       bool
+}
+
+var criteresTri = map[string]critereTri{
+    TriPrixAsc:   {expression: "p.prix", typeSQL: "numeric"},
+    TriPrixDesc:  {expression: "p.prix", typeSQL: "numeric", desc: true},
+    TriRecent:    {expression: "COALESCE(p.created_at, 'epoch'::timestamp)", typeSQL: "timestamp", desc: true},
+    TriPopulaire: {expression: "COALESCE(p.nombre_vues, 0)", typeSQL: "integer", desc: true},
+}
+
+// curseur contient la position du dernier produit renvoyé
+type curseur struct {
+    Tri    string `json:"t"`
+    Valeur string `json:"v"`
+    ID     string `json:"id"`
+}
+
+// OptionsDepuisRequete lit les paramètres sort, limit et cursor de l'URL.
+func OptionsDepuisRequete(queryParams url.Values) (models.ListingOptions, error) {
+    opts := models.ListingOptions{
+        Tri:     queryParams.Get("sort"),
+        Curseur: queryParams.Get("cursor"),
+    }
+    if opts.Tri == "" {
+        opts.Tri = TriRecent
+    }
+    if _, ok := criteresTri[opts.Tri]; !ok {
+        return opts, fmt.Errorf("tri inconnu %q (valeurs possibles : prix_asc, prix_desc, recent, populaire)", opts.Tri)
+    }
+
+    if limit := queryParams.Get("limit"); limit != "" {
+        l, err := strconv.Atoi(limit)
+        if err != nil || l <= 0 {
+            return opts, fmt.Errorf("limit doit être un entier positif")
+        }
+        opts.Limite = l
+    }
+    return opts, nil
+}
+
+func normaliserOptions(opts models.ListingOptions) models.ListingOptions {
+    if _, ok := criteresTri[opts.Tri]; !ok {
+        opts.Tri = TriRecent
+    }
+    if opts.Limite <= 0 {
+        opts.Limite = limiteParDefaut
+    }
+    if opts.Limite > limiteMax {
+        opts.Limite = limiteMax
+    }
+    return opts
+}
+
+func encoderCurseur(tri string, product models.Product) string {
+    c := curseur{Tri: tri, ID: product.ID}
+    switch tri {
+    case TriPrixAsc, TriPrixDesc:
+        c.Valeur = strconv.FormatFloat(product.Prix, 'f', -1, 64)
+    case TriPopulaire:
+        c.Valeur = strconv.Itoa(product.NombreVues)
+    default:
+        c.Valeur = product.CreatedAt.Format(time.RFC3339Nano)
+    }
+
+    data, _ := json.Marshal(c)
+    return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decoderCurseur(valeur, tri string) (*curseur, error) {
+    data, err := base64.RawURLEncoding.DecodeString(valeur)
+    if err != nil {
+        return nil, ErrCurseurInvalide
+    }
+    var c curseur
+    if err := json.Unmarshal(data, &c); err != nil || c.ID == "" {
+        return nil, ErrCurseurInvalide
+    }
+    if c.Tri != tri {
+        return nil, fmt.Errorf("%w : il a été créé pour le tri %q", ErrCurseurInvalide, c.Tri)
+    }
+    if tri == TriRecent {
+        // Le timestamp PostgreSQL est sans fuseau : on repasse la valeur sous cette forme
+        t, err := time.Parse(time.RFC3339Nano, c.Valeur)
+        if err != nil {
+            return nil, ErrCurseurInvalide
+        }
+        c.Valeur = t.Format("2006-01-02 15:04:05.999999")
+    }
+    return &c, nil
+}
+
+// paginer ajoute à la requête la condition du curseur, l'ordre et la limite.
+// Une ligne de plus que la limite est demandée pour savoir s'il existe une page suivante.
+func paginer(query string, args []interface{}, opts models.ListingOptions) (string, []interface{}, error) {
+    critere := criteresTri[opts.Tri]
+    comparaison, direction := ">", "ASC"
+    if critere.desc {
+        comparaison, direction = "<", "DESC"
+    }
+
+    if opts.Curseur != "" {
+        c, err := decoderCurseur(opts.Curseur, opts.Tri)
+        if err != nil {
+            return "", nil, err
+        }
+        args = append(args, c.Valeur, c.ID)
+        query += fmt.Sprintf(" AND (%s, p.id) %s ($%d::%s, $%d::uuid)",
+            critere.expression, comparaison, len(args)-1, critere.typeSQL, len(args))
+    }
+
+    args = append(args, opts.Limite+1)
+    query += fmt.Sprintf(" ORDER BY %s %s, p.id %s LIMIT $%d", critere.expression, direction, direction, len(args))
+    return query, args, nil
+}
@@ -0,0 +1,136 @@
+package products
+
+import (
+    "ecommerce-api/models"
+    "encoding/base64"
+    "errors"
+    "net/url"
+    "strings"
+    "testing"
+    "time"
+)
+
+const idProduit = "3f1c2a9e-6a2b-4f59-9d1e-2a7b0c4d5e6f"
+
+func TestCurseurAllerRetour(t *testing.T) {
+    produit := models.Product{
+        ID:         idProduit,
+        Prix:       1299.99,
+        NombreVues: 42,
+        CreatedAt:  time.Date(2024, 3, 5, 14, 7, 9, 123456000, time.UTC),
+    }
+    cas := []struct {
+        tri    string
+        valeur string
+    }{
+        {TriPrixAsc, "1299.99"},
+        {TriPrixDesc, "1299.99"},
+        {TriPopulaire, "42"},
+        // Repassé au format timestamp sans fuseau de PostgreSQL
+        {TriRecent, "2024-03-05 14:07:09.123456"},
+    }
+    for _, c := range cas {
+        t.Run(c.tri, func(t *testing.T) {
+            curseur, err := decoderCurseur(encoderCurseur(c.tri, produit), c.tri)
+            if err != nil {
+                t.Fatalf("erreur inattendue : %v", err)
+            }
+            if curseur.ID != idProduit || curseur.Tri != c.tri || curseur.Valeur != c.valeur {
+                t.Errorf("curseur %+v, attendu {Tri:%s Valeur:%s ID:%s}", *curseur, c.tri, c.valeur, idProduit)
+            }
+        })
+    }
+}
+
+func TestDecoderCurseurInvalide(t *testing.T) {
+    encoder := func(json string) string { return base64.RawURLEncoding.EncodeToString([]byte(json)) }
+    cas := []struct {
+        nom    string
+        valeur string
+        tri    string
+    }{
+        {"base64 illisible", "%%%", TriRecent},
+        {"json illisible", encoder("pas du json"), TriRecent},
+        {"sans id", encoder(`{"t":"prix_asc","v":"10"}`), TriPrixAsc},
+        {"autre tri", encodeurProduit(TriPrixAsc), TriPrixDesc},
+        {"date illisible", encoder(`{"t":"recent","v":"hier","id":"` + idProduit + `"}`), TriRecent},
+    }
+    for _, c := range cas {
+        t.Run(c.nom, func(t *testing.T) {
+            if _, err := decoderCurseur(c.valeur, c.tri); !errors.Is(err, ErrCurseurInvalide) {
+                t.Errorf("erreur %v, attendu ErrCurseurInvalide", err)
+            }
+        })
+    }
+}
+
+func encodeurProduit(tri string) string {
+    return encoderCurseur(tri, models.Product{ID: idProduit, Prix: 10})
+}
+
+func TestOptionsDepuisRequete(t *testing.T) {
+    cas := []struct {
+        query  string
+        tri    string
+        limite int
+        erreur bool
+    }{
+        {query: "", tri: TriRecent},
+        {query: "sort=prix_desc&limit=5", tri: TriPrixDesc, limite: 5},
+        {query: "sort=populaire&cursor=abc", tri: TriPopulaire},
+        {query: "sort=alphabetique", erreur: true},
+        {query: "limit=0", erreur: true},
+        {query: "limit=dix", erreur: true},
+    }
+    for _, c := range cas {
+        params, _ := url.ParseQuery(c.query)
+        opts, err := OptionsDepuisRequete(params)
+        if c.erreur {
+            if err == nil {
+                t.Errorf("%q : erreur attendue", c.query)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("%q : erreur inattendue : %v", c.query, err)
+            continue
+        }
+        if opts.Tri != c.tri || opts.Limite != c.limite {
+            t.Errorf("%q : options %+v, attendu tri %s et limite %d", c.query, opts, c.tri, c.limite)
+        }
+    }
+}
+
+func TestNormaliserOptions(t *testing.T) {
+    opts := normaliserOptions(models.ListingOptions{Tri: "inconnu"})
+    if opts.Tri != TriRecent || opts.Limite != limiteParDefaut {
+        t.Errorf("options %+v, attendu tri %s et limite %d", opts, TriRecent, limiteParDefaut)
+    }
+    if opts := normaliserOptions(models.ListingOptions{Tri: TriPrixAsc, Limite: 1000}); opts.Limite != limiteMax {
+        t.Errorf("limite %d, attendu %d", opts.Limite, limiteMax)
+    }
+}
+
+func TestPaginer(t *testing.T) {
+    query, args, err := paginer("SELECT 1 FROM produits p WHERE true", []interface{}{"x"},
+        models.ListingOptions{Tri: TriPrixDesc, Limite: 20, Curseur: encodeurProduit(TriPrixDesc)})
+    if err != nil {
+        t.Fatalf("erreur inattendue : %v", err)
+    }
+    attendue := " AND (p.prix, p.id) < ($2::numeric, $3::uuid) ORDER BY p.prix DESC, p.id DESC LIMIT $4"
+    if !strings.HasSuffix(query, attendue) {
+        t.Errorf("requête %q, attendu le suffixe %q", query, attendue)
+    }
+    if len(args) != 4 || args[1] != "10" || args[2] != idProduit || args[3] != 21 {
+        t.Errorf("arguments %v, attendu [x 10 %s 21]", args, idProduit)
+    }
+
+    query, _, err = paginer("SELECT 1 FROM produits p WHERE true", nil, models.ListingOptions{Tri: TriPrixAsc, Limite: 5})
+    if err != nil || !strings.HasSuffix(query, " ORDER BY p.prix ASC, p.id ASC LIMIT $1") {
+        t.Errorf("requête %q (erreur %v) sans curseur inattendue", query, err)
+    }
+
+    if _, _, err := paginer("", nil, models.ListingOptions{Tri: TriPrixAsc, Curseur: encodeurProduit(TriPrixDesc)}); !errors.Is(err, ErrCurseurInvalide) {
+        t.Errorf("erreur %v, attendu ErrCurseurInvalide pour un curseur d'un autre tri", err)
+    }
+}
@@ -3,8 +3,15 @@ package products
 
 import (
     "database/sql"
+    "encoding/json"
+    "ecommerce-api/categories"
+    "ecommerce-api/inventaire"
     "ecommerce-api/models"
+    "ecommerce-api/pkg/utils"
+    "errors"
     "fmt"
+    "sort"
+    "strings"
     "time"
 
     "github.com/google/uuid"
@@ -12,6 +19,18 @@ import (
     "github.com/lib/pq"
 )
 
+var (
+    ErrProduitIntrouvable   = errors.New("produit introuvable")
+    ErrModificationInvalide = errors.New("modification invalide")
+    ErrSKUExistant          = errors.New("ce SKU est déjà utilisé par un autre produit")
+)
+
+// estDoublonSKU indique si err est la violation de l'unicité du SKU des produits.
+func estDoublonSKU(err error) bool {
+    var erreurPq *pq.Error
+    return errors.As(err, &erreurPq) && erreurPq.Code == "23505" && erreurPq.Constraint == "produits_sku_key"
+}
+
 type ProductRepository struct {
     db *sqlx.DB
 }
@@ -20,41 +39,94 @@ func NewProductRepository(db *sqlx.DB) *ProductRepository {
     return &ProductRepository{db: db}
 }
 
-func (r *ProductRepository) CreateProduct(product models.Product) error {
+// CreateProduct insère le produit avec un stock nul puis inscrit le stock initial au journal d'inventaire.
+func (r *ProductRepository) CreateProduct(product models.Product, creePar string) error {
     query := `
         INSERT INTO produits (
             id, nom, prix, stock, etat, photos, categorie_id,
             localisation, description, nombre_vues, disponible,
-            marque, modele, created_at, updated_at
+            marque, modele, created_at, updated_at, seuil_stock_bas, sku, attributs
         ) VALUES (
-            $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15
+            $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, NULLIF($17, ''), $18
         ) RETURNING id`
     
     id := uuid.New().String()
     now := time.Now()
+
+    tx, err := r.db.Beginx()
+    if err != nil {
+        return fmt.Errorf("erreur lors du début de la transaction : %v", err)
+    }
+    defer tx.Rollback()
+
+    attributs, err := attributsValides(tx, product.CategorieID, product.Attributs)
+    if err != nil {
+        return err
+    }
     
-    _, err := r.db.Exec(
+    _, err = tx.Exec(
         query,
-        id, product.Nom, product.Prix, product.Stock,
+        id, product.Nom, product.Prix, 0,
         product.Etat, pq.Array(product.Photos), product.CategorieID,
         product.Localisation, product.Description, 0, true,
-        product.Marque, product.Modele, now, now,
+        product.Marque, product.Modele, now, now, product.SeuilStockBas, product.SKU, attributs,
     )
     
+    if estDoublonSKU(err) {
+        return ErrSKUExistant
+    }
     if err != nil {
         return fmt.Errorf("erreur lors de la création du produit : %v", err)
     }
+
+    if product.Stock != 0 {
+        err = inventaire.AppliquerMouvement(tx, &models.MouvementStock{
+            ProduitID:   id,
+            Quantite:    product.Stock,
+            Raison:      models.RaisonAjustement,
+            Commentaire: "Stock initial",
+            CreePar:     creePar,
+        })
+        if err != nil {
+            return fmt.Errorf("erreur lors de l'enregistrement du stock initial : %w", err)
+        }
+    }
+
+    if err = tx.Commit(); err != nil {
+        return fmt.Errorf("erreur lors de la validation de la transaction : %v", err)
+    }
     return nil
 }
 
-func (r *ProductRepository) GetAllProducts() ([]models.Product, error) {
-    var products []models.Product
-    query := `
+// attributsValides valide les valeurs d'attributs selon le schéma de la catégorie
+// et les retourne encodées pour la colonne JSONB produits.attributs.
+func attributsValides(tx *sqlx.Tx, categorieID string, valeurs map[string]interface{}) ([]byte, error) {
+    schema, err := categories.AttributsApplicables(tx, categorieID)
+    if err != nil {
+        return nil, err
+    }
+    normalisees, err := categories.ValiderAttributs(schema, valeurs)
+    if err != nil {
+        return nil, err
+    }
+    return json.Marshal(normalisees)
+}
+
+// stockDisponible retranche du stock du produit (alias p) les réservations de checkout encore actives.
+const stockDisponible = `GREATEST(p.stock - (
+                SELECT COALESCE(SUM(rs.quantite), 0) FROM reservations_stock rs
+                WHERE rs.produit_id = p.id AND ` + inventaire.ConditionReservationActive + `), 0)`
+
+// selectProduits sélectionne les colonnes lues par scannerProduits, avec le nom de la catégorie.
+const selectProduits = `
         SELECT
             p.id,
             p.nom,
             p.prix,
             p.stock,
+            ` + stockDisponible + `,
+            p.seuil_stock_bas,
+            COALESCE(p.sku, ''),
             p.etat,
             p.photos,
             p.categorie_id,
@@ -65,322 +137,657 @@ func (r *ProductRepository) GetAllProducts() ([]models.Product, error) {
             p.disponible,
             p.marque,
             p.modele,
+            p.attributs,
             p.created_at,
-            p.updated_at
+            p.updated_at,
+            p.version
         FROM
             produits p
         JOIN
             categories c
         ON
             p.categorie_id = c.id
-    `
+        WHERE 1=1`
 
-    rows, err := r.db.Query(query)
-    if err != nil {
-        return nil, fmt.Errorf("erreur lors de la récupération des produits : %v", err)
+// destinationsProduit liste où scanner chaque colonne de selectProduits, dans le même ordre.
+func destinationsProduit(product *models.Product, photos *[]string, attributs *[]byte) []interface{} {
+    return []interface{}{
+        &product.ID, &product.Nom, &product.Prix, &product.Stock, &product.StockDisponible,
+        &product.SeuilStockBas, &product.SKU, &product.Etat, pq.Array(photos), &product.CategorieID,
+        &product.CategorieNom, // Récupérer le nom de la catégorie
+        &product.Localisation, &product.Description, &product.NombreVues,
+        &product.Disponible, &product.Marque, &product.Modele, attributs,
+        &product.CreatedAt, &product.UpdatedAt, &product.Version,
     }
-    defer rows.Close()
+}
 
-    for rows.Next() {
-        var product models.Product
-        var photos []string
-        var categorieNom string
+// scannerProduit lit une ligne de selectProduits (sql.Row ou sql.Rows).
+func scannerProduit(ligne interface{ Scan(...interface{}) error }) (*models.Product, error) {
+    var product models.Product
+    var photos []string
+    var attributs []byte
 
-        err := rows.Scan(
-            &product.ID, &product.Nom, &product.Prix, &product.Stock,
-            &product.Etat, pq.Array(&photos), &product.CategorieID,
-            &categorieNom, // Récupérer le nom de la catégorie
-            &product.Localisation, &product.Description, &product.NombreVues,
-            &product.Disponible, &product.Marque, &product.Modele,
-            &product.CreatedAt, &product.UpdatedAt,
-        )
+    if err := ligne.Scan(destinationsProduit(&product, &photos, &attributs)...); err != nil {
+        if err == sql.ErrNoRows {
+            return nil, err
+        }
+        return nil, fmt.Errorf("erreur lors du scan des produits : %v", err)
+    }
+    if err := json.Unmarshal(attributs, &product.Attributs); err != nil {
+        return nil, fmt.Errorf("attributs invalides pour le produit %s : %v", product.ID, err)
+    }
+    product.Photos = photos
+    return &product, nil
+}
+
+func scannerProduits(rows *sql.Rows) ([]models.Product, error) {
+    products := []models.Product{}
+    for rows.Next() {
+        product, err := scannerProduit(rows)
         if err != nil {
-            return nil, fmt.Errorf("erreur lors du scan des produits : %v", err)
+            return nil, err
         }
-        product.Photos = photos
-        product.CategorieNom = categorieNom // Stocker le nom de la catégorie dans le produit
-        products = append(products, product)
+        products = append(products, *product)
     }
 
+    // Vérifier les erreurs de la boucle rows.Next()
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("erreur lors de l'itération sur les résultats des produits : %v", err)
+    }
     return products, nil
 }
 
+// listerProduits exécute une liste de produits triée et paginée par curseur.
+func (r *ProductRepository) listerProduits(conditions string, args []interface{}, opts models.ListingOptions) (*models.ProductPage, error) {
+    opts = normaliserOptions(opts)
 
+    query, args, err := paginer(selectProduits+conditions, args, opts)
+    if err != nil {
+        return nil, err
+    }
 
-func (r *ProductRepository) GetProductByID(id string) (*models.Product, error) {
-    query := `
-        SELECT
-            p.id,
-            p.nom,
-            p.prix,
-            p.stock,
-            p.etat,
-            p.photos,
-            p.categorie_id,
-            c.nom AS categorie_nom,  -- Récupérer le nom de la catégorie
-            p.localisation,
-            p.description,
-            p.nombre_vues,
-            p.disponible,
-            p.marque,
-            p.modele,
-            p.created_at,
-            p.updated_at
-        FROM
-            produits p
-        JOIN
-            categories c
-        ON
-            p.categorie_id = c.id
-        WHERE
-            p.id = $1
-    `
+    rows, err := r.db.Query(query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors de la récupération des produits : %v", err)
+    }
+    defer rows.Close()
 
-    var product models.Product
-    var photos []string
-    var categorieNom string
+    products, err := scannerProduits(rows)
+    if err != nil {
+        return nil, err
+    }
 
-    row := r.db.QueryRow(query, id)
-    err := row.Scan(
-        &product.ID, &product.Nom, &product.Prix, &product.Stock,
-        &product.Etat, pq.Array(&photos), &product.CategorieID,
-        &categorieNom, // Récupérer le nom de la catégorie
-        &product.Localisation, &product.Description, &product.NombreVues,
-        &product.Disponible, &product.Marque, &product.Modele,
-        &product.CreatedAt, &product.UpdatedAt,
-    )
+    page := &models.ProductPage{Produits: products, Tri: opts.Tri, Limite: opts.Limite}
+    if len(products) > opts.Limite {
+        page.Produits = products[:opts.Limite]
+        page.HasMore = true
+        page.NextCursor = encoderCurseur(opts.Tri, page.Produits[opts.Limite-1])
+    }
+    return page, nil
+}
+
+// GetAllProducts liste les produits des catégories visibles, ou de toutes si inclureInactives.
+func (r *ProductRepository) GetAllProducts(inclureInactives bool, opts models.ListingOptions) (*models.ProductPage, error) {
+    conditions, args := construireFiltres(models.ProductFilters{InclureInactives: inclureInactives}, "")
+    return r.listerProduits(conditions, args, opts)
+}
+
+// GetPlusVus retourne les produits les plus consultés depuis leur création.
+func (r *ProductRepository) GetPlusVus(limite int) ([]models.Product, error) {
+    conditions, args := construireFiltres(models.ProductFilters{}, "")
+    page, err := r.listerProduits(conditions, args, models.ListingOptions{Tri: TriPopulaire, Limite: limite})
     if err != nil {
-        if err == sql.ErrNoRows {
-            return nil, fmt.Errorf("aucun produit trouvé avec l'ID %s", id)
+        return nil, err
+    }
+    return page.Produits, nil
+}
+
+// GetTendances retourne les produits les plus consultés sur les 7 derniers jours.
+func (r *ProductRepository) GetTendances(limite int) ([]models.ProduitTendance, error) {
+    rows, err := r.db.Query(`
+        SELECT produit_id, SUM(vues)
+        FROM produit_vues_jour
+        WHERE jour > CURRENT_DATE - 7
+        GROUP BY produit_id
+        ORDER BY SUM(vues) DESC, produit_id
+        LIMIT $1`, limite)
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors du calcul des tendances : %v", err)
+    }
+    defer rows.Close()
+
+    var ids []string
+    vuesParProduit := make(map[string]int)
+    for rows.Next() {
+        var id string
+        var vues int
+        if err := rows.Scan(&id, &vues); err != nil {
+            return nil, fmt.Errorf("erreur lors du scan des tendances : %v", err)
         }
+        ids = append(ids, id)
+        vuesParProduit[id] = vues
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    tendances := []models.ProduitTendance{}
+    if len(ids) == 0 {
+        return tendances, nil
+    }
+
+    produitsRows, err := r.db.Query(selectProduits+" AND p.id = ANY($1)"+conditionCategorieVisible, pq.Array(ids))
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors de la récupération des produits : %v", err)
+    }
+    defer produitsRows.Close()
+
+    products, err := scannerProduits(produitsRows)
+    if err != nil {
+        return nil, err
+    }
+    for _, product := range products {
+        tendances = append(tendances, models.ProduitTendance{Product: product, VuesSemaine: vuesParProduit[product.ID]})
+    }
+    sort.SliceStable(tendances, func(i, j int) bool {
+        return tendances[i].VuesSemaine > tendances[j].VuesSemaine
+    })
+    return tendances, nil
+}
+
+// GetProductByID retourne le produit ; un produit d'une catégorie non visible n'est trouvé que si inclureInactives.
+func (r *ProductRepository) GetProductByID(id string, inclureInactives bool) (*models.Product, error) {
+    query := selectProduits + " AND p.id = $1"
+    if !inclureInactives {
+        query += conditionCategorieVisible
+    }
+
+    product, err := scannerProduit(r.db.QueryRow(query, id))
+    if err == sql.ErrNoRows {
+        return nil, fmt.Errorf("aucun produit trouvé avec l'ID %s", id)
+    }
+    if err != nil {
         return nil, fmt.Errorf("erreur lors de la récupération du produit : %v", err)
     }
 
-    product.Photos = photos
-    product.CategorieNom = categorieNom // Stocker le nom de la catégorie dans le produit
-    return &product, nil
+    product.FilAriane, err = r.filAriane(product.CategorieID)
+    if err != nil {
+        return nil, err
+    }
+    product.Variantes, err = r.ListerVariantes(product.ID)
+    if err != nil {
+        return nil, err
+    }
+    product.Disponibilites, err = r.GetDisponibilites(product.ID, nil)
+    if err != nil {
+        return nil, err
+    }
+    return product, nil
 }
 
 
 
-func (r *ProductRepository) UpdateProduct(id string, updates map[string]interface{}) error {
-    // Initialiser la requête de base
-    query := `UPDATE produits SET `
-    params := []interface{}{}
-    i := 1
+// filAriane retourne les catégories de la racine jusqu'à categorieID.
+func (r *ProductRepository) filAriane(categorieID string) ([]models.CategorieResume, error) {
+    fil := []models.CategorieResume{}
+    err := r.db.Select(&fil, `
+        WITH RECURSIVE ancetres AS (
+            SELECT id, nom, parent_id, 0 AS profondeur FROM categories WHERE id = $1
+            UNION ALL
+            SELECT c.id, c.nom, c.parent_id, a.profondeur + 1
+            FROM categories c JOIN ancetres a ON c.id = a.parent_id
+        )
+        SELECT id, nom FROM ancetres ORDER BY profondeur DESC`, categorieID)
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors de la récupération du fil d'Ariane : %v", err)
+    }
+    return fil, nil
+}
 
-    // Construire dynamiquement les champs à mettre à jour
-    for column, value := range updates {
-        if i > 1 {
-            query += ", "
+// GetDisponibilites retourne le stock du produit dans chaque emplacement actif,
+// du plus proche au plus éloigné si origine est fournie.
+func (r *ProductRepository) GetDisponibilites(id string, origine *models.Position) ([]models.StockEmplacement, error) {
+    return inventaire.ListerDisponibilites(r.db, id, origine)
+}
+
+// UpdateProduct applique les champs renseignés du patch ; le stock passe par le journal d'inventaire.
+// Si versionAttendue est non nulle, la modification échoue avec utils.ErrVersionPerimee lorsque
+// le produit a changé depuis. Retourne la nouvelle version.
+func (r *ProductRepository) UpdateProduct(id string, patch models.ProductPatch, versionAttendue int, modifiePar string) (int, error) {
+    colonnes, valeursColonnes, err := validerPatch(patch)
+    if err != nil {
+        return 0, err
+    }
+    if len(colonnes) == 0 && patch.Stock == nil && patch.Attributs == nil {
+        return 0, fmt.Errorf("%w : aucun champ à modifier", ErrModificationInvalide)
+    }
+
+    tx, err := r.db.Beginx()
+    if err != nil {
+        return 0, fmt.Errorf("erreur lors du début de la transaction : %v", err)
+    }
+    defer tx.Rollback()
+
+    var version int
+    var categorieID string
+    var attributsActuels []byte
+    err = tx.QueryRow(`SELECT version, categorie_id, attributs FROM produits WHERE id = $1 FOR UPDATE`, id).
+        Scan(&version, &categorieID, &attributsActuels)
+    if err == sql.ErrNoRows {
+        return 0, ErrProduitIntrouvable
+    }
+    if err != nil {
+        return 0, fmt.Errorf("erreur lors de la recherche du produit : %v", err)
+    }
+    if versionAttendue != 0 && version != versionAttendue {
+        return 0, utils.ErrVersionPerimee
+    }
+
+    if patch.CategorieID != nil {
+        var existe bool
+        err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM categories WHERE id = $1)`, *patch.CategorieID).Scan(&existe)
+        if err != nil {
+            return 0, fmt.Errorf("erreur lors de la vérification de la catégorie : %v", err)
+        }
+        if !existe {
+            return 0, fmt.Errorf("%w : catégorie inconnue", ErrModificationInvalide)
         }
-        query += fmt.Sprintf("%s = $%d", column, i)
-        params = append(params, value)
-        i++
     }
 
-    // Ajouter la condition WHERE pour spécifier le produit
-    query += fmt.Sprintf(" WHERE id = $%d", i)
-    params = append(params, id)
+    // Les valeurs d'attributs sont revalidées si elles changent ou si le produit change de catégorie
+    if patch.Attributs != nil || patch.CategorieID != nil {
+        var valeurs map[string]interface{}
+        if patch.Attributs != nil {
+            valeurs = *patch.Attributs
+        } else if err := json.Unmarshal(attributsActuels, &valeurs); err != nil {
+            return 0, fmt.Errorf("attributs invalides pour le produit %s : %v", id, err)
+        }
+        if patch.CategorieID != nil {
+            categorieID = *patch.CategorieID
+        }
 
-    // Exécuter la requête
-    _, err := r.db.Exec(query, params...)
+        attributs, err := attributsValides(tx, categorieID, valeurs)
+        if err != nil {
+            return 0, err
+        }
+        colonnes = append(colonnes, "attributs")
+        valeursColonnes = append(valeursColonnes, attributs)
+    }
+    // Les noms de colonnes proviennent de validerPatch ou de ce code, jamais de la requête
+    query := `UPDATE produits SET updated_at = NOW(), version = version + 1`
+    for i, colonne := range colonnes {
+        query += fmt.Sprintf(", %s = $%d", colonne, i+1)
+    }
+    query += fmt.Sprintf(" WHERE id = $%d RETURNING version", len(valeursColonnes)+1)
+
+    err = tx.QueryRow(query, append(valeursColonnes, id)...).Scan(&version)
+    if estDoublonSKU(err) {
+        return 0, ErrSKUExistant
+    }
     if err != nil {
-        return fmt.Errorf("erreur lors de la mise à jour du produit : %v", err)
+        return 0, fmt.Errorf("erreur lors de la mise à jour du produit : %v", err)
     }
-    return nil
+
+    if patch.Stock != nil {
+        if err := ajusterStockVers(tx, id, "", *patch.Stock, models.RaisonAjustement,
+            "Modification du stock depuis la fiche produit", modifiePar); err != nil {
+            return 0, err
+        }
+    }
+
+    if err = tx.Commit(); err != nil {
+        return 0, fmt.Errorf("erreur lors de la validation de la transaction : %v", err)
+    }
+    return version, nil
 }
 
+// validerPatch contrôle les valeurs du patch et retourne les colonnes à modifier avec leurs valeurs.
+// Le stock n'en fait pas partie : il est ajusté via le journal d'inventaire.
+func validerPatch(patch models.ProductPatch) ([]string, []interface{}, error) {
+    var colonnes []string
+    var valeurs []interface{}
+    ajouter := func(colonne string, valeur interface{}) {
+        colonnes = append(colonnes, colonne)
+        valeurs = append(valeurs, valeur)
+    }
+    invalide := func(message string) ([]string, []interface{}, error) {
+        return nil, nil, fmt.Errorf("%w : %s", ErrModificationInvalide, message)
+    }
 
-func (r *ProductRepository) DeleteProduct(id string) error {
-    query := `DELETE FROM produits WHERE id = $1`
-    
-    _, err := r.db.Exec(query, id)
+    if patch.SKU != nil {
+        // Un SKU vide retire la référence
+        var sku interface{}
+        if s := strings.TrimSpace(*patch.SKU); s != "" {
+            sku = s
+        }
+        ajouter("sku", sku)
+    }
+    if patch.Nom != nil {
+        if strings.TrimSpace(*patch.Nom) == "" {
+            return invalide("le nom ne peut pas être vide")
+        }
+        ajouter("nom", strings.TrimSpace(*patch.Nom))
+    }
+    if patch.Prix != nil {
+        if *patch.Prix <= 0 {
+            return invalide("le prix doit être strictement positif")
+        }
+        ajouter("prix", *patch.Prix)
+    }
+    if patch.Stock != nil && *patch.Stock < 0 {
+        return invalide("le stock ne peut pas être négatif")
+    }
+    if patch.SeuilStockBas != nil {
+        if *patch.SeuilStockBas < 0 {
+            return invalide("le seuil de stock bas ne peut pas être négatif")
+        }
+        ajouter("seuil_stock_bas", *patch.SeuilStockBas)
+    }
+    if patch.Etat != nil {
+        if !etatValide(*patch.Etat) {
+            return invalide(fmt.Sprintf("état %q invalide (valeurs possibles : %s)", *patch.Etat, strings.Join(models.EtatsProduit, ", ")))
+        }
+        ajouter("etat", *patch.Etat)
+    }
+    if patch.Photos != nil {
+        photos := *patch.Photos
+        if photos == nil {
+            photos = []string{}
+        }
+        ajouter("photos", pq.Array(photos))
+    }
+    if patch.CategorieID != nil {
+        if _, err := uuid.Parse(*patch.CategorieID); err != nil {
+            return invalide("categorie_id invalide")
+        }
+        ajouter("categorie_id", *patch.CategorieID)
+    }
+    if patch.Localisation != nil {
+        if strings.TrimSpace(*patch.Localisation) == "" {
+            return invalide("la localisation ne peut pas être vide")
+        }
+        ajouter("localisation", strings.TrimSpace(*patch.Localisation))
+    }
+    if patch.Description != nil {
+        ajouter("description", *patch.Description)
+    }
+    if patch.Disponible != nil {
+        ajouter("disponible", *patch.Disponible)
+    }
+    if patch.Marque != nil {
+        ajouter("marque", *patch.Marque)
+    }
+    if patch.Modele != nil {
+        ajouter("modele", *patch.Modele)
+    }
+    return colonnes, valeurs, nil
+}
+
+// etatValide indique si l'état respecte la contrainte CHECK de produits.etat.
+func etatValide(etat string) bool {
+    for _, e := range models.EtatsProduit {
+        if etat == e {
+            return true
+        }
+    }
+    return false
+}
+
+// ajusterStockVers inscrit au journal le mouvement qui amène le stock du produit
+// (ou de la variante) à la valeur cible.
+func ajusterStockVers(tx *sqlx.Tx, produitID, varianteID string, cible int, raison, commentaire, modifiePar string) error {
+    var actuel int
+    var err error
+    if varianteID == "" {
+        err = tx.QueryRow(`SELECT stock FROM produits WHERE id = $1 FOR UPDATE`, produitID).Scan(&actuel)
+    } else {
+        err = tx.QueryRow(`SELECT stock FROM produit_variantes WHERE id = $1 FOR UPDATE`, varianteID).Scan(&actuel)
+    }
     if err != nil {
-        return fmt.Errorf("erreur lors de la suppression du produit : %v", err)
+        return fmt.Errorf("erreur lors de la lecture du stock : %v", err)
+    }
+    if cible == actuel {
+        return nil
+    }
+
+    err = inventaire.AppliquerMouvement(tx, &models.MouvementStock{
+        ProduitID:   produitID,
+        VarianteID:  varianteID,
+        Quantite:    cible - actuel,
+        Raison:      raison,
+        Commentaire: commentaire,
+        CreePar:     modifiePar,
+    })
+    if err != nil {
+        return fmt.Errorf("erreur lors de l'ajustement du stock : %w", err)
     }
     return nil
 }
 
-func (r *ProductRepository) GetProductsByCategory(categoryID string) ([]models.Product, error) {
-    var products []models.Product
-    query := `
-        SELECT 
-            p.id, 
-            p.nom, 
-            p.prix, 
-            p.stock, 
-            p.etat, 
-            p.photos, 
-            p.categorie_id, 
-            c.nom AS categorie_nom,  -- Récupérer le nom de la catégorie
-            p.localisation, 
-            p.description, 
-            p.nombre_vues, 
-            p.disponible, 
-            p.marque, 
-            p.modele, 
-            p.created_at, 
-            p.updated_at
-        FROM produits p
-        JOIN categories c
-        ON p.categorie_id = c.id
-        WHERE p.categorie_id = $1`
-
-    rows, err := r.db.Query(query, categoryID)
+
+// DeleteProduct supprime le produit et retourne ses photos, pour nettoyer les fichiers devenus orphelins.
+func (r *ProductRepository) DeleteProduct(id string) ([]string, error) {
+    query := `DELETE FROM produits WHERE id = $1 RETURNING photos`
+
+    var photos []string
+    err := r.db.QueryRow(query, id).Scan(pq.Array(&photos))
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
     if err != nil {
-        return nil, fmt.Errorf("erreur lors de la récupération des produits par catégorie : %v", err)
+        return nil, fmt.Errorf("erreur lors de la suppression du produit : %v", err)
     }
-    defer rows.Close()
+    return photos, nil
+}
 
-    for rows.Next() {
-        var product models.Product
-        var photos []string
-        err := rows.Scan(
-            &product.ID, &product.Nom, &product.Prix, &product.Stock,
-            &product.Etat, pq.Array(&photos), &product.CategorieID,
-            &product.CategorieNom, // Stocker le nom de la catégorie ici
-            &product.Localisation, &product.Description, &product.NombreVues,
-            &product.Disponible, &product.Marque, &product.Modele,
-            &product.CreatedAt, &product.UpdatedAt,
+// conditionSousArbre retient les produits de la catégorie $%[1]d ou de l'une de ses sous-catégories.
+const conditionSousArbre = `p.categorie_id IN (
+        WITH RECURSIVE descendantes AS (
+            SELECT id FROM categories WHERE id = $%[1]d
+            UNION
+            SELECT c.id FROM categories c JOIN descendantes d ON c.parent_id = d.id
         )
-        if err != nil {
-            return nil, fmt.Errorf("erreur lors du scan des produits : %v", err)
-        }
-        product.Photos = photos
-        products = append(products, product)
+        SELECT id FROM descendantes)`
+
+// GetProductsByCategory liste les produits de la catégorie, et de ses sous-catégories si avecDescendants.
+func (r *ProductRepository) GetProductsByCategory(categoryID string, avecDescendants, inclureInactives bool, opts models.ListingOptions) (*models.ProductPage, error) {
+    conditions, args := construireFiltres(models.ProductFilters{InclureInactives: inclureInactives}, "")
+    args = append(args, categoryID)
+    if avecDescendants {
+        conditions += " AND " + fmt.Sprintf(conditionSousArbre, len(args))
+    } else {
+        conditions += fmt.Sprintf(" AND p.categorie_id = $%d", len(args))
     }
-
-    // Vérifier les erreurs de la boucle rows.Next()
-    if err := rows.Err(); err != nil {
-        return nil, fmt.Errorf("erreur lors de l'itération sur les résultats des produits : %v", err)
+    page, err := r.listerProduits(conditions, args, opts)
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors de la récupération des produits par catégorie : %w", err)
     }
-
-    return products, nil
+    return page, nil
 }
 
+// Noms des filtres pouvant être exclus lors du calcul d'une facette
+const (
+    filtrePrix         = "prix"
+    filtreMarque       = "marque"
+    filtreEtat         = "etat"
+    filtreLocalisation = "localisation"
+    filtreCategorie    = "categorie"
+)
 
-// products/repository.go
-func (r *ProductRepository) GetFilteredProducts(filters models.ProductFilters) ([]models.Product, error) {
-    query := `
-        SELECT id, nom, prix, stock, etat, photos, categorie_id,
-               localisation, description, nombre_vues, disponible,
-               marque, modele, created_at, updated_at
-        FROM produits
-        WHERE 1=1`
-    
+// conditionCategorieVisible exclut les produits des catégories inactives, hors période
+// d'activation ou rangées sous une catégorie non visible.
+const conditionCategorieVisible = " AND p.categorie_id IN (SELECT id FROM categories_visibles)"
+
+// ConditionLocalisation retient un produit de la table (ou de l'alias) donnée, localisé dans l'une
+// des villes passées en paramètre $arg, ou disposant de stock dans un emplacement actif de ces villes.
+// Elle est partagée par /products/filter et /search.
+func ConditionLocalisation(table string, arg int) string {
+    return fmt.Sprintf(`(%[1]s.localisation = ANY($%[2]d) OR EXISTS (
+        SELECT 1 FROM stock_emplacements se
+        JOIN emplacements e ON e.id = se.emplacement_id AND e.actif
+        WHERE se.produit_id = %[1]s.id AND se.quantite > 0 AND e.localisation = ANY($%[2]d)))`, table, arg)
+}
+
+// construireFiltres traduit les filtres en conditions SQL (préfixées par AND) sur la table produits (alias p).
+// Le filtre nommé `exclure` est ignoré, ce qui permet de compter une facette
+// en tenant compte de tous les autres filtres actifs.
+func construireFiltres(filters models.ProductFilters, exclure string) (string, []interface{}) {
+    conditions := ""
     var args []interface{}
     argCount := 1
 
     // Construction dynamique de la requête avec les filtres
-    if filters.PrixMin != nil {
-        query += fmt.Sprintf(" AND prix >= $%d", argCount)
+    if filters.PrixMin != nil && exclure != filtrePrix {
+        conditions += fmt.Sprintf(" AND p.prix >= $%d", argCount)
         args = append(args, *filters.PrixMin)
         argCount++
     }
 
-    if filters.PrixMax != nil {
-        query += fmt.Sprintf(" AND prix <= $%d", argCount)
+    if filters.PrixMax != nil && exclure != filtrePrix {
+        conditions += fmt.Sprintf(" AND p.prix <= $%d", argCount)
         args = append(args, *filters.PrixMax)
         argCount++
     }
 
-    if len(filters.Marque) > 0 {
-        query += fmt.Sprintf(" AND marque = ANY($%d)", argCount)
+    if len(filters.Marque) > 0 && exclure != filtreMarque {
+        conditions += fmt.Sprintf(" AND p.marque = ANY($%d)", argCount)
         args = append(args, pq.Array(filters.Marque))
         argCount++
     }
 
-    if len(filters.Etat) > 0 {
-        query += fmt.Sprintf(" AND etat = ANY($%d)", argCount)
+    if len(filters.Etat) > 0 && exclure != filtreEtat {
+        conditions += fmt.Sprintf(" AND p.etat = ANY($%d)", argCount)
         args = append(args, pq.Array(filters.Etat))
         argCount++
     }
 
-    if len(filters.Localisation) > 0 {
-        query += fmt.Sprintf(" AND localisation = ANY($%d)", argCount)
+    if len(filters.Localisation) > 0 && exclure != filtreLocalisation {
+        conditions += " AND " + ConditionLocalisation("p", argCount)
         args = append(args, pq.Array(filters.Localisation))
         argCount++
     }
 
-    if filters.CategorieID != "" {
-        query += fmt.Sprintf(" AND categorie_id = $%d", argCount)
+    if filters.CategorieID != "" && exclure != filtreCategorie {
+        conditions += fmt.Sprintf(" AND p.categorie_id = $%d", argCount)
         args = append(args, filters.CategorieID)
         argCount++
     }
 
     if filters.Disponible != nil {
-        query += fmt.Sprintf(" AND disponible = $%d", argCount)
+        conditions += fmt.Sprintf(" AND p.disponible = $%d", argCount)
         args = append(args, *filters.Disponible)
         argCount++
     }
 
     if filters.SearchTerm != "" {
-        searchTerm := "%" + filters.SearchTerm + "%"
-        query += fmt.Sprintf(` AND (
-            nom ILIKE $%d OR 
-            description ILIKE $%d OR 
-            marque ILIKE $%d OR 
-            modele ILIKE $%d
-        )`, argCount, argCount, argCount, argCount)
-        args = append(args, searchTerm)
+        conditions += fmt.Sprintf(" AND p.search_vector @@ websearch_to_tsquery('french_unaccent', $%d)", argCount)
+        args = append(args, filters.SearchTerm)
         argCount++
     }
 
-    // Exécution de la requête
-    rows, err := r.db.Query(query, args...)
-    if err != nil {
-        return nil, fmt.Errorf("erreur lors de la récupération des produits filtrés : %v", err)
+    conditionsAttributs, argsAttributs := ConditionsAttributs("p.attributs", filters, argCount)
+    conditions += conditionsAttributs
+    args = append(args, argsAttributs...)
+
+    if !filters.InclureInactives {
+        conditions += conditionCategorieVisible
     }
-    defer rows.Close()
 
-    var products []models.Product
-    for rows.Next() {
-        var product models.Product
-        var photos []string
-        err := rows.Scan(
-            &product.ID, &product.Nom, &product.Prix, &product.Stock,
-            &product.Etat, pq.Array(&photos), &product.CategorieID,
-            &product.Localisation, &product.Description, &product.NombreVues,
-            &product.Disponible, &product.Marque, &product.Modele,
-            &product.CreatedAt, &product.UpdatedAt,
-        )
-        if err != nil {
-            return nil, fmt.Errorf("erreur lors du scan des produits : %v", err)
+    return conditions, args
+}
+
+// ConditionsAttributs traduit les filtres d'attributs en conditions SQL (préfixées par AND) sur la
+// colonne JSONB donnée, en numérotant les paramètres à partir de premierArg. Les codes d'attributs
+// sont passés en paramètres, jamais insérés dans la requête. Elle est partagée par /products/filter et /search.
+func ConditionsAttributs(colonne string, filters models.ProductFilters, premierArg int) (string, []interface{}) {
+    conditions := ""
+    var args []interface{}
+    parametre := func(valeur interface{}) int {
+        args = append(args, valeur)
+        return premierArg + len(args) - 1
+    }
+
+    for _, code := range clesTriees(filters.Attributs) {
+        conditions += fmt.Sprintf(" AND %s->>($%d::text) = ANY($%d)", colonne, parametre(code), parametre(pq.Array(filters.Attributs[code])))
+    }
+
+    // Un attribut numérique est comparé seulement s'il est stocké comme nombre
+    bornes := []struct {
+        valeurs   map[string]float64
+        operateur string
+    }{
+        {filters.AttributsMin, ">="},
+        {filters.AttributsMax, "<="},
+    }
+    for _, borne := range bornes {
+        for _, code := range clesTriees(borne.valeurs) {
+            n := parametre(code)
+            conditions += fmt.Sprintf(" AND jsonb_typeof(%[1]s->($%[2]d::text)) = 'number' AND (%[1]s->>($%[2]d::text))::numeric %[3]s $%[4]d",
+                colonne, n, borne.operateur, parametre(borne.valeurs[code]))
         }
-        product.Photos = photos
-        products = append(products, product)
     }
+    return conditions, args
+}
 
-    return products, nil
+func clesTriees[V any](m map[string]V) []string {
+    cles := make([]string, 0, len(m))
+    for cle := range m {
+        cles = append(cles, cle)
+    }
+    sort.Strings(cles)
+    return cles
+}
+
+// products/repository.go
+func (r *ProductRepository) GetFilteredProducts(filters models.ProductFilters, opts models.ListingOptions) (*models.ProductPage, error) {
+    conditions, args := construireFiltres(filters, "")
+    page, err := r.listerProduits(conditions, args, opts)
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors de la récupération des produits filtrés : %w", err)
+    }
+    return page, nil
 }
 
 func (r *ProductRepository) SearchProducts(searchTerm string) ([]models.Product, error) {
     query := `
-        SELECT id, nom, prix, stock, etat, photos, categorie_id,
+        SELECT id, nom, prix, stock, ` + stockDisponible + `, seuil_stock_bas, etat, photos, categorie_id,
                localisation, description, nombre_vues, disponible,
-               marque, modele, created_at, updated_at
-        FROM produits
-        WHERE 
-            nom ILIKE $1 OR 
-            description ILIKE $1 OR 
-            marque ILIKE $1 OR 
-            modele ILIKE $1
+               marque, modele, created_at, updated_at,
+               ts_headline('french_unaccent', COALESCE(nom, '') || ' — ' || COALESCE(description, ''), q,
+                           'StartSel=<mark>, StopSel=</mark>, MaxWords=25, MinWords=8, MaxFragments=2')
+        FROM produits p, websearch_to_tsquery('french_unaccent', $1) q
+        WHERE search_vector @@ q` + conditionCategorieVisible + `
         ORDER BY 
-            CASE 
-                WHEN nom ILIKE $2 THEN 1
-                WHEN marque ILIKE $2 THEN 2
-                WHEN modele ILIKE $2 THEN 3
-                WHEN description ILIKE $2 THEN 4
-                ELSE 5
-            END,
+            ts_rank(search_vector, q) DESC,
             nombre_vues DESC
         LIMIT 20`
 
-    searchPattern := "%" + searchTerm + "%"
-    exactPattern := searchTerm
+    products, err := r.rechercherProduits(query, searchTerm)
+    if err != nil || len(products) > 0 {
+        return products, err
+    }
+
+    // Aucun résultat : recherche tolérante aux fautes de frappe par similarité de trigrammes
+    fuzzyQuery := `
+        SELECT id, nom, prix, stock, ` + stockDisponible + `, seuil_stock_bas, etat, photos, categorie_id,
+               localisation, description, nombre_vues, disponible,
+               marque, modele, created_at, updated_at, ''
+        FROM produits p, lower(f_unaccent($1)) t
+        WHERE (lower(f_unaccent(nom)) % t
+           OR lower(f_unaccent(marque)) % t
+           OR t <% lower(f_unaccent(nom)))` + conditionCategorieVisible + `
+        ORDER BY 
+            GREATEST(similarity(lower(f_unaccent(nom)), t),
+                     similarity(lower(f_unaccent(COALESCE(marque, ''))), t),
+                     word_similarity(t, lower(f_unaccent(nom)))) DESC,
+            nombre_vues DESC
+        LIMIT 20`
+
+    return r.rechercherProduits(fuzzyQuery, searchTerm)
+}
 
-    rows, err := r.db.Query(query, searchPattern, exactPattern)
+func (r *ProductRepository) rechercherProduits(query, searchTerm string) ([]models.Product, error) {
+    rows, err := r.db.Query(query, searchTerm)
     if err != nil {
         return nil, fmt.Errorf("erreur lors de la recherche des produits : %v", err)
     }
@@ -391,11 +798,11 @@ func (r *ProductRepository) SearchProducts(searchTerm string) ([]models.Product,
         var product models.Product
         var photos []string
         err := rows.Scan(
-            &product.ID, &product.Nom, &product.Prix, &product.Stock,
-            &product.Etat, pq.Array(&photos), &product.CategorieID,
+            &product.ID, &product.Nom, &product.Prix, &product.Stock, &product.StockDisponible,
+            &product.SeuilStockBas, &product.Etat, pq.Array(&photos), &product.CategorieID,
             &product.Localisation, &product.Description, &product.NombreVues,
             &product.Disponible, &product.Marque, &product.Modele,
-            &product.CreatedAt, &product.UpdatedAt,
+            &product.CreatedAt, &product.UpdatedAt, &product.Extrait,
         )
         if err != nil {
             return nil, fmt.Errorf("erreur lors du scan des produits : %v", err)
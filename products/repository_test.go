@@ -0,0 +1,79 @@
+package products
+
+import (
+    "ecommerce-api/models"
+    "errors"
+    "fmt"
+    "strings"
+    "testing"
+
+    "github.com/lib/pq"
+)
+
+// colonnesSelect compte les colonnes d'un SELECT : les virgules entre parenthèses
+// (COALESCE, sous-requêtes) et les commentaires SQL ne séparent pas de colonnes.
+func colonnesSelect(t *testing.T, query string) int {
+    debut := strings.Index(query, "SELECT")
+    if debut < 0 {
+        t.Fatalf("SELECT introuvable dans %q", query)
+    }
+    colonnes, profondeur := 1, 0
+    for i := debut + len("SELECT"); i < len(query); i++ {
+        switch {
+        case strings.HasPrefix(query[i:], "--"):
+            for i < len(query) && query[i] != '\n' {
+                i++
+            }
+        case query[i] == '(':
+            profondeur++
+        case query[i] == ')':
+            profondeur--
+        case query[i] == ',' && profondeur == 0:
+            colonnes++
+        case profondeur == 0 && strings.HasPrefix(query[i:], "FROM"):
+            return colonnes
+        }
+    }
+    t.Fatalf("FROM introuvable dans %q", query)
+    return 0
+}
+
+func TestSelectProduitsCorrespondAuScan(t *testing.T) {
+    var product models.Product
+    var photos []string
+    var attributs []byte
+
+    colonnes := colonnesSelect(t, selectProduits)
+    if destinations := len(destinationsProduit(&product, &photos, &attributs)); colonnes != destinations {
+        t.Errorf("selectProduits lit %d colonnes mais destinationsProduit en scanne %d", colonnes, destinations)
+    }
+}
+
+func TestColonnesSelect(t *testing.T) {
+    query := `SELECT a, COALESCE(b, ''), (SELECT x, y FROM t) AS c, -- commentaire, avec virgule
+        d FROM table`
+    if n := colonnesSelect(t, query); n != 4 {
+        t.Errorf("%d colonnes, attendu 4", n)
+    }
+}
+
+func TestEstDoublonSKU(t *testing.T) {
+    doublon := &pq.Error{Code: "23505", Constraint: "produits_sku_key"}
+    cas := []struct {
+        nom     string
+        err     error
+        attendu bool
+    }{
+        {"doublon de SKU", doublon, true},
+        {"doublon enveloppé", fmt.Errorf("mise à jour : %w", doublon), true},
+        {"autre contrainte unique", &pq.Error{Code: "23505", Constraint: "produit_variantes_sku_key"}, false},
+        {"autre erreur postgres", &pq.Error{Code: "23503", Constraint: "produits_categorie_id_fkey"}, false},
+        {"erreur quelconque", errors.New("connexion perdue"), false},
+        {"pas d'erreur", nil, false},
+    }
+    for _, c := range cas {
+        if obtenu := estDoublonSKU(c.err); obtenu != c.attendu {
+            t.Errorf("%s : %v, attendu %v", c.nom, obtenu, c.attendu)
+        }
+    }
+}
@@ -0,0 +1,199 @@
+package products
+
+import (
+    "database/sql"
+    "ecommerce-api/inventaire"
+    "ecommerce-api/models"
+    "encoding/json"
+    "errors"
+    "fmt"
+)
+
+// ErrVarianteIntrouvable est retournée quand la variante n'existe pas.
+var ErrVarianteIntrouvable = errors.New("variante introuvable")
+
+const selectVariantes = `
+        SELECT v.id, v.produit_id, v.sku, v.attributs, v.prix, COALESCE(v.prix, p.prix),
+               v.stock,
+               GREATEST(v.stock - (
+                   SELECT COALESCE(SUM(rs.quantite), 0) FROM reservations_stock rs
+                   WHERE rs.variante_id = v.id AND ` + inventaire.ConditionReservationActive + `), 0),
+               v.disponible, v.created_at, v.updated_at
+        FROM produit_variantes v
+        JOIN produits p ON p.id = v.produit_id`
+
+func scannerVariantes(rows *sql.Rows) ([]models.Variante, error) {
+    variantes := []models.Variante{}
+    for rows.Next() {
+        var variante models.Variante
+        var attributs []byte
+        var prix sql.NullFloat64
+
+        err := rows.Scan(
+            &variante.ID, &variante.ProduitID, &variante.SKU, &attributs, &prix, &variante.PrixEffectif,
+            &variante.Stock, &variante.StockDisponible, &variante.Disponible, &variante.CreatedAt, &variante.UpdatedAt,
+        )
+        if err != nil {
+            return nil, fmt.Errorf("erreur lors du scan des variantes : %v", err)
+        }
+        if err := json.Unmarshal(attributs, &variante.Attributs); err != nil {
+            return nil, fmt.Errorf("attributs invalides pour la variante %s : %v", variante.SKU, err)
+        }
+        if prix.Valid {
+            variante.Prix = &prix.Float64
+        }
+        variantes = append(variantes, variante)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("erreur lors de l'itération sur les variantes : %v", err)
+    }
+    return variantes, nil
+}
+
+// ListerVariantes retourne les variantes d'un produit, triées par SKU.
+func (r *ProductRepository) ListerVariantes(produitID string) ([]models.Variante, error) {
+    rows, err := r.db.Query(selectVariantes+" WHERE v.produit_id = $1 ORDER BY v.sku", produitID)
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors de la récupération des variantes : %v", err)
+    }
+    defer rows.Close()
+    return scannerVariantes(rows)
+}
+
+// GetVariante retourne une variante par son ID.
+func (r *ProductRepository) GetVariante(id string) (*models.Variante, error) {
+    rows, err := r.db.Query(selectVariantes+" WHERE v.id = $1", id)
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors de la récupération de la variante : %v", err)
+    }
+    defer rows.Close()
+
+    variantes, err := scannerVariantes(rows)
+    if err != nil {
+        return nil, err
+    }
+    if len(variantes) == 0 {
+        return nil, ErrVarianteIntrouvable
+    }
+    return &variantes[0], nil
+}
+
+func validerVariante(variante models.Variante) error {
+    if variante.SKU == "" {
+        return fmt.Errorf("le SKU est obligatoire")
+    }
+    if variante.Prix != nil && *variante.Prix < 0 {
+        return fmt.Errorf("le prix ne peut pas être négatif")
+    }
+    if variante.Stock < 0 {
+        return fmt.Errorf("le stock ne peut pas être négatif")
+    }
+    return nil
+}
+
+// CreerVariante ajoute une variante à un produit existant ; son stock initial est inscrit au journal d'inventaire.
+func (r *ProductRepository) CreerVariante(produitID string, variante models.Variante, creePar string) (*models.Variante, error) {
+    if err := validerVariante(variante); err != nil {
+        return nil, err
+    }
+    if variante.Attributs == nil {
+        variante.Attributs = map[string]string{}
+    }
+    attributs, err := json.Marshal(variante.Attributs)
+    if err != nil {
+        return nil, fmt.Errorf("attributs invalides : %v", err)
+    }
+
+    tx, err := r.db.Beginx()
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors du début de la transaction : %v", err)
+    }
+    defer tx.Rollback()
+
+    var id string
+    err = tx.QueryRow(`
+        INSERT INTO produit_variantes (produit_id, sku, attributs, prix, stock, disponible)
+        VALUES ($1, $2, $3, $4, 0, $5)
+        RETURNING id`,
+        produitID, variante.SKU, attributs, variante.Prix, variante.Disponible,
+    ).Scan(&id)
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors de la création de la variante : %v", err)
+    }
+
+    if variante.Stock > 0 {
+        err = inventaire.AppliquerMouvement(tx, &models.MouvementStock{
+            ProduitID:   produitID,
+            VarianteID:  id,
+            Quantite:    variante.Stock,
+            Raison:      models.RaisonAjustement,
+            Commentaire: "Stock initial",
+            CreePar:     creePar,
+        })
+        if err != nil {
+            return nil, fmt.Errorf("erreur lors de l'enregistrement du stock initial : %w", err)
+        }
+    }
+
+    if err = tx.Commit(); err != nil {
+        return nil, fmt.Errorf("erreur lors de la validation de la transaction : %v", err)
+    }
+    return r.GetVariante(id)
+}
+
+// ModifierVariante remplace le SKU, les attributs, le prix et la disponibilité d'une variante.
+// Un changement de stock est inscrit au journal d'inventaire comme ajustement.
+func (r *ProductRepository) ModifierVariante(id string, variante models.Variante, modifiePar string) (*models.Variante, error) {
+    if err := validerVariante(variante); err != nil {
+        return nil, err
+    }
+    if variante.Attributs == nil {
+        variante.Attributs = map[string]string{}
+    }
+    attributs, err := json.Marshal(variante.Attributs)
+    if err != nil {
+        return nil, fmt.Errorf("attributs invalides : %v", err)
+    }
+
+    tx, err := r.db.Beginx()
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors du début de la transaction : %v", err)
+    }
+    defer tx.Rollback()
+
+    var produitID string
+    err = tx.QueryRow(`
+        UPDATE produit_variantes
+        SET sku = $1, attributs = $2, prix = $3, disponible = $4, updated_at = NOW()
+        WHERE id = $5
+        RETURNING produit_id`,
+        variante.SKU, attributs, variante.Prix, variante.Disponible, id).Scan(&produitID)
+    if err == sql.ErrNoRows {
+        return nil, ErrVarianteIntrouvable
+    }
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors de la mise à jour de la variante : %v", err)
+    }
+
+    if err := ajusterStockVers(tx, produitID, id, variante.Stock, models.RaisonAjustement,
+        "Modification du stock de la variante", modifiePar); err != nil {
+        return nil, err
+    }
+
+    if err = tx.Commit(); err != nil {
+        return nil, fmt.Errorf("erreur lors de la validation de la transaction : %v", err)
+    }
+    return r.GetVariante(id)
+}
+
+// SupprimerVariante supprime une variante ; les lignes de commande conservent leur SKU.
+func (r *ProductRepository) SupprimerVariante(id string) error {
+    result, err := r.db.Exec(`DELETE FROM produit_variantes WHERE id = $1`, id)
+    if err != nil {
+        return fmt.Errorf("erreur lors de la suppression de la variante : %v", err)
+    }
+    if n, err := result.RowsAffected(); err == nil && n == 0 {
+        return ErrVarianteIntrouvable
+    }
+    return nil
+}
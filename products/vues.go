@@ -0,0 +1,159 @@
+package products
+
+import (
+    "ecommerce-api/googleauth"
+    "log"
+    "net"
+    "net/http"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/jmoiron/sqlx"
+    "github.com/lib/pq"
+)
+
+// ViewTracker compte les consultations de fiches produit.
+// Une même personne n'est comptée qu'une fois par produit sur la fenêtre de déduplication ;
+// les vues sont cumulées en mémoire puis écrites par lots pour éviter de verrouiller
+// la ligne d'un produit très consulté à chaque requête.
+type ViewTracker struct {
+    db      *sqlx.DB
+    fenetre time.Duration
+
+    mu           sync.Mutex
+    vuesRecentes map[string]time.Time // visiteur|produit → dernière vue comptée
+    enAttente    map[string]int       // produit → vues pas encore écrites
+}
+
+func NewViewTracker(db *sqlx.DB, fenetre time.Duration) *ViewTracker {
+    return &ViewTracker{
+        db:           db,
+        fenetre:      fenetre,
+        vuesRecentes: make(map[string]time.Time),
+        enAttente:    make(map[string]int),
+    }
+}
+
+// Demarrer écrit les vues en attente toutes les `intervalle`.
+func (t *ViewTracker) Demarrer(intervalle time.Duration) {
+    go func() {
+        ticker := time.NewTicker(intervalle)
+        defer ticker.Stop()
+
+        for range ticker.C {
+            if err := t.Flush(); err != nil {
+                log.Printf("Erreur lors de l'enregistrement des vues : %v", err)
+            }
+        }
+    }()
+}
+
+// Enregistrer compte une vue du produit sauf si ce visiteur l'a déjà vu dans la fenêtre.
+func (t *ViewTracker) Enregistrer(produitID, visiteur string) {
+    cle := visiteur + "|" + produitID
+    maintenant := time.Now()
+
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    if derniere, ok := t.vuesRecentes[cle]; ok && maintenant.Sub(derniere) < t.fenetre {
+        return
+    }
+    t.vuesRecentes[cle] = maintenant
+    t.enAttente[produitID]++
+}
+
+// Flush écrit les vues en attente dans produits.nombre_vues et produit_vues_jour en une transaction.
+func (t *ViewTracker) Flush() error {
+    t.mu.Lock()
+    enAttente := t.enAttente
+    t.enAttente = make(map[string]int)
+    limite := time.Now().Add(-t.fenetre)
+    for cle, derniere := range t.vuesRecentes {
+        if derniere.Before(limite) {
+            delete(t.vuesRecentes, cle)
+        }
+    }
+    t.mu.Unlock()
+
+    if len(enAttente) == 0 {
+        return nil
+    }
+
+    // Ordre stable des ids pour que deux écritures concurrentes verrouillent les lignes dans le même ordre
+    ids := make([]string, 0, len(enAttente))
+    for id := range enAttente {
+        ids = append(ids, id)
+    }
+    sort.Strings(ids)
+    vues := make([]int64, len(ids))
+    for i, id := range ids {
+        vues[i] = int64(enAttente[id])
+    }
+
+    err := t.ecrire(ids, vues)
+    if err != nil {
+        // Les vues sont remises en attente pour le prochain passage
+        t.mu.Lock()
+        for i, id := range ids {
+            t.enAttente[id] += int(vues[i])
+        }
+        t.mu.Unlock()
+    }
+    return err
+}
+
+func (t *ViewTracker) ecrire(ids []string, vues []int64) error {
+    tx, err := t.db.Beginx()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    // Le compteur de vues ne change pas la version du produit (trigger produits_version) :
+    // il n'est pas modifiable par les clients et invaliderait sans cesse les ETag
+    _, err = tx.Exec(`
+        UPDATE produits p
+        SET nombre_vues = COALESCE(p.nombre_vues, 0) + v.vues
+        FROM unnest($1::uuid[], $2::int[]) AS v(id, vues)
+        WHERE p.id = v.id`,
+        pq.Array(ids), pq.Array(vues))
+    if err != nil {
+        return err
+    }
+
+    _, err = tx.Exec(`
+        INSERT INTO produit_vues_jour (produit_id, jour, vues)
+        SELECT v.id, CURRENT_DATE, v.vues
+        FROM unnest($1::uuid[], $2::int[]) AS v(id, vues)
+        JOIN produits p ON p.id = v.id
+        ON CONFLICT (produit_id, jour)
+        DO UPDATE SET vues = produit_vues_jour.vues + EXCLUDED.vues`,
+        pq.Array(ids), pq.Array(vues))
+    if err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+// identifiantVisiteur identifie le visiteur pour la déduplication :
+// l'utilisateur connecté, sinon l'en-tête X-Session-ID, sinon l'adresse IP.
+func identifiantVisiteur(r *http.Request) string {
+    if googleID, _, err := googleauth.ExtraireUtilisateur(r); err == nil {
+        return "user:" + googleID
+    }
+    if session := r.Header.Get("X-Session-ID"); session != "" {
+        return "session:" + session
+    }
+    if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+        return "ip:" + strings.TrimSpace(strings.Split(forwarded, ",")[0])
+    }
+    host, _, err := net.SplitHostPort(r.RemoteAddr)
+    if err != nil {
+        host = r.RemoteAddr
+    }
+    return "ip:" + host
+}
@@ -0,0 +1,67 @@
+package search
+
+import (
+    "ecommerce-api/admin"
+    "ecommerce-api/products"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strconv"
+)
+
+type SearchHandler struct {
+    engine *SearchEngine
+}
+
+func NewSearchHandler(engine *SearchEngine) *SearchHandler {
+    return &SearchHandler{engine: engine}
+}
+
+// HandleSearch recherche et filtre les produits avec pagination.
+// Paramètres : q, page, page_size et les filtres de /products/filter.
+func (h *SearchHandler) HandleSearch(w http.ResponseWriter, r *http.Request) {
+    queryParams := r.URL.Query()
+
+    opts := SearchOptions{
+        Query:   queryParams.Get("q"),
+        Filters: products.FiltresDepuisRequete(queryParams),
+    }
+    opts.Filters.InclureInactives = admin.EstAdmin(r)
+    if page := queryParams.Get("page"); page != "" {
+        if p, err := strconv.Atoi(page); err == nil {
+            opts.Page = p
+        }
+    }
+    if pageSize := queryParams.Get("page_size"); pageSize != "" {
+        if ps, err := strconv.Atoi(pageSize); err == nil {
+            opts.PageSize = ps
+        }
+    }
+
+    result, err := h.engine.Search(opts)
+    if err != nil {
+        http.Error(w, fmt.Sprintf("Erreur lors de la recherche : %v", err), http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(result)
+}
+
+// HandleSuggest retourne des suggestions d'autocomplétion pour /search/suggest?q=.
+func (h *SearchHandler) HandleSuggest(w http.ResponseWriter, r *http.Request) {
+    terme := r.URL.Query().Get("q")
+    if len([]rune(terme)) < 2 {
+        http.Error(w, "Le terme de recherche doit contenir au moins 2 caractères", http.StatusBadRequest)
+        return
+    }
+
+    suggestions, err := h.engine.Suggerer(terme, 5)
+    if err != nil {
+        http.Error(w, fmt.Sprintf("Erreur lors de la recherche de suggestions : %v", err), http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(suggestions)
+}
@@ -6,13 +6,28 @@ import (
 
 type SearchOptions struct {
     Query    string
+    Filters  models.ProductFilters // Mêmes filtres que /products/filter
     Page     int
     PageSize int
 }
 
 type SearchResult struct {
-    Products []models.Product `json:"products"`
-    Total    int             `json:"total"`
-    Page     int             `json:"page"`
-    PageSize int             `json:"page_size"`
+    Products     []models.Product `json:"products"`
+    Total        int              `json:"total"`
+    Page         int              `json:"page"`
+    PageSize     int              `json:"page_size"`
+    TotalPages   int              `json:"total_pages"`
+    Approximatif bool             `json:"approximatif"` // true si aucun résultat exact et que la recherche tolérante aux fautes a été utilisée
+}
+
+// Suggestion représente une proposition d'autocomplétion
+type Suggestion struct {
+    ID  string `json:"id,omitempty"`
+    Nom string `json:"nom"`
+}
+
+type Suggestions struct {
+    Produits   []Suggestion `json:"produits"`
+    Marques    []Suggestion `json:"marques"`
+    Categories []Suggestion `json:"categories"`
 }
@@ -1,9 +1,10 @@
-
 package search
 
 import (
 	"database/sql"
+	"ecommerce-api/inventaire"
 	"ecommerce-api/models"
+	"ecommerce-api/products"
 	"fmt"
 
 	"github.com/lib/pq"
@@ -19,6 +20,95 @@ func NewSearchEngine(db *sql.DB) *SearchEngine {
     }
 }
 
+// requeteTexte transforme la saisie de l'utilisateur en tsquery française insensible aux accents.
+const requeteTexte = "websearch_to_tsquery('french_unaccent', $1)"
+
+// Recherche par trigrammes, utilisée quand la recherche plein texte ne trouve rien (fautes de frappe).
+// Les expressions correspondent aux index idx_produits_nom_trgm et idx_produits_marque_trgm.
+const (
+    termeNormalise         = "lower(f_unaccent($1))"
+    conditionApproximative = `(lower(f_unaccent(nom)) % ` + termeNormalise +
+        ` OR lower(f_unaccent(marque)) % ` + termeNormalise +
+        ` OR ` + termeNormalise + ` <% lower(f_unaccent(nom)))`
+    scoreApproximatif      = `GREATEST(similarity(lower(f_unaccent(nom)), ` + termeNormalise + `),
+        similarity(lower(f_unaccent(COALESCE(marque, ''))), ` + termeNormalise + `),
+        word_similarity(` + termeNormalise + `, lower(f_unaccent(nom))))`
+)
+
+// conditionCategorieVisible exclut les produits des catégories non visibles du public.
+const conditionCategorieVisible = "categorie_id IN (SELECT id FROM categories_visibles)"
+
+// stockDisponible retranche du stock les réservations de checkout encore actives.
+const stockDisponible = `GREATEST(stock - (
+                SELECT COALESCE(SUM(rs.quantite), 0) FROM reservations_stock rs
+                WHERE rs.produit_id = produits.id AND ` + inventaire.ConditionReservationActive + `), 0)`
+
+// construireConditions traduit le terme de recherche et les filtres en clause WHERE.
+// Lorsqu'un terme est fourni, il est toujours passé en $1.
+// Sauf filtre explicite, seuls les produits disponibles sont retournés.
+func construireConditions(opts SearchOptions, approximatif bool) (string, []interface{}) {
+    where := " WHERE 1=1"
+    var args []interface{}
+    filters := opts.Filters
+
+    if opts.Query != "" {
+        args = append(args, opts.Query)
+        if approximatif {
+            where += " AND " + conditionApproximative
+        } else {
+            where += " AND search_vector @@ " + requeteTexte
+        }
+    }
+
+    if filters.Disponible != nil {
+        args = append(args, *filters.Disponible)
+        where += fmt.Sprintf(" AND disponible = $%d", len(args))
+    } else {
+        where += " AND disponible = true"
+    }
+
+    if filters.PrixMin != nil {
+        args = append(args, *filters.PrixMin)
+        where += fmt.Sprintf(" AND prix >= $%d", len(args))
+    }
+
+    if filters.PrixMax != nil {
+        args = append(args, *filters.PrixMax)
+        where += fmt.Sprintf(" AND prix <= $%d", len(args))
+    }
+
+    if len(filters.Marque) > 0 {
+        args = append(args, pq.Array(filters.Marque))
+        where += fmt.Sprintf(" AND marque = ANY($%d)", len(args))
+    }
+
+    if len(filters.Etat) > 0 {
+        args = append(args, pq.Array(filters.Etat))
+        where += fmt.Sprintf(" AND etat = ANY($%d)", len(args))
+    }
+
+    if len(filters.Localisation) > 0 {
+        args = append(args, pq.Array(filters.Localisation))
+        where += " AND " + products.ConditionLocalisation("produits", len(args))
+    }
+
+    if filters.CategorieID != "" {
+        args = append(args, filters.CategorieID)
+        where += fmt.Sprintf(" AND categorie_id = $%d", len(args))
+    }
+
+    conditionsAttributs, argsAttributs := products.ConditionsAttributs("attributs", filters, len(args)+1)
+    where += conditionsAttributs
+    args = append(args, argsAttributs...)
+
+    // Les produits des catégories non visibles ne sont trouvés que par les administrateurs
+    if !filters.InclureInactives {
+        where += " AND " + conditionCategorieVisible
+    }
+
+    return where, args
+}
+
 func (s *SearchEngine) Search(opts SearchOptions) (SearchResult, error) {
     // Valider et définir les valeurs par défaut
     if opts.Page <= 0 {
@@ -30,72 +120,67 @@ func (s *SearchEngine) Search(opts SearchOptions) (SearchResult, error) {
     if opts.PageSize > 100 {
         opts.PageSize = 100
     }
+    if opts.Query == "" {
+        opts.Query = opts.Filters.SearchTerm
+    }
 
+    result, err := s.rechercher(opts, false)
+    if err != nil || result.Total > 0 || opts.Query == "" {
+        return result, err
+    }
+
+    // Aucun résultat exact : on retente avec la similarité de trigrammes
+    result, err = s.rechercher(opts, true)
+    result.Approximatif = true
+    return result, err
+}
+
+func (s *SearchEngine) rechercher(opts SearchOptions, approximatif bool) (SearchResult, error) {
     offset := (opts.Page - 1) * opts.PageSize
-    searchTerm := "%" + opts.Query + "%"
+    where, args := construireConditions(opts, approximatif)
 
     // Compter le total des résultats
     var total int
-    countQuery := `
-        SELECT COUNT(*) 
-        FROM produits
-        WHERE 
-            disponible = true AND
-            (
-                nom ILIKE $1 OR
-                description ILIKE $1 OR
-                marque ILIKE $1 OR
-                modele ILIKE $1
-            )
-    `
-    
-    err := s.db.QueryRow(countQuery, searchTerm).Scan(&total)
+    err := s.db.QueryRow(`SELECT COUNT(*) FROM produits`+where, args...).Scan(&total)
     if err != nil {
         return SearchResult{}, fmt.Errorf("erreur lors du comptage des résultats : %v", err)
     }
 
-    // Récupérer les produits
+    // Récupérer les produits, classés par pertinence puis popularité
+    extrait := "''"
+    orderBy := " ORDER BY nombre_vues DESC, created_at DESC"
+    if opts.Query != "" && approximatif {
+        orderBy = " ORDER BY " + scoreApproximatif + " DESC, nombre_vues DESC"
+    } else if opts.Query != "" {
+        extrait = "ts_headline('french_unaccent', COALESCE(nom, '') || ' — ' || COALESCE(description, ''), " +
+            requeteTexte + ", 'StartSel=<mark>, StopSel=</mark>, MaxWords=25, MinWords=8, MaxFragments=2')"
+        orderBy = " ORDER BY ts_rank(search_vector, " + requeteTexte + ") DESC, nombre_vues DESC"
+    }
     searchQuery := `
         SELECT 
-            id, nom, prix, stock, etat, photos, categorie_id,
+            id, nom, prix, stock, ` + stockDisponible + `, seuil_stock_bas, etat, photos, categorie_id,
             localisation, description, nombre_vues, disponible,
-            marque, modele, created_at, updated_at
-        FROM produits
-        WHERE 
-            disponible = true AND
-            (
-                nom ILIKE $1 OR
-                description ILIKE $1 OR
-                marque ILIKE $1 OR
-                modele ILIKE $1
-            )
-        ORDER BY 
-            CASE 
-                WHEN nom ILIKE $1 THEN 1
-                WHEN marque ILIKE $1 THEN 2
-                WHEN modele ILIKE $1 THEN 3
-                ELSE 4
-            END,
-            nombre_vues DESC
-        LIMIT $2 OFFSET $3
-    `
-
-    rows, err := s.db.Query(searchQuery, searchTerm, opts.PageSize, offset)
+            marque, modele, created_at, updated_at, ` + extrait + `
+        FROM produits` + where + orderBy +
+        fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+    args = append(args, opts.PageSize, offset)
+
+    rows, err := s.db.Query(searchQuery, args...)
     if err != nil {
         return SearchResult{}, fmt.Errorf("erreur lors de la recherche des produits : %v", err)
     }
     defer rows.Close()
 
-    var products []models.Product
+    products := []models.Product{}
     for rows.Next() {
         var product models.Product
         var photos []string
         err := rows.Scan(
-            &product.ID, &product.Nom, &product.Prix, &product.Stock,
-            &product.Etat, pq.Array(&photos), &product.CategorieID,
+            &product.ID, &product.Nom, &product.Prix, &product.Stock, &product.StockDisponible,
+            &product.SeuilStockBas, &product.Etat, pq.Array(&photos), &product.CategorieID,
             &product.Localisation, &product.Description, &product.NombreVues,
             &product.Disponible, &product.Marque, &product.Modele,
-            &product.CreatedAt, &product.UpdatedAt,
+            &product.CreatedAt, &product.UpdatedAt, &product.Extrait,
         )
         if err != nil {
             return SearchResult{}, fmt.Errorf("erreur lors du scan des produits : %v", err)
@@ -103,11 +188,75 @@ func (s *SearchEngine) Search(opts SearchOptions) (SearchResult, error) {
         product.Photos = photos
         products = append(products, product)
     }
+    if err := rows.Err(); err != nil {
+        return SearchResult{}, fmt.Errorf("erreur lors du parcours des produits : %v", err)
+    }
 
     return SearchResult{
-        Products: products,
-        Total:    total,
-        Page:     opts.Page,
-        PageSize: opts.PageSize,
+        Products:   products,
+        Total:      total,
+        Page:       opts.Page,
+        PageSize:   opts.PageSize,
+        TotalPages: (total + opts.PageSize - 1) / opts.PageSize,
     }, nil
-}
\ No newline at end of file
+}
+
+// Suggerer propose des noms de produits, des marques et des catégories proches de la saisie,
+// par préfixe ou similarité de trigrammes.
+func (s *SearchEngine) Suggerer(terme string, limite int) (Suggestions, error) {
+    suggestions := Suggestions{
+        Produits:   []Suggestion{},
+        Marques:    []Suggestion{},
+        Categories: []Suggestion{},
+    }
+
+    requetes := []struct {
+        cible *[]Suggestion
+        query string
+    }{
+        {&suggestions.Produits, `
+            SELECT id::text, nom
+            FROM produits
+            WHERE disponible = true AND ` + conditionCategorieVisible + `
+              AND (lower(f_unaccent(nom)) LIKE ` + termeNormalise + ` || '%' OR ` + conditionApproximative + `)
+            ORDER BY word_similarity(` + termeNormalise + `, lower(f_unaccent(nom))) DESC, nombre_vues DESC
+            LIMIT $2`},
+        {&suggestions.Marques, `
+            SELECT '', marque
+            FROM produits
+            WHERE disponible = true AND ` + conditionCategorieVisible + `
+              AND marque IS NOT NULL
+              AND (lower(f_unaccent(marque)) LIKE ` + termeNormalise + ` || '%' OR lower(f_unaccent(marque)) % ` + termeNormalise + `)
+            GROUP BY marque
+            ORDER BY MAX(similarity(lower(f_unaccent(marque)), ` + termeNormalise + `)) DESC, COUNT(*) DESC
+            LIMIT $2`},
+        {&suggestions.Categories, `
+            SELECT id::text, nom
+            FROM categories_visibles
+            WHERE lower(f_unaccent(nom)) LIKE ` + termeNormalise + ` || '%' OR lower(f_unaccent(nom)) % ` + termeNormalise + `
+            ORDER BY similarity(lower(f_unaccent(nom)), ` + termeNormalise + `) DESC
+            LIMIT $2`},
+    }
+
+    for _, req := range requetes {
+        rows, err := s.db.Query(req.query, terme, limite)
+        if err != nil {
+            return Suggestions{}, fmt.Errorf("erreur lors de la recherche de suggestions : %v", err)
+        }
+
+        for rows.Next() {
+            var suggestion Suggestion
+            if err := rows.Scan(&suggestion.ID, &suggestion.Nom); err != nil {
+                rows.Close()
+                return Suggestions{}, fmt.Errorf("erreur lors du scan des suggestions : %v", err)
+            }
+            *req.cible = append(*req.cible, suggestion)
+        }
+        rows.Close()
+        if err := rows.Err(); err != nil {
+            return Suggestions{}, fmt.Errorf("erreur lors du parcours des suggestions : %v", err)
+        }
+    }
+
+    return suggestions, nil
+}
@@ -0,0 +1,121 @@
+package souhaits
+
+import (
+    "ecommerce-api/googleauth"
+    "encoding/json"
+    "fmt"
+    "net/http"
+)
+
+type Handler struct {
+    repo *Repository
+}
+
+func NewHandler(repo *Repository) *Handler {
+    return &Handler{repo: repo}
+}
+
+type souhaitRequest struct {
+    ProduitID string `json:"produit_id"`
+    Notifier  bool   `json:"notifier"`
+}
+
+// HandleListerSouhaits retourne la liste de souhaits de l'utilisateur connecté.
+func (h *Handler) HandleListerSouhaits(w http.ResponseWriter, r *http.Request) {
+    googleID, _, err := googleauth.ExtraireUtilisateur(r)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+
+    produits, err := h.repo.ListerSouhaits(googleID)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "status": "success",
+        "data":   produits,
+    })
+}
+
+// HandleAjouterSouhait ajoute un produit à la liste de souhaits, avec alerte facultative.
+func (h *Handler) HandleAjouterSouhait(w http.ResponseWriter, r *http.Request) {
+    googleID, _, err := googleauth.ExtraireUtilisateur(r)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+
+    var req souhaitRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ProduitID == "" {
+        http.Error(w, "Requête invalide ou produit_id manquant", http.StatusBadRequest)
+        return
+    }
+
+    if err := h.repo.AjouterSouhait(googleID, req.ProduitID, req.Notifier); err != nil {
+        http.Error(w, fmt.Sprintf("Erreur lors de l'ajout : %v", err), http.StatusBadRequest)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(map[string]string{
+        "status":  "success",
+        "message": "Produit ajouté à la liste de souhaits",
+    })
+}
+
+// HandleEnleverSouhait retire un produit de la liste de souhaits.
+func (h *Handler) HandleEnleverSouhait(w http.ResponseWriter, r *http.Request) {
+    googleID, _, err := googleauth.ExtraireUtilisateur(r)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+
+    var req souhaitRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ProduitID == "" {
+        http.Error(w, "Requête invalide ou produit_id manquant", http.StatusBadRequest)
+        return
+    }
+
+    if err := h.repo.EnleverSouhait(googleID, req.ProduitID); err != nil {
+        http.Error(w, fmt.Sprintf("Erreur lors du retrait : %v", err), http.StatusNotFound)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]string{
+        "status":  "success",
+        "message": "Produit retiré de la liste de souhaits",
+    })
+}
+
+// HandleDeplacerVersPanier déplace un produit de la liste de souhaits vers le panier.
+func (h *Handler) HandleDeplacerVersPanier(w http.ResponseWriter, r *http.Request) {
+    googleID, _, err := googleauth.ExtraireUtilisateur(r)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+
+    var req souhaitRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ProduitID == "" {
+        http.Error(w, "Requête invalide ou produit_id manquant", http.StatusBadRequest)
+        return
+    }
+
+    if err := h.repo.DeplacerVersPanier(googleID, req.ProduitID); err != nil {
+        http.Error(w, fmt.Sprintf("Erreur lors du déplacement vers le panier : %v", err), http.StatusBadRequest)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]string{
+        "status":  "success",
+        "message": "Produit déplacé vers le panier",
+    })
+}
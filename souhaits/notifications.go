@@ -0,0 +1,42 @@
+package souhaits
+
+import (
+    "ecommerce-api/models"
+    "log"
+    "time"
+)
+
+// DemarrerSurveillance vérifie périodiquement les produits suivis des listes de souhaits
+// et envoie un email lorsqu'un prix baisse ou qu'un produit revient en stock.
+func DemarrerSurveillance(repo *Repository, emailService models.SouhaitEmailService, intervalle time.Duration) {
+    go func() {
+        ticker := time.NewTicker(intervalle)
+        defer ticker.Stop()
+
+        for range ticker.C {
+            verifierAlertes(repo, emailService)
+        }
+    }()
+}
+
+func verifierAlertes(repo *Repository, emailService models.SouhaitEmailService) {
+    if err := repo.ActualiserReferences(); err != nil {
+        log.Printf("Liste de souhaits : %v", err)
+    }
+
+    alertes, err := repo.AlertesEnAttente()
+    if err != nil {
+        log.Printf("Liste de souhaits : %v", err)
+        return
+    }
+
+    for _, alerte := range alertes {
+        if err := emailService.EnvoyerEmailAlerteSouhait(alerte); err != nil {
+            log.Printf("Erreur lors de l'envoi de l'alerte à %s: %v", alerte.Email, err)
+            continue
+        }
+        if err := repo.MarquerAlerteEnvoyee(alerte); err != nil {
+            log.Printf("Liste de souhaits : %v", err)
+        }
+    }
+}
@@ -0,0 +1,196 @@
+package souhaits
+
+import (
+    "ecommerce-api/models"
+    "fmt"
+
+    "github.com/jmoiron/sqlx"
+    "github.com/lib/pq"
+)
+
+type Repository struct {
+    db *sqlx.DB
+}
+
+func NewRepository(db *sqlx.DB) *Repository {
+    return &Repository{db: db}
+}
+
+// AjouterSouhait ajoute un produit à la liste de souhaits en mémorisant son prix et son stock actuels,
+// qui servent de référence pour les alertes.
+func (r *Repository) AjouterSouhait(googleID, produitID string, notifier bool) error {
+    result, err := r.db.Exec(`
+        INSERT INTO liste_souhaits (google_id, produit_id, notifier, prix_reference, stock_reference, created_at, updated_at)
+        SELECT $1, p.id, $3, p.prix, COALESCE(p.stock, 0), NOW(), NOW()
+        FROM produits p
+        WHERE p.id = $2
+        ON CONFLICT (google_id, produit_id)
+        DO UPDATE SET notifier = EXCLUDED.notifier, updated_at = NOW()`,
+        googleID, produitID, notifier)
+    if err != nil {
+        return fmt.Errorf("impossible d'ajouter le produit à la liste de souhaits: %v", err)
+    }
+
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return err
+    }
+    if rowsAffected == 0 {
+        return fmt.Errorf("aucun produit trouvé avec l'ID %s", produitID)
+    }
+    return nil
+}
+
+// ListerSouhaits retourne les produits de la liste de souhaits d'un utilisateur.
+func (r *Repository) ListerSouhaits(googleID string) ([]*models.ProduitSouhait, error) {
+    rows, err := r.db.Queryx(`
+        SELECT pr.id, pr.nom, pr.prix, COALESCE(pr.marque, ''), pr.photos,
+               COALESCE(pr.stock, 0), COALESCE(pr.disponible, false), ls.notifier, ls.created_at
+        FROM liste_souhaits ls
+        JOIN produits pr ON ls.produit_id = pr.id
+        WHERE ls.google_id = $1
+        ORDER BY ls.created_at DESC`, googleID)
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors de la récupération de la liste de souhaits: %v", err)
+    }
+    defer rows.Close()
+
+    produits := []*models.ProduitSouhait{}
+    for rows.Next() {
+        var produit models.ProduitSouhait
+        var photos pq.StringArray
+
+        if err := rows.Scan(&produit.ID, &produit.Nom, &produit.Prix, &produit.Marque, &photos,
+            &produit.Stock, &produit.Disponible, &produit.Notifier, &produit.AjouteLe); err != nil {
+            return nil, fmt.Errorf("erreur lors du scan de la liste de souhaits: %v", err)
+        }
+
+        produit.Photos = photos
+        if len(photos) > 0 {
+            produit.Photo = photos[0]
+        }
+        produits = append(produits, &produit)
+    }
+
+    return produits, rows.Err()
+}
+
+// EnleverSouhait retire un produit de la liste de souhaits.
+func (r *Repository) EnleverSouhait(googleID, produitID string) error {
+    result, err := r.db.Exec(`
+        DELETE FROM liste_souhaits
+        WHERE google_id = $1 AND produit_id = $2`,
+        googleID, produitID)
+    if err != nil {
+        return fmt.Errorf("impossible de retirer le produit de la liste de souhaits: %v", err)
+    }
+
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return err
+    }
+    if rowsAffected == 0 {
+        return fmt.Errorf("produit absent de la liste de souhaits")
+    }
+    return nil
+}
+
+// DeplacerVersPanier ajoute le produit au panier et le retire de la liste de souhaits dans une seule transaction.
+func (r *Repository) DeplacerVersPanier(googleID, produitID string) error {
+    tx, err := r.db.Beginx()
+    if err != nil {
+        return fmt.Errorf("erreur lors du début de la transaction: %v", err)
+    }
+    defer tx.Rollback()
+
+    result, err := tx.Exec(`
+        DELETE FROM liste_souhaits
+        WHERE google_id = $1 AND produit_id = $2`,
+        googleID, produitID)
+    if err != nil {
+        return fmt.Errorf("impossible de retirer le produit de la liste de souhaits: %v", err)
+    }
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return err
+    }
+    if rowsAffected == 0 {
+        return fmt.Errorf("produit absent de la liste de souhaits")
+    }
+
+    _, err = tx.Exec(`
+        INSERT INTO panier (user_id, produit_id, quantite, created_at, updated_at)
+        VALUES ($1, $2, 1, NOW(), NOW())
+        ON CONFLICT (user_id, produit_id) WHERE variante_id IS NULL
+        DO UPDATE SET quantite = panier.quantite + 1, updated_at = NOW()`,
+        googleID, produitID)
+    if err != nil {
+        return fmt.Errorf("impossible d'ajouter le produit au panier: %v", err)
+    }
+
+    if err = tx.Commit(); err != nil {
+        return fmt.Errorf("erreur lors de la validation de la transaction: %v", err)
+    }
+    return nil
+}
+
+// AlertesEnAttente retourne les souhaits suivis dont le produit a baissé de prix
+// ou est revenu en stock depuis la dernière référence connue.
+func (r *Repository) AlertesEnAttente() ([]models.AlerteSouhait, error) {
+    rows, err := r.db.Query(`
+        SELECT ls.id, u.email, p.nom, p.prix, ls.prix_reference, COALESCE(p.stock, 0),
+               p.prix < ls.prix_reference AS baisse_prix,
+               ls.stock_reference <= 0 AND COALESCE(p.stock, 0) > 0 AS retour_en_stock
+        FROM liste_souhaits ls
+        JOIN produits p ON p.id = ls.produit_id
+        JOIN users u ON u.google_id = ls.google_id
+        WHERE ls.notifier
+          AND p.disponible
+          AND (p.prix < ls.prix_reference OR (ls.stock_reference <= 0 AND COALESCE(p.stock, 0) > 0))`)
+    if err != nil {
+        return nil, fmt.Errorf("erreur lors de la recherche des alertes: %v", err)
+    }
+    defer rows.Close()
+
+    var alertes []models.AlerteSouhait
+    for rows.Next() {
+        var a models.AlerteSouhait
+        if err := rows.Scan(&a.SouhaitID, &a.Email, &a.NomProduit, &a.Prix, &a.AncienPrix, &a.Stock,
+            &a.BaissePrix, &a.RetourEnStock); err != nil {
+            return nil, fmt.Errorf("erreur lors du scan des alertes: %v", err)
+        }
+        alertes = append(alertes, a)
+    }
+    return alertes, rows.Err()
+}
+
+// MarquerAlerteEnvoyee met à jour les références du souhait pour ne pas renvoyer la même alerte.
+func (r *Repository) MarquerAlerteEnvoyee(alerte models.AlerteSouhait) error {
+    _, err := r.db.Exec(`
+        UPDATE liste_souhaits
+        SET prix_reference = $1, stock_reference = $2, updated_at = NOW()
+        WHERE id = $3`,
+        alerte.Prix, alerte.Stock, alerte.SouhaitID)
+    if err != nil {
+        return fmt.Errorf("erreur lors de la mise à jour du souhait: %v", err)
+    }
+    return nil
+}
+
+// ActualiserReferences enregistre les ruptures de stock et les hausses de prix,
+// afin qu'un retour en stock ou une baisse ultérieure déclenche une alerte.
+func (r *Repository) ActualiserReferences() error {
+    _, err := r.db.Exec(`
+        UPDATE liste_souhaits ls
+        SET stock_reference = LEAST(ls.stock_reference, COALESCE(p.stock, 0)),
+            prix_reference = GREATEST(ls.prix_reference, p.prix),
+            updated_at = NOW()
+        FROM produits p
+        WHERE p.id = ls.produit_id
+          AND ls.notifier
+          AND (COALESCE(p.stock, 0) < ls.stock_reference OR p.prix > ls.prix_reference)`)
+    if err != nil {
+        return fmt.Errorf("erreur lors de l'actualisation des références: %v", err)
+    }
+    return nil
+}